@@ -0,0 +1,187 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+// Tracks the animated tiles of a map so renderers can look up the frame
+// every animated tile shows at a point in time with a single map lookup,
+// instead of keeping animation state per tile. All animations start at
+// the same time, as in Tiled.
+type AnimationClock struct {
+	animations []clockAnimation
+	frames     map[uint32]uint32
+}
+
+// The gids and end times of the frames of an animated tile.
+type clockAnimation struct {
+	gid    uint32
+	gids   []uint32
+	ends   []time.Duration
+	length time.Duration
+}
+
+// Creates a clock for the animated tiles of the tilesets of m. Frames
+// without a duration are skipped, as are animations with no frame left.
+func NewAnimationClock(m *Map) (c *AnimationClock) {
+	c = &AnimationClock{frames: map[uint32]uint32{}}
+	for i := 0; i < len(m.Tilesets); i++ {
+		var ts = m.Tilesets[i]
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			var (
+				tile = ts.TilesetTile[j]
+				a    = clockAnimation{gid: ts.FirstGid + tile.Id}
+			)
+			if tile.Animation == nil {
+				continue
+			}
+			for k := 0; k < len(tile.Animation.Frames); k++ {
+				var frame = tile.Animation.Frames[k]
+				if frame.Duration == 0 {
+					continue
+				}
+				a.length += time.Duration(frame.Duration) * time.Millisecond
+				a.gids = append(a.gids, ts.FirstGid+frame.TileId)
+				a.ends = append(a.ends, a.length)
+			}
+			if len(a.gids) > 0 {
+				c.animations = append(c.animations, a)
+			}
+		}
+	}
+	return
+}
+
+// Returns a map from the gid of every animated tile to the gid of the
+// frame it shows once elapsed has passed since the animations started.
+// Gids are given without flip flags. The returned map is reused by the
+// next call to Frames.
+func (c *AnimationClock) Frames(elapsed time.Duration) map[uint32]uint32 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	for i := 0; i < len(c.animations); i++ {
+		var (
+			a = &c.animations[i]
+			t = elapsed % a.length
+			k = 0
+		)
+		for k < len(a.ends)-1 && t >= a.ends[k] {
+			k++
+		}
+		c.frames[a.gid] = a.gids[k]
+	}
+	return c.frames
+}
+
+// Renders the frames of the animation of the tile with local id in ts
+// next to each other, from left to right, for reviewing animations
+// outside of Tiled. Tileset images are loaded through LoadImage.
+func (m *Map) AnimationStrip(ts *Tileset, id uint32) (strip *image.RGBA, err error) {
+	var (
+		frames []*image.RGBA
+		width  int
+		height int
+		x      int
+	)
+	if frames, _, err = m.animationFrames(ts, id); err != nil {
+		return
+	}
+	for i := 0; i < len(frames); i++ {
+		width += frames[i].Bounds().Dx()
+		height = maxInt(height, frames[i].Bounds().Dy())
+	}
+	strip = image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(frames); i++ {
+		var b = frames[i].Bounds()
+		draw.Draw(strip, b.Add(image.Pt(x, 0)), frames[i], b.Min, draw.Src)
+		x += b.Dx()
+	}
+	return
+}
+
+// Renders the animation of the tile with local id in ts as a looping GIF,
+// keeping the duration of each frame to the hundredth of a second GIF
+// supports. Colors are reduced to the Plan 9 palette, with transparent
+// pixels kept transparent. Tileset images are loaded through LoadImage.
+func (m *Map) AnimationGIF(ts *Tileset, id uint32) (g *gif.GIF, err error) {
+	var (
+		frames  []*image.RGBA
+		delays  []int
+		colors  = append(color.Palette{color.Transparent}, palette.Plan9[:255]...)
+		drawing = draw.FloydSteinberg
+	)
+	if frames, delays, err = m.animationFrames(ts, id); err != nil {
+		return
+	}
+	g = &gif.GIF{}
+	for i := 0; i < len(frames); i++ {
+		var paletted = image.NewPaletted(frames[i].Bounds(), colors)
+		drawing.Draw(paletted, paletted.Bounds(), frames[i], frames[i].Bounds().Min)
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, delays[i])
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+		g.Config.Width = maxInt(g.Config.Width, paletted.Bounds().Dx())
+		g.Config.Height = maxInt(g.Config.Height, paletted.Bounds().Dy())
+	}
+	return
+}
+
+// Returns the images of the frames of the animation of the tile with
+// local id in ts, and their durations in hundredths of a second.
+func (m *Map) animationFrames(ts *Tileset, id uint32) (frames []*image.RGBA, delays []int, err error) {
+	var (
+		tile   = ts.TileById(id)
+		loaded = map[*Image]image.Image{}
+	)
+	if tile == nil || tile.Animation == nil || len(tile.Animation.Frames) == 0 {
+		err = fmt.Errorf("Tile %v of tileset %v is not animated", id, ts.Name)
+		return
+	}
+	for i := 0; i < len(tile.Animation.Frames); i++ {
+		var (
+			frame = tile.Animation.Frames[i]
+			img   = ts.imageFor(frame.TileId)
+			src   image.Image
+			rect  image.Rectangle
+		)
+		if img == nil {
+			err = fmt.Errorf("No image for tile %v of tileset %v", frame.TileId, ts.Name)
+			return
+		}
+		if src = loaded[img]; src == nil {
+			if src, err = m.LoadImage(img); err != nil {
+				return
+			}
+			loaded[img] = src
+		}
+		if rect = src.Bounds(); ts.Image != nil {
+			rect = ts.tileRect(frame.TileId).Add(rect.Min)
+		}
+		var rendered = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(rendered, rendered.Bounds(), src, rect.Min, draw.Src)
+		frames = append(frames, rendered)
+		delays = append(delays, int(frame.Duration+5)/10)
+	}
+	return
+}
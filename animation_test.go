@@ -0,0 +1,122 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const TEST_ANIMATION_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="water" tilewidth="16" tileheight="16">
+  <image source="strip.png" width="64" height="16"/>
+  <tile id="0">
+   <animation>
+    <frame tileid="2" duration="100"/>
+    <frame tileid="0" duration="250"/>
+   </animation>
+  </tile>
+ </tileset>
+ <layer name="ground" width="1" height="1">
+  <data>
+   <tile gid="1" />
+  </data>
+ </layer>
+</map>
+`
+
+func TestAnimationExport(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_ANIMATION_MAP)},
+			"strip.png": &fstest.MapFile{Data: testStripPNG(t, 4)},
+		})
+		m     *Map
+		strip *image.RGBA
+		g     *gif.GIF
+		out   string
+		err   error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var ts = m.Tilesets[0]
+	if a := ts.TilesetTile[0].Animation; a == nil || !reflect.DeepEqual(a.Frames, []Frame{{2, 100}, {0, 250}}) {
+		t.Fatalf("Invalid animation: %v", a)
+	}
+	if strip, err = m.AnimationStrip(ts, 0); err != nil {
+		t.Fatalf("Could not render strip: %v", err)
+	}
+	if strip.Bounds().Dx() != 32 || strip.Bounds().Dy() != 16 {
+		t.Errorf("Invalid strip size: %v", strip.Bounds())
+	}
+	if c := strip.RGBAAt(0, 0); c != (color.RGBA{2, 0, 0, 255}) {
+		t.Errorf("Invalid first frame: %v", c)
+	}
+	if c := strip.RGBAAt(16, 0); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Invalid second frame: %v", c)
+	}
+	if g, err = m.AnimationGIF(ts, 0); err != nil {
+		t.Fatalf("Could not render GIF: %v", err)
+	}
+	if len(g.Image) != 2 || !reflect.DeepEqual(g.Delay, []int{10, 25}) || g.Config.Width != 16 {
+		t.Errorf("Invalid GIF: %v frames, delays %v", len(g.Image), g.Delay)
+	}
+	if _, err = m.AnimationStrip(ts, 1); err == nil {
+		t.Errorf("Expected error for tile without animation")
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `<frame tileid="2" duration="100"></frame>`) {
+		t.Errorf("Animation not serialized: %v", out)
+	}
+}
+
+func TestAnimationClock(t *testing.T) {
+	var (
+		m     *Map
+		clock *AnimationClock
+		err   error
+	)
+	if m, err = ParseMapString(TEST_ANIMATION_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	clock = NewAnimationClock(m)
+	for _, c := range []struct {
+		elapsed time.Duration
+		gid     uint32
+	}{
+		{0, 3},
+		{99 * time.Millisecond, 3},
+		{100 * time.Millisecond, 1},
+		{349 * time.Millisecond, 1},
+		{350 * time.Millisecond, 3},
+		{800 * time.Millisecond, 1},
+	} {
+		var frames = clock.Frames(c.elapsed)
+		if len(frames) != 1 || frames[1] != c.gid {
+			t.Errorf("Wrong frames at %v: %v", c.elapsed, frames)
+		}
+	}
+}
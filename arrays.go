@@ -0,0 +1,114 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"sort"
+)
+
+// Controls the output of Layer.BuildArrays.
+type ArrayOptions struct {
+	// Emit two triangles of six vertices per tile, for drawing without an
+	// index buffer, instead of four vertices per tile.
+	Triangles bool
+
+	// Emit texture coordinates in the range 0 to 1 instead of pixels of
+	// the tileset image.
+	NormalizedUV bool
+}
+
+// The vertex data for the tiles of a layer drawn from a single tileset.
+// Vertices of a tile run top-left, top-right, bottom-right, bottom-left
+// as drawn, or top-left, top-right, bottom-right, top-left,
+// bottom-right, bottom-left when ArrayOptions.Triangles is set.
+type TileArrays struct {
+	Tileset *Tileset
+
+	// The number of tiles in the batch.
+	Count int
+
+	// The x, y position of every vertex in map pixels, relative to the
+	// map's Origin, with layer and tileset offsets applied.
+	Positions []float32
+
+	// The u, v texture coordinates of every vertex, with flips applied,
+	// as returned by Tile.UV.
+	UVs []float32
+
+	// The r, g, b, a color of every vertex, which is white at the
+	// opacity of the layer.
+	Colors []float32
+}
+
+// Returns the positions, texture coordinates and colors of every set
+// tile of the layer, grouped by tileset in the order of the tilesets'
+// first gids, so renderers can fill vertex buffers without a method
+// call per tile.
+func (l *Layer) BuildArrays(m *Map, opts ArrayOptions) (arrays []*TileArrays, err error) {
+	var (
+		tiles     []*Tile
+		byTileset = map[*Tileset]*TileArrays{}
+		order     = []int{0, 1, 2, 3}
+		dy        = float32(1)
+	)
+	if tiles, err = m.tilesFromLayer(context.Background(), l); err != nil {
+		return
+	}
+	if opts.Triangles {
+		order = []int{0, 1, 2, 0, 2, 3}
+	}
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		dy = -1
+	}
+	for i := 0; i < len(tiles); i++ {
+		var t = tiles[i]
+		if t == nil {
+			continue
+		}
+		var a = byTileset[t.Tileset]
+		if a == nil {
+			a = &TileArrays{Tileset: t.Tileset}
+			byTileset[t.Tileset] = a
+			arrays = append(arrays, a)
+		}
+		var (
+			b       = t.TileBounds
+			uv      = t.UV(opts.NormalizedUV)
+			ox, oy  = l.OffsetX, l.OffsetY
+			corners [4]Point
+		)
+		if off := t.Tileset.TileOffset; off != nil {
+			ox += float32(off.X)
+			oy += float32(off.Y)
+		}
+		b.X += ox
+		b.Y += oy * dy
+		corners = [4]Point{{b.X, b.Y}, {b.X + b.W, b.Y}, {b.X + b.W, b.Y + b.H}, {b.X, b.Y + b.H}}
+		if m.Origin == ORIGIN_BOTTOM_LEFT {
+			// The top of the tile as drawn has the larger Y.
+			corners = [4]Point{corners[3], corners[2], corners[1], corners[0]}
+		}
+		for j := 0; j < len(order); j++ {
+			var c = corners[order[j]]
+			a.Positions = append(a.Positions, c.X, c.Y)
+			a.UVs = append(a.UVs, uv[order[j]].X, uv[order[j]].Y)
+			a.Colors = append(a.Colors, 1, 1, 1, l.Opacity)
+		}
+		a.Count++
+	}
+	sort.Slice(arrays, func(i, j int) bool { return arrays[i].Tileset.FirstGid < arrays[j].Tileset.FirstGid })
+	return
+}
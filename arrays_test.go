@@ -0,0 +1,69 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayerBuildArrays(t *testing.T) {
+	var (
+		m = &Map{
+			Orientation: "orthogonal",
+			Width:       2,
+			Height:      1,
+			TileWidth:   16,
+			TileHeight:  16,
+			Origin:      ORIGIN_TOP_LEFT,
+			Tilesets: []*Tileset{
+				{FirstGid: 3, Name: "b", TileWidth: 16, TileHeight: 16, Image: &Image{Width: 32, Height: 16}},
+				{FirstGid: 1, Name: "a", TileWidth: 16, TileHeight: 16, Image: &Image{Width: 32, Height: 16}},
+			},
+		}
+		grid   = NewDataTileGrid(2, 1)
+		layer  *Layer
+		arrays []*TileArrays
+		err    error
+	)
+	grid.Tiles[0][0].Id = 3
+	grid.Tiles[1][0] = DataTileGridTile{Id: 1, FlipX: true}
+	if layer, err = NewLayer("ground", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	layer.Opacity = 0.5
+	if arrays, err = layer.BuildArrays(m, ArrayOptions{NormalizedUV: true}); err != nil {
+		t.Fatalf("Could not build arrays: %v", err)
+	}
+	if len(arrays) != 2 || arrays[0].Tileset.Name != "a" || arrays[0].Count != 1 {
+		t.Fatalf("Invalid batches: %v", arrays)
+	}
+	var a = arrays[0]
+	if !reflect.DeepEqual(a.Positions, []float32{16, 0, 32, 0, 32, 16, 16, 16}) {
+		t.Errorf("Invalid positions: %v", a.Positions)
+	}
+	if !reflect.DeepEqual(a.UVs, []float32{0.5, 0, 0, 0, 0, 1, 0.5, 1}) {
+		t.Errorf("Invalid UVs: %v", a.UVs)
+	}
+	if len(a.Colors) != 16 || a.Colors[3] != 0.5 {
+		t.Errorf("Invalid colors: %v", a.Colors)
+	}
+	if arrays, err = layer.BuildArrays(m, ArrayOptions{Triangles: true}); err != nil {
+		t.Fatalf("Could not build arrays: %v", err)
+	}
+	if len(arrays[1].Positions) != 12 || len(arrays[1].UVs) != 12 || len(arrays[1].Colors) != 24 {
+		t.Errorf("Invalid triangle arrays: %v", arrays[1])
+	}
+}
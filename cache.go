@@ -0,0 +1,122 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Starts every decode cache, followed by the SHA-256 of the map file,
+// the number of layers and, for each layer, the number of gids and the
+// gids themselves. All numbers are little endian uint32.
+const DECODE_CACHE_MAGIC = "TMXC\x01"
+
+// Writes the gids of every layer of the map to w, keyed by the contents
+// of the file the map was read from, so a Loader with DecodeCache set
+// can skip decoding them the next time the unchanged file is read. The
+// cache is meant to be stored next to the map, with ".cache" appended
+// to its name. The map must have been read by a Loader with DecodeCache
+// set, and its layers must be unchanged since, as the cache would
+// otherwise hand the changed tiles to the unchanged file.
+func (m *Map) WriteDecodeCache(w io.Writer) (err error) {
+	var (
+		buf  bytes.Buffer
+		grid DataTileGrid
+	)
+	if m.contentHash == nil {
+		return fmt.Errorf("Map was not read with DecodeCache set")
+	}
+	if len(m.Layers) != len(m.contentData) {
+		return fmt.Errorf("Layers were added or removed since the map was read")
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if m.Layers[i].Data != m.contentData[i] || m.Layers[i].Data.modified {
+			return m.layerError(m.Layers[i], fmt.Errorf("Tiles were changed since the map was read"))
+		}
+	}
+	buf.WriteString(DECODE_CACHE_MAGIC)
+	buf.Write(m.contentHash)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(m.Layers)))
+	for i := 0; i < len(m.Layers); i++ {
+		if grid, err = m.Layers[i].GetGrid(); err != nil {
+			return m.layerError(m.Layers[i], err)
+		}
+		var gids = make([]uint32, grid.Width*grid.Height)
+		for y := 0; y < grid.Height; y++ {
+			for x := 0; x < grid.Width; x++ {
+				gids[grid.Width*y+x] = uint32(grid.Tiles[x][y].GID())
+			}
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(len(gids)))
+		buf.Write(gidBytes(gids))
+	}
+	_, err = buf.WriteTo(w)
+	return
+}
+
+// Reads the decode cache at name and hands its gids to the layers of m
+// if it was written for data. A missing, stale or malformed cache is
+// ignored, leaving the layers to be decoded as usual.
+func (l *Loader) readDecodeCache(name string, data []byte, m *Map) {
+	var (
+		sum    = sha256.Sum256(data)
+		cache  []byte
+		r      *bytes.Reader
+		count  uint32
+		layers [][]uint32
+		err    error
+	)
+	m.contentHash = sum[:]
+	for i := 0; i < len(m.Layers); i++ {
+		m.contentData = append(m.contentData, m.Layers[i].Data)
+	}
+	if cache, err = fs.ReadFile(l.FS, name); err != nil {
+		return
+	}
+	if !bytes.HasPrefix(cache, []byte(DECODE_CACHE_MAGIC)) {
+		return
+	}
+	cache = cache[len(DECODE_CACHE_MAGIC):]
+	if len(cache) < len(sum) || !bytes.Equal(cache[:len(sum)], sum[:]) {
+		return
+	}
+	r = bytes.NewReader(cache[len(sum):])
+	if binary.Read(r, binary.LittleEndian, &count) != nil || int(count) != len(m.Layers) {
+		return
+	}
+	layers = make([][]uint32, count)
+	for i := 0; i < len(layers); i++ {
+		var layer = m.Layers[i]
+		if binary.Read(r, binary.LittleEndian, &count) != nil || int64(count) != int64(layer.Width)*int64(layer.Height) {
+			return
+		}
+		var data = make([]byte, int(count)*4)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return
+		}
+		layers[i] = make([]uint32, count)
+		for j := 0; j < len(layers[i]); j++ {
+			layers[i][j] = binary.LittleEndian.Uint32(data[j*4:])
+		}
+	}
+	for i := 0; i < len(layers); i++ {
+		m.Layers[i].Data.cached = layers[i]
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDecodeCache(t *testing.T) {
+	var (
+		fsys = fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_COMPACT_MAP)},
+		}
+		loader = &Loader{FS: fsys, DecodeCache: true}
+		m      *Map
+		buf    bytes.Buffer
+		grid   DataTileGrid
+		err    error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Layers[0].Data.cached != nil {
+		t.Errorf("Cache used before it was written")
+	}
+	if err = m.WriteDecodeCache(&buf); err != nil {
+		t.Fatalf("Could not write cache: %v", err)
+	}
+	fsys["level.tmx.cache"] = &fstest.MapFile{Data: buf.Bytes()}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Layers[0].Data.cached == nil {
+		t.Fatalf("Cache not used")
+	}
+	m.Layers[0].Data.RawTiles = nil
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 2 || grid.Tiles[1][0].Id != 10 || !grid.Tiles[1][0].FlipX {
+		t.Errorf("Invalid cached grid: %v", grid.Tiles)
+	}
+	fsys["level.tmx"] = &fstest.MapFile{Data: []byte(strings.Replace(TEST_COMPACT_MAP, `gid="2"`, `gid="3"`, 1))}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Layers[0].Data.cached != nil {
+		t.Errorf("Stale cache used")
+	}
+	if err = m.Layers[0].SetGrid(NewDataTileGrid(2, 2)); err != nil {
+		t.Fatalf("Could not set grid: %v", err)
+	}
+	if err = m.WriteDecodeCache(&buf); err == nil {
+		t.Errorf("Expected error writing cache of changed layer")
+	}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Layers[0].Data = &Data{}
+	if err = m.WriteDecodeCache(&buf); err == nil {
+		t.Errorf("Expected error writing cache of replaced data")
+	}
+	if err = (&Map{}).WriteDecodeCache(&buf); err == nil {
+		t.Errorf("Expected error writing cache of map without content hash")
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The name of the manifest SliceIntoCells writes next to the cells.
+const CELL_MANIFEST_NAME = "manifest.json"
+
+// Describes the cells a map was sliced into by SliceIntoCells, so an
+// engine can find the cells around the player without opening them.
+type CellManifest struct {
+	// The size of the sliced map and of its cells, in tiles. Cells on
+	// the right and bottom edges are smaller if the map size isn't a
+	// multiple of the cell size.
+	Width      int `json:"width"`
+	Height     int `json:"height"`
+	CellWidth  int `json:"cellWidth"`
+	CellHeight int `json:"cellHeight"`
+
+	// The number of cells across and down.
+	Columns int `json:"columns"`
+	Rows    int `json:"rows"`
+
+	// The size of a tile, in pixels.
+	TileWidth  int32 `json:"tileWidth"`
+	TileHeight int32 `json:"tileHeight"`
+
+	// Every distinct tileset used by a cell. Cells refer to these by
+	// name, tilesets sharing a name differ in their source or image.
+	Tilesets []CellTileset `json:"tilesets"`
+
+	// The cells, row by row.
+	Cells []Cell `json:"cells"`
+}
+
+// A tileset shared by the cells of a sliced map.
+type CellTileset struct {
+	Name string `json:"name"`
+
+	// The external tileset file, relative to the cells, if any.
+	Source string `json:"source,omitempty"`
+
+	// The tileset image, relative to the cells, if any.
+	Image string `json:"image,omitempty"`
+}
+
+// A cell of a sliced map.
+type Cell struct {
+	// The column and row of the cell.
+	Column int `json:"column"`
+	Row    int `json:"row"`
+
+	// The area of the sliced map covered by the cell, in tiles.
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// The name of the map file of the cell.
+	File string `json:"file"`
+
+	// The names of the tilesets the cell uses.
+	Tilesets []string `json:"tilesets"`
+}
+
+// Splits an orthogonal map into cells of cellW by cellH tiles, written
+// to outDir as maps of their own as by ExtractRegion, along with a
+// manifest describing them at CELL_MANIFEST_NAME, so open world levels
+// can be streamed in a cell at a time. The cell at column c and row r
+// is written to "cell_c_r.tmx".
+//
+// Relative file references of the map are rewritten to be relative to
+// outDir. Maps read through a Loader can only be sliced if they have no
+// relative file references, as their location on disk is not known.
+func (m *Map) SliceIntoCells(cellW, cellH int, outDir string) (manifest *CellManifest, err error) {
+	var shared = map[CellTileset]bool{}
+	if cellW <= 0 || cellH <= 0 {
+		err = fmt.Errorf("Invalid cell size %vx%v", cellW, cellH)
+		return
+	}
+	if err = m.checkOrthogonal("Slicing"); err != nil {
+		return
+	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return
+	}
+	manifest = &CellManifest{
+		Width:      int(m.Width),
+		Height:     int(m.Height),
+		CellWidth:  cellW,
+		CellHeight: cellH,
+		Columns:    (int(m.Width) + cellW - 1) / cellW,
+		Rows:       (int(m.Height) + cellH - 1) / cellH,
+		TileWidth:  m.TileWidth,
+		TileHeight: m.TileHeight,
+	}
+	for row := 0; row < manifest.Rows; row++ {
+		for col := 0; col < manifest.Columns; col++ {
+			var (
+				rect = image.Rect(col*cellW, row*cellH, minInt((col+1)*cellW, int(m.Width)), minInt((row+1)*cellH, int(m.Height)))
+				cell = Cell{
+					Column:   col,
+					Row:      row,
+					X:        rect.Min.X,
+					Y:        rect.Min.Y,
+					Width:    rect.Dx(),
+					Height:   rect.Dy(),
+					File:     fmt.Sprintf("cell_%v_%v.tmx", col, row),
+					Tilesets: []string{},
+				}
+				region *Map
+				out    string
+			)
+			if region, err = m.ExtractRegion(rect); err != nil {
+				return nil, err
+			}
+			if err = m.relocateCell(region, outDir); err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(region.Tilesets); i++ {
+				var (
+					ts    = region.Tilesets[i]
+					entry = CellTileset{Name: ts.Name, Source: ts.Source}
+				)
+				cell.Tilesets = append(cell.Tilesets, ts.Name)
+				if ts.Image != nil {
+					entry.Image = ts.Image.Source
+				}
+				if shared[entry] {
+					continue
+				}
+				shared[entry] = true
+				manifest.Tilesets = append(manifest.Tilesets, entry)
+			}
+			if out, err = region.Serialize(); err != nil {
+				return nil, fmt.Errorf("Cell %v,%v: %v", col, row, err)
+			}
+			if err = ioutil.WriteFile(filepath.Join(outDir, cell.File), []byte(out), 0644); err != nil {
+				return nil, err
+			}
+			manifest.Cells = append(manifest.Cells, cell)
+		}
+	}
+	var data []byte
+	if data, err = json.MarshalIndent(manifest, "", "    "); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(outDir, CELL_MANIFEST_NAME), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Rewrites the relative file references of region, a region extracted
+// from m, to be relative to outDir. The tilesets and images of region are
+// copied first, as they are shared with m. Fails for relative references
+// of maps read through a Loader, which have no path on disk.
+func (m *Map) relocateCell(region *Map, outDir string) (err error) {
+	var (
+		move = func(p string) string {
+			if m.Loader == nil {
+				return m.relocatePath(p, outDir)
+			}
+			if p != "" && !path.IsAbs(p) && err == nil {
+				err = fmt.Errorf("Cannot relocate %v of a map read through a Loader", p)
+			}
+			return p
+		}
+		relocate = func(img *Image) *Image {
+			if img == nil {
+				return nil
+			}
+			var copied = *img
+			copied.Source = move(img.Source)
+			return &copied
+		}
+	)
+	for i := 0; i < len(region.Tilesets); i++ {
+		var ts = *region.Tilesets[i]
+		ts.Source = move(ts.Source)
+		ts.Image = relocate(ts.Image)
+		ts.TilesetTile = append([]TilesetTile{}, ts.TilesetTile...)
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			ts.TilesetTile[j].Image = relocate(ts.TilesetTile[j].Image)
+		}
+		region.Tilesets[i] = &ts
+	}
+	for i := 0; i < len(region.ImageLayers); i++ {
+		region.ImageLayers[i].Image = relocate(region.ImageLayers[i].Image)
+	}
+	region.BaseDir = outDir
+	return
+}
+
+// Returns the path p, relative to the map, relative to dir instead.
+// Absolute paths and paths which can't be made relative to dir are
+// returned unchanged.
+func (m *Map) relocatePath(p, dir string) string {
+	if p == "" || filepath.IsAbs(filepath.FromSlash(p)) {
+		return p
+	}
+	if rel, err := filepath.Rel(dir, m.ResolvePath(p)); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return p
+}
@@ -0,0 +1,136 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_CELLS_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="3" height="2" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="grass" tilewidth="16" tileheight="16" tilecount="4">
+  <image source="tiles/grass.png" width="64" height="16"/>
+ </tileset>
+ <tileset firstgid="5" name="rock" tilewidth="16" tileheight="16" tilecount="4">
+  <image source="tiles/rock.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ground" width="3" height="2">
+  <data encoding="csv">1,2,5,2,1,6</data>
+ </layer>
+</map>
+`
+
+func TestSliceIntoCells(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		outDir   = filepath.Join(dir, "cells")
+		m        *Map
+		manifest *CellManifest
+		written  CellManifest
+		cell     *Map
+		data     []byte
+		gids     []uint32
+		err      error
+	)
+	if m, err = ParseMapString(TEST_CELLS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.BaseDir = filepath.Join(dir, "maps")
+	if manifest, err = m.SliceIntoCells(2, 2, outDir); err != nil {
+		t.Fatalf("Could not slice: %v", err)
+	}
+	if manifest.Columns != 2 || manifest.Rows != 1 || len(manifest.Cells) != 2 {
+		t.Fatalf("Wrong cells: %v", manifest)
+	}
+	if c := manifest.Cells[1]; c.X != 2 || c.Y != 0 || c.Width != 1 || c.Height != 2 || c.File != "cell_1_0.tmx" {
+		t.Errorf("Wrong edge cell: %v", c)
+	}
+	if names := manifest.Cells[0].Tilesets; len(names) != 1 || names[0] != "grass" {
+		t.Errorf("Wrong tilesets of first cell: %v", names)
+	}
+	if len(manifest.Tilesets) != 2 || manifest.Tilesets[1] != (CellTileset{Name: "rock", Image: "../maps/tiles/rock.png"}) {
+		t.Errorf("Wrong shared tilesets: %v", manifest.Tilesets)
+	}
+	if data, err = ioutil.ReadFile(filepath.Join(outDir, CELL_MANIFEST_NAME)); err != nil {
+		t.Fatalf("Could not read manifest: %v", err)
+	}
+	if err = json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Could not decode manifest: %v", err)
+	}
+	if len(written.Cells) != 2 || written.Cells[1].File != "cell_1_0.tmx" {
+		t.Errorf("Wrong manifest written: %s", data)
+	}
+	if cell, err = ParseMapFile(filepath.Join(outDir, "cell_1_0.tmx")); err != nil {
+		t.Fatalf("Could not parse cell: %v", err)
+	}
+	if gids, err = cell.Layers[0].Data.Gids(); err != nil {
+		t.Fatalf("Could not get gids: %v", err)
+	}
+	if cell.Width != 1 || len(gids) != 2 || gids[0] != 1 || gids[1] != 2 {
+		t.Errorf("Wrong cell tiles: %v", gids)
+	}
+	if m.Tilesets[0].Image.Source != "tiles/grass.png" {
+		t.Errorf("Source map changed: %v", m.Tilesets[0].Image.Source)
+	}
+	if _, err = m.SliceIntoCells(0, 2, outDir); err == nil {
+		t.Errorf("Expected error for invalid cell size")
+	}
+}
+
+func TestSliceIntoCellsSharedNames(t *testing.T) {
+	var (
+		outDir   = t.TempDir()
+		m        *Map
+		manifest *CellManifest
+		err      error
+	)
+	if m, err = ParseMapString(strings.Replace(TEST_CELLS_MAP, `name="rock"`, `name="grass"`, 1)); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if manifest, err = m.SliceIntoCells(2, 2, outDir); err != nil {
+		t.Fatalf("Could not slice: %v", err)
+	}
+	if len(manifest.Tilesets) != 2 || manifest.Tilesets[0].Image == manifest.Tilesets[1].Image {
+		t.Errorf("Tilesets sharing a name merged: %v", manifest.Tilesets)
+	}
+}
+
+func TestSliceIntoCellsLoader(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"maps/level.tmx": &fstest.MapFile{Data: []byte(TEST_CELLS_MAP)},
+		})
+		outDir = t.TempDir()
+		m      *Map
+		err    error
+	)
+	if m, err = loader.ParseMapFile("maps/level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = m.SliceIntoCells(2, 2, outDir); err == nil {
+		t.Errorf("Expected error relocating references of a loaded map")
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		m.Tilesets[i].Image.Source = "/" + m.ResolvePath(m.Tilesets[i].Image.Source)
+	}
+	if _, err = m.SliceIntoCells(2, 2, outDir); err != nil {
+		t.Errorf("Could not slice map without relative references: %v", err)
+	}
+}
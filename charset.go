@@ -0,0 +1,156 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// If set, called to decode maps whose XML declaration names a charset
+// other than UTF-8, ISO-8859-1, US-ASCII or UTF-16, which are supported
+// out of the box. It has the signature of xml.Decoder.CharsetReader, so
+// charset.NewReaderLabel from golang.org/x/net/html/charset can be
+// assigned to support every charset known to golang.org/x/text.
+var CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+// Matches general entity declarations with a literal value, which is
+// all the internal DTD subset of a map is expected to contain.
+var entityDecl = regexp.MustCompile(`<!ENTITY\s+([^\s%]+)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+
+// Returns a decoder for the map in data. Files starting with a UTF-16
+// byte order mark are transcoded to UTF-8 up front, since the XML
+// declaration naming their charset can't be read otherwise. A UTF-8
+// byte order mark is dropped, and entities declared in the internal
+// subset of a DOCTYPE are made available to the decoder, which would
+// otherwise fail on any reference to them.
+func newMapDecoder(data []byte) (decoder *xml.Decoder, err error) {
+	var utf16Input bool
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if len(data) >= 2 && (data[0] == 0xFE && data[1] == 0xFF || data[0] == 0xFF && data[1] == 0xFE) {
+		if data, err = utf16ToUTF8(data); err != nil {
+			return
+		}
+		utf16Input = true
+	}
+	decoder = xml.NewDecoder(bytes.NewReader(data))
+	decoder.Entity = doctypeEntities(data)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "iso-8859-1", "iso8859-1", "latin1", "l1":
+			return &latin1Reader{r: bufio.NewReader(input)}, nil
+		case "us-ascii", "ascii":
+			return input, nil
+		case "utf-16", "utf-16le", "utf-16be":
+			if utf16Input {
+				return input, nil
+			}
+		}
+		if CharsetReader != nil {
+			return CharsetReader(charset, input)
+		}
+		return nil, fmt.Errorf("Unsupported charset %v", charset)
+	}
+	return
+}
+
+// Returns the entities declared in the internal subset of the DOCTYPE
+// of data, or nil if there are none.
+func doctypeEntities(data []byte) (entities map[string]string) {
+	var (
+		start = bytes.Index(data, []byte("<!DOCTYPE"))
+		open  int
+		end   int
+	)
+	if start < 0 {
+		return
+	}
+	data = data[start:]
+	if open = bytes.IndexAny(data, "[>"); open < 0 || data[open] != '[' {
+		return
+	}
+	if end = bytes.Index(data[open:], []byte("]")); end < 0 {
+		return
+	}
+	var matches = entityDecl.FindAllSubmatch(data[open:open+end], -1)
+	for i := 0; i < len(matches); i++ {
+		if entities == nil {
+			entities = map[string]string{}
+		}
+		entities[string(matches[i][1])] = string(matches[i][2]) + string(matches[i][3])
+	}
+	return
+}
+
+// Decodes data, which must start with a byte order mark, from UTF-16.
+// The byte order mark is dropped.
+func utf16ToUTF8(data []byte) (out []byte, err error) {
+	var (
+		units     = make([]uint16, (len(data)-2)/2)
+		bigEndian = data[0] == 0xFE
+	)
+	if len(data)%2 != 0 {
+		err = fmt.Errorf("Odd number of bytes in UTF-16 input")
+		return
+	}
+	for i := 0; i < len(units); i++ {
+		var hi, lo = data[2+2*i], data[3+2*i]
+		if !bigEndian {
+			hi, lo = lo, hi
+		}
+		units[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	out = []byte(string(utf16.Decode(units)))
+	return
+}
+
+// Converts ISO-8859-1 input, where every byte is the code point of the
+// same value, to UTF-8.
+type latin1Reader struct {
+	r   io.ByteReader
+	buf []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (n int, err error) {
+	var b byte
+	for n < len(p) {
+		if len(l.buf) > 0 {
+			var c = copy(p[n:], l.buf)
+			l.buf = l.buf[c:]
+			n += c
+			continue
+		}
+		if b, err = l.r.ReadByte(); err != nil {
+			if n > 0 && err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n++
+			continue
+		}
+		l.buf = []byte(string(rune(b)))
+	}
+	return
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"unicode/utf16"
+)
+
+const TEST_CHARSET_MAP = `<?xml version="1.0" encoding="%v"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="title" value="Caf%v"/>
+ </properties>
+</map>
+`
+
+func testCharsetMap(charset, e string) string {
+	return fmt.Sprintf(TEST_CHARSET_MAP, charset, e)
+}
+
+func TestParseLatin1(t *testing.T) {
+	var (
+		m   *Map
+		err error
+	)
+	if m, err = ParseMapString(testCharsetMap("ISO-8859-1", "\xe9")); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Properties[0].Value != "Café" {
+		t.Errorf("Invalid value: %q", m.Properties[0].Value)
+	}
+}
+
+func TestParseUTF16(t *testing.T) {
+	var (
+		units = utf16.Encode([]rune(testCharsetMap("UTF-16", "é")))
+		buf   = bytes.NewBuffer([]byte{0xFF, 0xFE})
+		m     *Map
+		err   error
+	)
+	for i := 0; i < len(units); i++ {
+		buf.Write([]byte{byte(units[i]), byte(units[i] >> 8)})
+	}
+	if m, err = ParseMapReader(buf); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Properties[0].Value != "Café" {
+		t.Errorf("Invalid value: %q", m.Properties[0].Value)
+	}
+}
+
+func TestCharsetReader(t *testing.T) {
+	var (
+		data = testCharsetMap("x-custom", "e")
+		m    *Map
+		err  error
+	)
+	if _, err = ParseMapString(data); err == nil {
+		t.Errorf("Expected error for unknown charset")
+	}
+	CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	defer func() { CharsetReader = nil }()
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Properties[0].Value != "Cafe" {
+		t.Errorf("Invalid value: %q", m.Properties[0].Value)
+	}
+}
+
+const TEST_DOCTYPE_MAP = "\xef\xbb\xbf" + `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE map SYSTEM "http://mapeditor.org/dtd/1.0/map.dtd" [
+ <!ENTITY title "Cafe">
+ <!ENTITY author 'Arne'>
+]>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="title" value="&title;"/>
+  <property name="author" value="&author;"/>
+ </properties>
+</map>
+`
+
+func TestParseDoctype(t *testing.T) {
+	var (
+		m   *Map
+		err error
+	)
+	if m, err = ParseMapString(TEST_DOCTYPE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if len(m.Properties) != 2 || m.Properties[0].Value != "Cafe" || m.Properties[1].Value != "Arne" {
+		t.Errorf("Entities not resolved: %v", m.Properties)
+	}
+}
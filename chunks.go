@@ -0,0 +1,411 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// The chunk size of infinite maps without editor settings giving one.
+const DEFAULT_CHUNK_SIZE = 16
+
+// Infinite maps store the data of tile layers in chunks instead of as a
+// single grid. Chunks use the encoding and compression of the data
+// containing them. (since 1.2)
+type Chunk struct {
+	// The x coordinate of the chunk in tiles.
+	X int32 `xml:"x,attr"`
+
+	// The y coordinate of the chunk in tiles.
+	Y int32 `xml:"y,attr"`
+
+	// The width of the chunk in tiles.
+	Width int32 `xml:"width,attr"`
+
+	// The height of the chunk in tiles.
+	Height int32 `xml:"height,attr"`
+
+	// Can contain tile.
+	RawTiles []DataTile `xml:"tile"`
+
+	RawContents string `xml:",chardata"`
+}
+
+// Returns an error if the chunk has no tiles, which would make its tiles
+// land outside its bounds.
+func (c *Chunk) validate() error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return fmt.Errorf("Chunk %v,%v: Invalid size %vx%v", c.X, c.Y, c.Width, c.Height)
+	}
+	return nil
+}
+
+// Returns whether the data is stored in chunks, which is the case for
+// all tile layers of infinite maps.
+func (d *Data) chunked() bool {
+	return d.infinite || len(d.Chunks) > 0
+}
+
+// Returns the contents of c as data of its own, to decode it with the
+// encoding and compression of d.
+func (d *Data) chunkData(c *Chunk) *Data {
+	return &Data{
+		Encoding:    d.Encoding,
+		Compression: d.Compression,
+		RawTiles:    c.RawTiles,
+		RawContents: c.RawContents,
+		level:       d.level,
+		limits:      d.limits,
+	}
+}
+
+// Returns the area covered by the chunks of the data, in tiles. Grids of
+// chunked data cover this area, with their top left tile at Min.
+func (d *Data) ChunkBounds() (bounds image.Rectangle) {
+	for i := 0; i < len(d.Chunks); i++ {
+		var c = d.Chunks[i]
+		bounds = bounds.Union(image.Rect(int(c.X), int(c.Y), int(c.X+c.Width), int(c.Y+c.Height)))
+	}
+	return
+}
+
+// Decodes the chunks into a grid covering their bounds. Tiles no chunk
+// covers are empty.
+func (d *Data) chunkGrid(ctx context.Context) (grid DataTileGrid, err error) {
+	var bounds = d.ChunkBounds()
+	if max := d.limits.MaxTiles; max > 0 && int64(bounds.Dx())*int64(bounds.Dy()) > max {
+		err = d.wrapError(&LimitError{Limit: "tiles", Value: int64(bounds.Dx()) * int64(bounds.Dy()), Max: max})
+		return
+	}
+	grid = NewDataTileGrid(bounds.Dx(), bounds.Dy())
+	for i := 0; i < len(d.Chunks); i++ {
+		var (
+			c    = d.Chunks[i]
+			gids []uint32
+		)
+		if gids, err = d.chunkGids(ctx, c); err != nil {
+			return DataTileGrid{}, err
+		}
+		for j := 0; j < len(gids); j++ {
+			var (
+				x = int(c.X) - bounds.Min.X + j%int(c.Width)
+				y = int(c.Y) - bounds.Min.Y + j/int(c.Width)
+			)
+			grid.Tiles[x][y] = gridTile(gids[j])
+		}
+	}
+	return
+}
+
+// Stores grid in chunks the size of the first chunk of the data, with
+// the top left tile of the grid at the top left of its chunk bounds.
+func (d *Data) setChunkGrid(grid DataTileGrid) error {
+	var width, height = DEFAULT_CHUNK_SIZE, DEFAULT_CHUNK_SIZE
+	if len(d.Chunks) > 0 {
+		width, height = int(d.Chunks[0].Width), int(d.Chunks[0].Height)
+	}
+	return d.setChunks(grid, d.ChunkBounds().Min, width, height)
+}
+
+// Stores grid in chunks of size width by height, with the top left tile
+// of the grid at origin. Chunks with no tiles are left out.
+func (d *Data) setChunks(grid DataTileGrid, origin image.Point, width, height int) (err error) {
+	var chunks []*Chunk
+	if width <= 0 || height <= 0 {
+		return d.wrapError(fmt.Errorf("Invalid chunk size %vx%v", width, height))
+	}
+	d.cached = nil
+	d.modified = true
+	for cy := 0; cy < grid.Height; cy += height {
+		for cx := 0; cx < grid.Width; cx += width {
+			var (
+				part  = NewDataTileGrid(minInt(width, grid.Width-cx), minInt(height, grid.Height-cy))
+				empty = true
+				data  = &Data{Encoding: d.Encoding, Compression: d.Compression, level: d.level}
+			)
+			for x := 0; x < part.Width; x++ {
+				for y := 0; y < part.Height; y++ {
+					part.Tiles[x][y] = grid.Tiles[cx+x][cy+y]
+					empty = empty && part.Tiles[x][y].GID() == 0
+				}
+			}
+			if empty {
+				continue
+			}
+			if err = data.SetTileGrid(part); err != nil {
+				return
+			}
+			// Unregistered encodings and compressions are replaced
+			// when writing, for all chunks alike.
+			d.Encoding, d.Compression = data.Encoding, data.Compression
+			chunks = append(chunks, &Chunk{
+				X:           int32(origin.X + cx),
+				Y:           int32(origin.Y + cy),
+				Width:       int32(part.Width),
+				Height:      int32(part.Height),
+				RawTiles:    data.RawTiles,
+				RawContents: data.RawContents,
+			})
+		}
+	}
+	d.Chunks = chunks
+	d.RawTiles = nil
+	d.RawContents = ""
+	return
+}
+
+// Returns the size of the chunks the layers of infinite maps are
+// written in, as given by the map's editor settings. Defaults to
+// DEFAULT_CHUNK_SIZE.
+func (m *Map) ChunkSize() (width, height int32) {
+	width, height = DEFAULT_CHUNK_SIZE, DEFAULT_CHUNK_SIZE
+	if s := m.EditorSettings; s != nil && s.ChunkSize != nil {
+		if s.ChunkSize.Width > 0 {
+			width = s.ChunkSize.Width
+		}
+		if s.ChunkSize.Height > 0 {
+			height = s.ChunkSize.Height
+		}
+	}
+	return
+}
+
+// Sets the size of the chunks the layers of infinite maps are written
+// in, keeping it in the map's editor settings as Tiled does.
+func (m *Map) SetChunkSize(width, height int32) {
+	if m.EditorSettings == nil {
+		m.EditorSettings = &EditorSettings{}
+	}
+	m.EditorSettings.ChunkSize = &ChunkSize{Width: width, Height: height}
+}
+
+// Returns whether every chunk of the data is width by height tiles and
+// aligned to a multiple of that size.
+func (d *Data) chunksAligned(width, height int) bool {
+	for i := 0; i < len(d.Chunks); i++ {
+		var c = d.Chunks[i]
+		if int(c.Width) != width || int(c.Height) != height || int(c.X)%width != 0 || int(c.Y)%height != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits the tiles of the map's layers into chunks of the map's
+// ChunkSize if the map is infinite, merging or splitting the chunks the
+// layers have so that all chunks are of that size and aligned to a
+// multiple of it, as Tiled expects. Returns an error for chunked data on
+// maps that are not infinite, which would lose the tiles outside the map.
+func (m *Map) chunkLayers() (err error) {
+	var w, h = m.ChunkSize()
+	var width, height = int(w), int(h)
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			l    = m.Layers[i]
+			grid DataTileGrid
+		)
+		if !m.Infinite && len(l.Data.Chunks) > 0 {
+			return m.layerError(l, fmt.Errorf("Data has chunks but the map is not infinite"))
+		}
+		if !m.Infinite || (l.Data.chunked() && l.Data.chunksAligned(width, height)) {
+			l.Data.infinite = m.Infinite
+			continue
+		}
+		if l.Data.chunked() {
+			err = l.Data.alignChunks(width, height)
+		} else if grid, err = l.GetGrid(); err == nil {
+			l.Data.infinite = true
+			err = l.Data.setAlignedChunks(grid, image.Point{}, width, height)
+		}
+		if err != nil {
+			return m.layerError(l, err)
+		}
+	}
+	return
+}
+
+// Stores the tiles of the chunked data in chunks of width by height
+// tiles aligned to a multiple of that size, leaving out empty chunks.
+func (d *Data) alignChunks(width, height int) (err error) {
+	var grid DataTileGrid
+	if grid, err = d.chunkGrid(context.Background()); err != nil {
+		return
+	}
+	return d.setAlignedChunks(grid, d.ChunkBounds().Min, width, height)
+}
+
+// Stores grid, with its top left tile at origin, in chunks of width by
+// height tiles aligned to a multiple of that size, padding the grid
+// with empty tiles as needed.
+func (d *Data) setAlignedChunks(grid DataTileGrid, origin image.Point, width, height int) error {
+	if width <= 0 || height <= 0 {
+		return d.wrapError(fmt.Errorf("Invalid chunk size %vx%v", width, height))
+	}
+	var (
+		aligned = image.Rect(
+			floorDiv(origin.X, width)*width, floorDiv(origin.Y, height)*height,
+			-floorDiv(-(origin.X+grid.Width), width)*width, -floorDiv(-(origin.Y+grid.Height), height)*height)
+		padded = NewDataTileGrid(aligned.Dx(), aligned.Dy())
+		dx, dy = origin.X - aligned.Min.X, origin.Y - aligned.Min.Y
+	)
+	for x := 0; x < grid.Width; x++ {
+		copy(padded.Tiles[dx+x][dy:], grid.Tiles[x])
+	}
+	return d.setChunks(padded, aligned.Min, width, height)
+}
+
+// Re-partitions the chunks of the layers of an infinite map into chunks
+// of chunkW by chunkH tiles, aligned to a multiple of that size, and
+// leaves out chunks without tiles. This cleans up the fragmented chunks
+// maps accumulate when edited heavily. The size is also stored as the
+// map's ChunkSize, which Serialize writes the layers in.
+func (m *Map) NormalizeChunks(chunkW, chunkH int32) (err error) {
+	if chunkW <= 0 || chunkH <= 0 {
+		return fmt.Errorf("Invalid chunk size %vx%v", chunkW, chunkH)
+	}
+	if !m.Infinite {
+		return fmt.Errorf("Map is not infinite")
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var l = m.Layers[i]
+		if !l.Data.chunked() {
+			continue
+		}
+		if err = l.Data.alignChunks(int(chunkW), int(chunkH)); err != nil {
+			return m.layerError(l, err)
+		}
+		l.occupancy = nil
+	}
+	m.SetChunkSize(chunkW, chunkH)
+	return
+}
+
+// Returns the chunk containing the tile at x, y, or nil if there is none.
+func (d *Data) chunkAt(x, y int) *Chunk {
+	for i := 0; i < len(d.Chunks); i++ {
+		var c = d.Chunks[i]
+		if image.Pt(x, y).In(image.Rect(int(c.X), int(c.Y), int(c.X+c.Width), int(c.Y+c.Height))) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Returns the tile at x, y of the layer. On infinite maps x and y are
+// in the coordinates of the chunks, can be negative, and only the chunk
+// containing the tile is decoded. Tiles outside all chunks are empty.
+// On other maps the whole layer is decoded, so use GetGrid to read many
+// tiles, and positions outside the layer are an error.
+func (l *Layer) TileAt(x, y int) (t DataTileGridTile, err error) {
+	var grid DataTileGrid
+	if !l.Data.chunked() {
+		if grid, err = l.GetGrid(); err != nil {
+			return
+		}
+		if x < 0 || y < 0 || x >= grid.Width || y >= grid.Height {
+			err = fmt.Errorf("Tile %v,%v outside layer of size %vx%v", x, y, grid.Width, grid.Height)
+			return
+		}
+		return grid.Tiles[x][y], nil
+	}
+	var (
+		c    = l.Data.chunkAt(x, y)
+		gids []uint32
+	)
+	if c == nil {
+		return
+	}
+	if gids, err = l.Data.chunkGids(context.Background(), c); err != nil {
+		return
+	}
+	return gridTile(gids[(y-int(c.Y))*int(c.Width)+x-int(c.X)]), nil
+}
+
+// Sets the tile at x, y of the layer, with positions as for TileAt. On
+// infinite maps, only the chunk containing the tile is encoded again,
+// and setting a tile outside all chunks adds a chunk for it, aligned to
+// and of the size of the existing chunks.
+func (l *Layer) SetTileAt(x, y int, t DataTileGridTile) (err error) {
+	var grid DataTileGrid
+	if !l.Data.chunked() {
+		if grid, err = l.GetGrid(); err != nil {
+			return
+		}
+		if x < 0 || y < 0 || x >= grid.Width || y >= grid.Height {
+			return fmt.Errorf("Tile %v,%v outside layer of size %vx%v", x, y, grid.Width, grid.Height)
+		}
+		grid.Tiles[x][y] = t
+		return l.SetGrid(grid)
+	}
+	var (
+		d    = l.Data
+		c    = d.chunkAt(x, y)
+		gids []uint32
+	)
+	l.occupancy = nil
+	if c == nil {
+		if t.GID() == 0 {
+			return
+		}
+		var width, height = DEFAULT_CHUNK_SIZE, DEFAULT_CHUNK_SIZE
+		if len(d.Chunks) > 0 {
+			width, height = int(d.Chunks[0].Width), int(d.Chunks[0].Height)
+		}
+		c = &Chunk{
+			X:      int32(floorDiv(x, width) * width),
+			Y:      int32(floorDiv(y, height) * height),
+			Width:  int32(width),
+			Height: int32(height),
+		}
+		gids = make([]uint32, width*height)
+		d.Chunks = append(d.Chunks, c)
+	} else if gids, err = d.chunkGids(context.Background(), c); err != nil {
+		return
+	}
+	gids[(y-int(c.Y))*int(c.Width)+x-int(c.X)] = uint32(t.GID())
+	d.modified = true
+	var data = d.chunkData(c)
+	if err = data.SetGids(int(c.Width), int(c.Height), gids); err != nil {
+		return
+	}
+	c.RawTiles, c.RawContents = data.RawTiles, data.RawContents
+	d.Encoding, d.Compression = data.Encoding, data.Compression
+	return
+}
+
+// Decodes the gids of chunk c of the data.
+func (d *Data) chunkGids(ctx context.Context, c *Chunk) (gids []uint32, err error) {
+	if err = c.validate(); err != nil {
+		return nil, d.wrapError(err)
+	}
+	if gids, err = d.chunkData(c).GidsContext(ctx); err != nil {
+		return
+	}
+	if len(gids) != int(c.Width*c.Height) {
+		err = d.wrapError(fmt.Errorf("Chunk %v,%v: Tile length %v didn't match width x height (%v,%v)",
+			c.X, c.Y, len(gids), c.Width, c.Height))
+	}
+	return
+}
+
+// Divides a by b, rounding towards negative infinity.
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
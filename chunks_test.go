@@ -0,0 +1,297 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+const TEST_INFINITE_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.2" orientation="orthogonal" width="4" height="4" tilewidth="16" tileheight="16" infinite="1">
+ <editorsettings>
+  <chunksize width="2" height="2"/>
+ </editorsettings>
+ <tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16" tilecount="4"/>
+ <layer name="ground" width="4" height="4">
+  <data encoding="csv">
+   <chunk x="-2" y="0" width="2" height="2">1,2,
+3,4</chunk>
+   <chunk x="0" y="2" width="2" height="2">0,1,
+0,0</chunk>
+  </data>
+ </layer>
+</map>
+`
+
+func TestInfiniteMap(t *testing.T) {
+	var (
+		m     *Map
+		grid  DataTileGrid
+		tiles []*Tile
+		out   string
+		count int
+		err   error
+	)
+	if m, err = ParseMapString(TEST_INFINITE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var layer = m.Layers[0]
+	if !m.Infinite || len(layer.Data.Chunks) != 2 {
+		t.Fatalf("Chunks not parsed: %v %v", m.Infinite, layer.Data.Chunks)
+	}
+	if b := layer.Data.ChunkBounds(); b != image.Rect(-2, 0, 2, 4) {
+		t.Errorf("Invalid chunk bounds: %v", b)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for _, c := range []struct {
+		x, y int
+		gid  uint32
+	}{{0, 0, 1}, {1, 0, 2}, {0, 1, 3}, {1, 1, 4}, {3, 2, 1}, {2, 0, 0}, {0, 3, 0}} {
+		if gid := uint32(grid.Tiles[c.x][c.y].GID()); gid != c.gid {
+			t.Errorf("Tile %v,%v was %v, expected %v", c.x, c.y, gid, c.gid)
+		}
+	}
+	err = layer.EachTile(func(x, y int, tile DataTileGridTile) error {
+		if tile != grid.Tiles[x][y] {
+			t.Errorf("Streamed tile %v,%v was %v, expected %v", x, y, tile, grid.Tiles[x][y])
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 8 {
+		t.Errorf("Streamed %v tiles: %v", count, err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if len(tiles) != 16 || tiles[0] == nil || tiles[0].TileBounds.X != -32 {
+		t.Errorf("Invalid tiles: %v", tiles)
+	}
+	grid.Tiles[3][2] = DataTileGridTile{}
+	grid.Tiles[2][0] = gridTile(2)
+	if err = layer.SetGrid(grid); err != nil {
+		t.Fatalf("Could not set grid: %v", err)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `infinite="1"`) || !strings.Contains(out, `<chunk x="0" y="0" width="2" height="2">`) ||
+		strings.Contains(out, `y="2"`) {
+		t.Errorf("Chunks not serialized: %v", out)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if b := m.Layers[0].Data.ChunkBounds(); b != image.Rect(-2, 0, 2, 2) {
+		t.Errorf("Invalid chunk bounds after serializing: %v", b)
+	}
+	m.Infinite = false
+	if _, err = m.Serialize(); err == nil {
+		t.Errorf("Expected error for chunks on a finite map")
+	}
+}
+
+func TestMakeMapInfinite(t *testing.T) {
+	var (
+		m    *Map
+		grid DataTileGrid
+		out  string
+		err  error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var before, _ = m.Layers[0].GetGrid()
+	m.Infinite = true
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if len(m.Layers[0].Data.Chunks) == 0 {
+		t.Fatalf("Layer data not chunked: %v", out)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	var bounds = m.Layers[0].Data.ChunkBounds()
+	for x := 0; x < before.Width; x++ {
+		for y := 0; y < before.Height; y++ {
+			var (
+				want = before.Tiles[x][y]
+				got  DataTileGridTile
+			)
+			if p := image.Pt(x, y); p.In(bounds) {
+				got = grid.Tiles[x-bounds.Min.X][y-bounds.Min.Y]
+			}
+			if got != want {
+				t.Fatalf("Tile %v,%v was %v, expected %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestTileAt(t *testing.T) {
+	var (
+		m    *Map
+		tile DataTileGridTile
+		err  error
+	)
+	if m, err = ParseMapString(TEST_INFINITE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var layer = m.Layers[0]
+	for _, c := range []struct {
+		x, y int
+		gid  uint32
+	}{{-2, 0, 1}, {-1, 1, 4}, {1, 2, 1}, {0, 2, 0}, {5, -3, 0}} {
+		if tile, err = layer.TileAt(c.x, c.y); err != nil || uint32(tile.GID()) != c.gid {
+			t.Errorf("Tile %v,%v was %v, expected %v: %v", c.x, c.y, tile.GID(), c.gid, err)
+		}
+	}
+	if err = layer.SetTileAt(-1, 1, gridTile(3)); err != nil {
+		t.Fatalf("Could not set tile: %v", err)
+	}
+	if err = layer.SetTileAt(5, -3, gridTile(2|FLIPPED_H_FLAG)); err != nil {
+		t.Fatalf("Could not set tile: %v", err)
+	}
+	if len(layer.Data.Chunks) != 3 || layer.Data.ChunkBounds() != image.Rect(-2, -4, 6, 4) {
+		t.Errorf("Chunk not added: %v", layer.Data.ChunkBounds())
+	}
+	if tile, _ = layer.TileAt(-1, 1); tile.GID() != 3 {
+		t.Errorf("Tile not set: %v", tile)
+	}
+	if tile, _ = layer.TileAt(5, -3); !tile.FlipX || tile.Id != 2 {
+		t.Errorf("Tile not set: %v", tile)
+	}
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	layer = m.Layers[0]
+	if err = layer.SetTileAt(3, 2, gridTile(5)); err != nil {
+		t.Fatalf("Could not set tile: %v", err)
+	}
+	if tile, err = layer.TileAt(3, 2); err != nil || tile.GID() != 5 {
+		t.Errorf("Tile not set: %v %v", tile, err)
+	}
+	if _, err = layer.TileAt(-1, 0); err == nil {
+		t.Errorf("Expected error outside finite layer")
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	var (
+		m    *Map
+		tile DataTileGridTile
+		out  string
+		err  error
+	)
+	if m, err = ParseMapString(TEST_INFINITE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if w, h := m.ChunkSize(); w != 2 || h != 2 {
+		t.Errorf("Invalid chunk size %vx%v", w, h)
+	}
+	m.SetChunkSize(4, 4)
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	var chunks = m.Layers[0].Data.Chunks
+	if len(chunks) != 2 || chunks[0].X != -4 || chunks[0].Y != 0 || chunks[0].Width != 4 || chunks[0].Height != 4 ||
+		chunks[1].X != 0 || chunks[1].Y != 0 || chunks[1].Width != 4 || chunks[1].Height != 4 {
+		t.Fatalf("Chunks not merged: %v", out)
+	}
+	for _, c := range []struct {
+		x, y int
+		gid  uint32
+	}{{-2, 0, 1}, {-1, 0, 2}, {-2, 1, 3}, {-1, 1, 4}, {1, 2, 1}, {0, 0, 0}} {
+		if tile, err = m.Layers[0].TileAt(c.x, c.y); err != nil || uint32(tile.GID()) != c.gid {
+			t.Errorf("Tile %v,%v was %v, expected %v: %v", c.x, c.y, tile.GID(), c.gid, err)
+		}
+	}
+}
+
+func TestInvalidChunkSize(t *testing.T) {
+	var (
+		m   *Map
+		err error
+	)
+	for _, size := range []string{`width="-1" height="-1"`, `width="0" height="2"`} {
+		var data = strings.Replace(TEST_INFINITE_MAP, `x="-2" y="0" width="2" height="2"`, `x="-2" y="0" `+size, 1)
+		if _, err = ParseMapString(data); err == nil {
+			t.Errorf("Expected error for chunk of size %v", size)
+		}
+	}
+	if m, err = ParseMapString(TEST_INFINITE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Layers[0].Data.Chunks[0].Width = 0
+	if _, err = m.Layers[0].GetGrid(); err == nil {
+		t.Errorf("Expected error decoding chunk of width 0")
+	}
+	if err = m.Layers[0].SetGrid(NewDataTileGrid(2, 2)); err == nil {
+		t.Errorf("Expected error storing chunks of width 0")
+	}
+}
+
+func TestNormalizeChunks(t *testing.T) {
+	var (
+		m    *Map
+		data = strings.Replace(TEST_INFINITE_MAP, "</data>", `<chunk x="2" y="0" width="2" height="2">0,0,0,0</chunk>
+  </data>`, 1)
+		tile DataTileGridTile
+		err  error
+	)
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.NormalizeChunks(2, 2); err != nil {
+		t.Fatalf("Could not normalize: %v", err)
+	}
+	if len(m.Layers[0].Data.Chunks) != 2 {
+		t.Errorf("Empty chunk not dropped: %v", len(m.Layers[0].Data.Chunks))
+	}
+	if err = m.NormalizeChunks(1, 1); err != nil {
+		t.Fatalf("Could not normalize: %v", err)
+	}
+	if len(m.Layers[0].Data.Chunks) != 5 {
+		t.Errorf("Wrong number of chunks: %v", len(m.Layers[0].Data.Chunks))
+	}
+	if w, h := m.ChunkSize(); w != 1 || h != 1 {
+		t.Errorf("Chunk size not stored: %vx%v", w, h)
+	}
+	if tile, err = m.Layers[0].TileAt(1, 2); err != nil || tile.Id != 1 {
+		t.Errorf("Wrong tile after normalizing: %v, %v", tile, err)
+	}
+	if err = m.NormalizeChunks(0, 2); err == nil {
+		t.Errorf("Expected error for invalid chunk size")
+	}
+	if m, err = ParseMapString(TEST_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.NormalizeChunks(2, 2); err == nil {
+		t.Errorf("Expected error for finite map")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tmxmerge combines several maps into one, for building a single
+// runtime map out of modular pieces authored separately.
+//
+// Usage:
+//
+//	tmxmerge -o out.tmx [-world level.world] [map.tmx[@x,y] ...]
+//
+// Maps given as arguments are placed at the position x,y in tiles, or at
+// 0,0 if no position is given. Maps of a Tiled world file are placed at
+// the pixel position recorded in the file, which must fall on the tile
+// grid. Where maps overlap, later maps win. External tilesets are
+// embedded in the output, and relative paths to images are rewritten to
+// be relative to the output file.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kurrik/tmxgo"
+)
+
+// The parts of a Tiled world file used here.
+type world struct {
+	Maps []struct {
+		FileName string `json:"fileName"`
+		X        int32  `json:"x"`
+		Y        int32  `json:"y"`
+	} `json:"maps"`
+}
+
+func main() {
+	var (
+		output    = flag.String("o", "", "path of the merged map, - for stdout")
+		worldPath = flag.String("world", "", "Tiled world file listing maps and their positions")
+		parts     []tmxgo.MapPart
+		merged    *tmxgo.Map
+		out       string
+		err       error
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v -o out.tmx [-world file.world] [map.tmx[@x,y] ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *output == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var outDir = "."
+	if *output != "-" {
+		outDir = filepath.Dir(*output)
+	}
+	if *worldPath != "" {
+		if parts, err = loadWorld(*worldPath, outDir); err != nil {
+			fail(err)
+		}
+	}
+	for _, arg := range flag.Args() {
+		var part tmxgo.MapPart
+		if part, err = loadPart(arg, outDir); err != nil {
+			fail(err)
+		}
+		parts = append(parts, part)
+	}
+	if merged, err = tmxgo.StitchMaps(parts); err != nil {
+		fail(err)
+	}
+	if out, err = merged.Serialize(); err != nil {
+		fail(err)
+	}
+	if *output == "-" {
+		_, err = os.Stdout.WriteString(out)
+	} else {
+		err = ioutil.WriteFile(*output, []byte(out), 0644)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "tmxmerge: %v\n", err)
+	os.Exit(1)
+}
+
+// Loads the map given by an argument of the form path[@x,y].
+func loadPart(arg, outDir string) (part tmxgo.MapPart, err error) {
+	var (
+		path = arg
+		x, y int64
+	)
+	if i := strings.LastIndex(arg, "@"); i >= 0 {
+		var pos = strings.Split(arg[i+1:], ",")
+		path = arg[:i]
+		if len(pos) != 2 {
+			err = fmt.Errorf("Invalid position in %v", arg)
+			return
+		}
+		if x, err = strconv.ParseInt(pos[0], 10, 32); err != nil {
+			return
+		}
+		if y, err = strconv.ParseInt(pos[1], 10, 32); err != nil {
+			return
+		}
+	}
+	if part.Map, err = loadMap(path, outDir); err != nil {
+		return
+	}
+	part.X, part.Y = int32(x), int32(y)
+	return
+}
+
+// Loads the maps of the world file at path.
+func loadWorld(path, outDir string) (parts []tmxgo.MapPart, err error) {
+	var (
+		data []byte
+		w    world
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &w); err != nil {
+		err = fmt.Errorf("%v: %v", path, err)
+		return
+	}
+	for i := 0; i < len(w.Maps); i++ {
+		var (
+			entry = w.Maps[i]
+			m     *tmxgo.Map
+		)
+		if m, err = loadMap(filepath.Join(filepath.Dir(path), entry.FileName), outDir); err != nil {
+			return
+		}
+		if m.TileWidth <= 0 || m.TileHeight <= 0 {
+			err = fmt.Errorf("Invalid tile size %vx%v of %v", m.TileWidth, m.TileHeight, entry.FileName)
+			return
+		}
+		if entry.X%m.TileWidth != 0 || entry.Y%m.TileHeight != 0 {
+			err = fmt.Errorf("Position %v,%v of %v is not on the tile grid", entry.X, entry.Y, entry.FileName)
+			return
+		}
+		parts = append(parts, tmxgo.MapPart{Map: m, X: entry.X / m.TileWidth, Y: entry.Y / m.TileHeight})
+	}
+	return
+}
+
+// Parses the map at path, embeds its external tilesets, whose sizes are
+// needed to merge them, and makes the paths it refers to relative to
+// outDir.
+func loadMap(path, outDir string) (m *tmxgo.Map, err error) {
+	if m, err = tmxgo.ParseMapFile(path); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		if m.Tilesets[i].Source == "" {
+			continue
+		}
+		if m.Tilesets[i], err = loadTileset(m, m.Tilesets[i]); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	if outDir, err = filepath.Abs(outDir); err != nil {
+		return
+	}
+	var rebase = func(p *string) {
+		if *p == "" || filepath.IsAbs(filepath.FromSlash(*p)) {
+			return
+		}
+		var abs, e = filepath.Abs(m.ResolvePath(*p))
+		if e != nil {
+			return
+		}
+		if rel, e := filepath.Rel(outDir, abs); e == nil {
+			*p = filepath.ToSlash(rel)
+		}
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		var ts = m.Tilesets[i]
+		rebase(&ts.Source)
+		if ts.Source != "" {
+			continue
+		}
+		if ts.Image != nil {
+			rebase(&ts.Image.Source)
+		}
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			if ts.TilesetTile[j].Image != nil {
+				rebase(&ts.TilesetTile[j].Image.Source)
+			}
+		}
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		if m.ImageLayers[i].Image != nil {
+			rebase(&m.ImageLayers[i].Image.Source)
+		}
+	}
+	return
+}
+
+// Reads the external tileset ts of m, with the image sources in it made
+// relative to the map like those of embedded tilesets.
+func loadTileset(m *tmxgo.Map, ts *tmxgo.Tileset) (loaded *tmxgo.Tileset, err error) {
+	var (
+		file = m.ResolvePath(ts.Source)
+		dir  = filepath.Dir(filepath.FromSlash(ts.Source))
+	)
+	if loaded, err = tmxgo.NewLoader(os.DirFS(filepath.Dir(file))).ParseTilesetFile(filepath.Base(file)); err != nil {
+		return
+	}
+	loaded.FirstGid = ts.FirstGid
+	var relocate = func(img *tmxgo.Image) {
+		if img == nil || img.Source == "" || filepath.IsAbs(filepath.FromSlash(img.Source)) {
+			return
+		}
+		img.Source = filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(img.Source)))
+	}
+	relocate(loaded.Image)
+	for i := 0; i < len(loaded.TilesetTile); i++ {
+		relocate(loaded.TilesetTile[i].Image)
+	}
+	return
+}
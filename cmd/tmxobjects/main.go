@@ -0,0 +1,61 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tmxobjects reports the object types used by a set of maps,
+// with the properties objects of each type set and the values they
+// take, as a starting point for documenting them.
+//
+// Usage:
+//
+//	tmxobjects map.tmx ...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kurrik/tmxgo"
+)
+
+func main() {
+	var (
+		maps []*tmxgo.Map
+		err  error
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v map.tmx ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, path := range flag.Args() {
+		var m *tmxgo.Map
+		if m, err = tmxgo.ParseMapFile(path); err != nil {
+			fail(fmt.Errorf("%v: %v", path, err))
+		}
+		maps = append(maps, m)
+	}
+	if err = tmxgo.WriteObjectReport(os.Stdout, tmxgo.SurveyObjects(maps...)); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "tmxobjects: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,257 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Drops tilesets no tile of the map refers to and renumbers the
+// remaining ones so their gids are contiguous, rewriting layers and
+// tile objects accordingly.
+//
+// If repack is set, tilesets with an image are additionally rebuilt to
+// contain only the tiles in use, packed into a new image. The new images
+// are returned keyed by their tileset and must be saved by the caller to
+// the path given by the tileset's Image.Source, which is the original
+// source with a ".compact" suffix added before the extension.
+func (m *Map) CompactGids(repack bool) (images map[*Tileset]*image.RGBA, err error) {
+	var (
+		tilesets = append([]*Tileset{}, m.Tilesets...)
+		usage    []*TilesetUsage
+		used     = map[*Tileset][]uint32{}
+		compact  []*Tileset
+		targets  = map[*Tileset]*Tileset{}
+		indexes  = map[*Tileset]map[uint32]uint32{}
+		next     = uint32(1)
+	)
+	images = map[*Tileset]*image.RGBA{}
+	if len(tilesets) == 0 {
+		return
+	}
+	if usage, err = m.TilesetUsage(); err != nil {
+		return
+	}
+	for i := 0; i < len(usage); i++ {
+		used[usage[i].Tileset] = usage[i].Tiles
+	}
+	sort.Sort(byFirstGid(tilesets))
+	for i := 0; i < len(tilesets); i++ {
+		var (
+			ts     = tilesets[i]
+			locals = used[ts]
+			copied = *ts
+		)
+		if len(locals) == 0 {
+			continue
+		}
+		copied.FirstGid = next
+		if repack && ts.Image != nil {
+			var packed *image.RGBA
+			if packed, err = m.repackTileset(&copied, locals); err != nil {
+				return
+			}
+			images[&copied] = packed
+			indexes[ts] = map[uint32]uint32{}
+			for j := 0; j < len(locals); j++ {
+				indexes[ts][locals[j]] = uint32(j)
+			}
+			next += uint32(len(locals))
+		} else {
+			// External tilesets which were not loaded have no known
+			// size, so keep at least the gids used of them.
+			var count = ts.numTiles()
+			for j := 0; j < len(locals); j++ {
+				if locals[j] >= count {
+					count = locals[j] + 1
+				}
+			}
+			next += count
+		}
+		targets[ts] = &copied
+		compact = append(compact, &copied)
+	}
+	m.Tilesets = compact
+	err = m.eachGid(func(gid uint32) uint32 {
+		var (
+			flags = gid & CLEAR_FLIP
+			id    = gid &^ CLEAR_FLIP
+		)
+		if id == 0 {
+			return gid
+		}
+		var (
+			src   = tilesetForGid(tilesets, id)
+			local = id - src.FirstGid
+		)
+		if indexes[src] != nil {
+			local = indexes[src][local]
+		}
+		return (targets[src].FirstGid + local) | flags
+	})
+	return
+}
+
+// Replaces the image of ts with one containing only the tiles at locals,
+// in order, and renumbers the tile metadata of ts to match.
+func (m *Map) repackTileset(ts *Tileset, locals []uint32) (packed *image.RGBA, err error) {
+	var (
+		src     image.Image
+		cols    = int32(math.Ceil(math.Sqrt(float64(len(locals)))))
+		rows    = (int32(len(locals)) + cols - 1) / cols
+		renamed = map[uint32]uint32{}
+		tiles   = []TilesetTile{}
+		ext     = path.Ext(ts.Image.Source)
+		img     = *ts.Image
+	)
+	if src, err = m.LoadImage(ts.Image); err != nil {
+		return
+	}
+	packed = image.NewRGBA(image.Rect(0, 0, int(cols*ts.TileWidth), int(rows*ts.TileHeight)))
+	for i := 0; i < len(locals); i++ {
+		var (
+			from = ts.tileRect(locals[i]).Add(src.Bounds().Min)
+			x    = int(int32(i)%cols) * int(ts.TileWidth)
+			y    = int(int32(i)/cols) * int(ts.TileHeight)
+		)
+		draw.Draw(packed, image.Rect(x, y, x+int(ts.TileWidth), y+int(ts.TileHeight)), src, from.Min, draw.Src)
+		renamed[locals[i]] = uint32(i)
+	}
+	for i := 0; i < len(ts.TilesetTile); i++ {
+		if id, ok := renamed[ts.TilesetTile[i].Id]; ok {
+			var tile = ts.TilesetTile[i]
+			tile.Id = id
+			tiles = append(tiles, tile)
+		}
+	}
+	ts.TilesetTile = tiles
+	ts.WangSets = repackWangSets(ts.WangSets, renamed)
+	ts.Spacing = 0
+	ts.Margin = 0
+	ts.TileCount = int32(len(locals))
+	ts.Columns = cols
+	img.Source = strings.TrimSuffix(img.Source, ext) + ".compact" + ext
+	img.Width = int32(packed.Bounds().Dx())
+	img.Height = int32(packed.Bounds().Dy())
+	ts.Image = &img
+	return
+}
+
+func repackWangSets(sets []*WangSet, renamed map[uint32]uint32) (out []*WangSet) {
+	for i := 0; i < len(sets); i++ {
+		var set = *sets[i]
+		set.Tiles = nil
+		for j := 0; j < len(sets[i].Tiles); j++ {
+			if id, ok := renamed[sets[i].Tiles[j].TileId]; ok {
+				var tile = *sets[i].Tiles[j]
+				tile.TileId = id
+				set.Tiles = append(set.Tiles, &tile)
+			}
+		}
+		out = append(out, &set)
+	}
+	return
+}
+
+// Replaces every use of the tile with local id oldID in the tileset named
+// oldTileset by the tile with local id newID in the tileset named
+// newTileset, across all layers and tile objects. Flip flags are kept.
+// Returns the number of tiles replaced.
+func (m *Map) ReplaceTile(oldID uint32, oldTileset string, newID uint32, newTileset string) (replaced int, err error) {
+	var from, to *Tileset
+	if from, err = m.TilesetByName(oldTileset); err != nil {
+		return
+	}
+	if to, err = m.TilesetByName(newTileset); err != nil {
+		return
+	}
+	if count := from.numTiles(); count > 0 && oldID >= count {
+		err = m.tilesetError(from, fmt.Errorf("Tile %v out of range", oldID))
+		return
+	}
+	if count := to.numTiles(); count > 0 && newID >= count {
+		err = m.tilesetError(to, fmt.Errorf("Tile %v out of range", newID))
+		return
+	}
+	var (
+		oldGid = from.FirstGid + oldID
+		newGid = to.FirstGid + newID
+	)
+	err = m.eachGid(func(gid uint32) uint32 {
+		if gid&^CLEAR_FLIP != oldGid {
+			return gid
+		}
+		replaced++
+		return newGid | gid&CLEAR_FLIP
+	})
+	return
+}
+
+// Clears flip flags which have no meaning across the map's layers and
+// tile objects: any flag set on an empty tile, and the 120 degree
+// rotation on maps which aren't hexagonal. Tiled ignores these flags, but
+// they make gids compare unequal and may confuse other tools. Returns the
+// number of gids changed.
+func (m *Map) ClearInvalidFlips() (cleared int, err error) {
+	var hexagonal = m.Orientation == "hexagonal"
+	err = m.eachGid(func(gid uint32) uint32 {
+		var fixed = gid
+		if gid&^CLEAR_FLIP == 0 {
+			fixed = 0
+		} else if !hexagonal {
+			fixed &^= ROTATED_HEX_120_FLAG
+		}
+		if fixed != gid {
+			cleared++
+		}
+		return fixed
+	})
+	return
+}
+
+// Calls fn with every gid of the map's layers and tile objects,
+// including flip flags, and stores the gid it returns in its place.
+func (m *Map) eachGid(fn func(gid uint32) uint32) (err error) {
+	var grid DataTileGrid
+	for i := 0; i < len(m.Layers); i++ {
+		if grid, err = m.Layers[i].GetGrid(); err != nil {
+			return m.layerError(m.Layers[i], err)
+		}
+		for x := 0; x < grid.Width; x++ {
+			for y := 0; y < grid.Height; y++ {
+				grid.Tiles[x][y] = gridTile(fn(uint32(grid.Tiles[x][y].GID())))
+			}
+		}
+		if err = m.Layers[i].SetGrid(grid); err != nil {
+			return m.layerError(m.Layers[i], err)
+		}
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		for j := 0; j < len(m.ObjectGroups[i].Objects); j++ {
+			var o = &m.ObjectGroups[i].Objects[j]
+			if o.Gid != nil {
+				var gid = fn(*o.Gid)
+				o.Gid = &gid
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,247 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_COMPACT_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="a" tilewidth="16" tileheight="16">
+  <image source="strip.png" width="64" height="16"/>
+  <tile id="1">
+   <properties>
+    <property name="kind" value="door"/>
+   </properties>
+  </tile>
+ </tileset>
+ <tileset firstgid="5" name="b" tilewidth="16" tileheight="16">
+  <image source="unused.png" width="64" height="16"/>
+ </tileset>
+ <tileset firstgid="9" name="c" tilewidth="16" tileheight="16">
+  <image source="strip.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ground" width="2" height="1">
+  <data>
+   <tile gid="2" />
+   <tile gid="2147483658" />
+  </data>
+ </layer>
+</map>
+`
+
+// Returns a PNG strip of 16x16 tiles, where tile i has a red value of i.
+func testStripPNG(t *testing.T, tiles int) []byte {
+	var (
+		img = image.NewRGBA(image.Rect(0, 0, 16*tiles, 16))
+		buf bytes.Buffer
+	)
+	for x := 0; x < 16*tiles; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{uint8(x / 16), 0, 0, 255})
+		}
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Could not encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompactGids(t *testing.T) {
+	var (
+		m    *Map
+		grid DataTileGrid
+		err  error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = m.CompactGids(false); err != nil {
+		t.Fatalf("Could not compact: %v", err)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].Name != "c" || m.Tilesets[1].FirstGid != 5 {
+		t.Fatalf("Unused tileset not dropped: %v", m.Tilesets)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 2 || grid.Tiles[1][0].Id != 6 || !grid.Tiles[1][0].FlipX {
+		t.Errorf("Tiles not renumbered: %v", grid.Tiles)
+	}
+}
+
+func TestCompactExternalTilesets(t *testing.T) {
+	var (
+		data = `<map version="1.0" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" source="a.tsx"/>
+ <tileset firstgid="5" source="b.tsx"/>
+ <layer name="ground" width="2" height="1">
+  <data><tile gid="3"/><tile gid="6"/></data>
+ </layer>
+</map>`
+		m    *Map
+		grid DataTileGrid
+		err  error
+	)
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = m.CompactGids(true); err != nil {
+		t.Fatalf("Could not compact: %v", err)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[0].FirstGid != 1 || m.Tilesets[1].FirstGid != 4 {
+		t.Fatalf("Tilesets overlap: %v %v", m.Tilesets[0].FirstGid, m.Tilesets[1].FirstGid)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 3 || grid.Tiles[1][0].Id != 5 {
+		t.Errorf("Tiles not renumbered: %v", grid.Tiles)
+	}
+}
+
+func TestCompactGidsRepack(t *testing.T) {
+	var (
+		data = strings.Replace(TEST_COMPACT_MAP, `name="a" tilewidth="16" tileheight="16"`,
+			`name="a" tilewidth="16" tileheight="16" tilecount="4" columns="4"`, 1)
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(data)},
+			"strip.png": &fstest.MapFile{Data: testStripPNG(t, 4)},
+		})
+		m      *Map
+		images map[*Tileset]*image.RGBA
+		grid   DataTileGrid
+		out    string
+		err    error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if images, err = m.CompactGids(true); err != nil {
+		t.Fatalf("Could not compact: %v", err)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].FirstGid != 2 {
+		t.Fatalf("Tilesets not repacked: %v", m.Tilesets)
+	}
+	var ts = m.Tilesets[0]
+	if ts.Image.Source != "strip.compact.png" || ts.Image.Width != 16 {
+		t.Errorf("Invalid image: %v", ts.Image)
+	}
+	if len(ts.TilesetTile) != 1 || ts.TilesetTile[0].Id != 0 {
+		t.Errorf("Tile metadata not renumbered: %v", ts.TilesetTile)
+	}
+	if r, _, _, _ := images[ts].At(0, 0).RGBA(); r>>8 != 1 {
+		t.Errorf("Wrong tile copied: %v", r>>8)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 1 || grid.Tiles[1][0].Id != 2 || !grid.Tiles[1][0].FlipX {
+		t.Errorf("Tiles not renumbered: %v", grid.Tiles)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if ts = m.Tilesets[0]; ts.TileCount != 1 || ts.Columns != 1 {
+		t.Errorf("Tile count and columns not updated: %v %v", ts.TileCount, ts.Columns)
+	}
+	if errs := m.ValidateTilesets(); len(errs) != 0 {
+		t.Errorf("Repacked tileset invalid: %v", errs)
+	}
+}
+
+func TestReplaceTile(t *testing.T) {
+	var (
+		m        *Map
+		grid     DataTileGrid
+		replaced int
+		err      error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = m.ReplaceTile(1, "c", 4, "a"); err == nil {
+		t.Errorf("Expected error for tile out of range")
+	}
+	if _, err = m.ReplaceTile(4, "c", 3, "a"); err == nil {
+		t.Errorf("Expected error for old tile out of range")
+	}
+	if replaced, err = m.ReplaceTile(1, "c", 3, "a"); err != nil {
+		t.Fatalf("Could not replace: %v", err)
+	}
+	if replaced != 1 {
+		t.Errorf("Invalid replacement count: %v", replaced)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 2 || grid.Tiles[1][0].Id != 4 || !grid.Tiles[1][0].FlipX {
+		t.Errorf("Tile not replaced: %v", grid.Tiles)
+	}
+}
+
+const TEST_INVALID_FLIPS_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="3" height="1" tilewidth="16" tileheight="16">
+ <layer name="ground" width="3" height="1">
+  <data encoding="csv">2147483648,268435458,2147483651</data>
+ </layer>
+ <objectgroup name="items">
+  <object id="1" gid="1073741824" x="0" y="0"/>
+ </objectgroup>
+</map>
+`
+
+func TestClearInvalidFlips(t *testing.T) {
+	var (
+		m       *Map
+		gids    []uint32
+		cleared int
+		err     error
+	)
+	if m, err = ParseMapString(TEST_INVALID_FLIPS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if cleared, err = m.ClearInvalidFlips(); err != nil {
+		t.Fatalf("Could not clear flips: %v", err)
+	}
+	if cleared != 3 {
+		t.Errorf("Wrong number of gids cleared: %v", cleared)
+	}
+	if gids, err = m.Layers[0].Data.Gids(); err != nil {
+		t.Fatalf("Could not get gids: %v", err)
+	}
+	if gids[0] != 0 || gids[1] != 2 || gids[2] != 2147483651 {
+		t.Errorf("Wrong gids: %v", gids)
+	}
+	if *m.ObjectGroups[0].Objects[0].Gid != 0 {
+		t.Errorf("Wrong object gid: %v", *m.ObjectGroups[0].Objects[0].Gid)
+	}
+	m.Orientation = "hexagonal"
+	m.Layers[0].Data.SetGids(3, 1, []uint32{268435458, 0, 0})
+	if cleared, err = m.ClearInvalidFlips(); err != nil || cleared != 0 {
+		t.Errorf("Rotation cleared on hexagonal map: %v, %v", cleared, err)
+	}
+}
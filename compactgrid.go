@@ -0,0 +1,119 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+)
+
+// The largest global tile id a CompactGrid can hold.
+const COMPACT_GRID_MAX_ID = 0xFFFF
+
+// A tile grid for memory constrained targets, storing global tile ids in
+// 16 bits instead of the DataTileGridTile of a DataTileGrid, which takes
+// roughly twice the memory. Flip flags are kept in a side table, as few
+// tiles of a layer are usually flipped.
+type CompactGrid struct {
+	Width  int
+	Height int
+
+	// The global tile ids, without flip flags, in row major order.
+	Ids []uint16
+
+	// The flip flags of flipped tiles, by index into Ids, as the
+	// FLIPPED_H_FLAG, FLIPPED_V_FLAG, FLIPPED_D_FLAG and
+	// ROTATED_HEX_120_FLAG bits of a gid.
+	Flips map[int]uint32
+}
+
+// Creates an empty compact grid of the given dimensions.
+func NewCompactGrid(width, height int) *CompactGrid {
+	return &CompactGrid{
+		Width:  width,
+		Height: height,
+		Ids:    make([]uint16, width*height),
+		Flips:  map[int]uint32{},
+	}
+}
+
+// Returns the tile at x, y.
+func (g *CompactGrid) At(x, y int) (t DataTileGridTile) {
+	var i = y*g.Width + x
+	return gridTile(uint32(g.Ids[i]) | g.Flips[i])
+}
+
+// Stores t at x, y. Returns an error if x, y lies outside the grid or the
+// id of t is larger than COMPACT_GRID_MAX_ID.
+func (g *CompactGrid) Set(x, y int, t DataTileGridTile) (err error) {
+	var (
+		i   = y*g.Width + x
+		gid = uint32(t.GID())
+	)
+	if x < 0 || y < 0 || x >= g.Width || y >= g.Height {
+		return fmt.Errorf("Position %v,%v outside of grid (%v,%v)", x, y, g.Width, g.Height)
+	}
+	if t.Id > COMPACT_GRID_MAX_ID {
+		return fmt.Errorf("Gid %v at %v,%v exceeds the range of a compact grid", t.Id, x, y)
+	}
+	g.Ids[i] = uint16(t.Id)
+	if flips := gid & CLEAR_FLIP; flips != 0 {
+		g.Flips[i] = flips
+	} else {
+		delete(g.Flips, i)
+	}
+	return
+}
+
+// Returns the tiles of the compact grid as a DataTileGrid.
+func (g *CompactGrid) Grid() (grid DataTileGrid) {
+	grid = NewDataTileGrid(g.Width, g.Height)
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			grid.Tiles[x][y] = g.At(x, y)
+		}
+	}
+	return
+}
+
+// Returns the tiles of the layer as a compact grid. Tiles are decoded as
+// with EachTile, so no full size grid is created on the way. Returns an
+// error if a gid of the layer is larger than COMPACT_GRID_MAX_ID. Like
+// GetGrid, the grid of a layer of an infinite map covers its ChunkBounds.
+func (l *Layer) GetCompactGrid() (g *CompactGrid, err error) {
+	var width, height = int(l.Width), int(l.Height)
+	if l.Data.chunked() {
+		var bounds = l.Data.ChunkBounds()
+		width, height = bounds.Dx(), bounds.Dy()
+	}
+	g = NewCompactGrid(width, height)
+	if err = l.EachTile(g.Set); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Replaces the tiles of the layer with those of g, keeping the layer's
+// encoding and compression.
+func (l *Layer) SetCompactGrid(g *CompactGrid) (err error) {
+	if l.Data.chunked() {
+		return l.SetGrid(g.Grid())
+	}
+	var gids = make([]uint32, len(g.Ids))
+	for i := 0; i < len(g.Ids); i++ {
+		gids[i] = uint32(g.Ids[i]) | g.Flips[i]
+	}
+	l.occupancy = nil
+	return l.Data.SetGids(g.Width, g.Height, gids)
+}
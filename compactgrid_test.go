@@ -0,0 +1,81 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+)
+
+const TEST_COMPACT_GRID_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="3" height="2" tilewidth="16" tileheight="16">
+ <layer name="ground" width="3" height="2">
+  <data encoding="csv">1,2147483650,0,65535,3,1073741825</data>
+ </layer>
+ <layer name="huge" width="1" height="1">
+  <data encoding="csv">65536</data>
+ </layer>
+</map>
+`
+
+func TestCompactGrid(t *testing.T) {
+	var (
+		m    *Map
+		g    *CompactGrid
+		gids []uint32
+		err  error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_GRID_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if g, err = m.Layers[0].GetCompactGrid(); err != nil {
+		t.Fatalf("Could not get compact grid: %v", err)
+	}
+	if g.Width != 3 || g.Height != 2 || len(g.Ids) != 6 || len(g.Flips) != 2 {
+		t.Fatalf("Wrong grid: %v", g)
+	}
+	if tile := g.At(1, 0); tile.Id != 2 || !tile.FlipX || tile.FlipY {
+		t.Errorf("Wrong flipped tile: %v", tile)
+	}
+	if tile := g.At(0, 1); tile.Id != 65535 || tile.FlipX {
+		t.Errorf("Wrong tile: %v", tile)
+	}
+	if g.Grid().Tiles[2][1] != g.At(2, 1) {
+		t.Errorf("Grid doesn't match compact grid")
+	}
+	if err = g.Set(1, 0, DataTileGridTile{Id: 4}); err != nil {
+		t.Fatalf("Could not set tile: %v", err)
+	}
+	if len(g.Flips) != 1 {
+		t.Errorf("Flips not cleared: %v", g.Flips)
+	}
+	if err = g.Set(3, 0, DataTileGridTile{Id: 4}); err == nil {
+		t.Errorf("Expected error for position outside of grid")
+	}
+	if err = g.Set(0, 0, DataTileGridTile{Id: COMPACT_GRID_MAX_ID + 1}); err == nil {
+		t.Errorf("Expected error for id out of range")
+	}
+	if err = m.Layers[0].SetCompactGrid(g); err != nil {
+		t.Fatalf("Could not set compact grid: %v", err)
+	}
+	if gids, err = m.Layers[0].Data.Gids(); err != nil {
+		t.Fatalf("Could not get gids: %v", err)
+	}
+	if gids[1] != 4 || gids[5] != 1073741825 {
+		t.Errorf("Wrong gids: %v", gids)
+	}
+	if _, err = m.Layers[1].GetCompactGrid(); err == nil {
+		t.Errorf("Expected error for gid out of range")
+	}
+}
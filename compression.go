@@ -0,0 +1,171 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Reads and writes layer data compressed with a codec. Codecs with a
+// leveled writer honor the compression level of the map.
+type codec struct {
+	reader  func(r io.Reader) (io.ReadCloser, error)
+	writer  func(w io.Writer) io.WriteCloser
+	leveled func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+var compressions = map[string]codec{
+	"gzip": {
+		reader:  func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		writer:  func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		leveled: func(w io.Writer, level int) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) },
+	},
+	"zlib": {
+		reader:  zlib.NewReader,
+		writer:  func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		leveled: func(w io.Writer, level int) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, level) },
+	},
+}
+
+// Makes the codec given by reader and writer available for layer data
+// whose compression attribute is name, replacing any codec registered
+// under that name before. gzip and zlib are built in. Registered codecs
+// write data at their default level, ignoring Map.CompressionLevel.
+// Not safe to call concurrently with decoding or encoding layer data.
+func RegisterCompression(name string, reader func(r io.Reader) (io.ReadCloser, error), writer func(w io.Writer) io.WriteCloser) {
+	compressions[name] = codec{reader: reader, writer: writer}
+}
+
+// Passes writes through for data written uncompressed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Converts the text of layer data to and from the bytes holding one
+// little endian gid every four bytes, compressed if the data has a
+// compression.
+type textEncoding struct {
+	reader func(r io.Reader) io.Reader
+	writer func(w io.Writer) io.WriteCloser
+}
+
+var encodings = map[string]textEncoding{
+	"base64": {
+		reader: func(r io.Reader) io.Reader { return base64.NewDecoder(base64.StdEncoding, r) },
+		writer: func(w io.Writer) io.WriteCloser { return base64.NewEncoder(base64.StdEncoding, w) },
+	},
+}
+
+// Makes the encoding given by reader and writer available for layer data
+// whose encoding attribute is name, replacing any encoding registered
+// under that name before. Like base64, which is built in, an encoding
+// turns the text of the data element into bytes that are decompressed
+// with the data's compression and hold one little endian gid every four
+// bytes. The writer is closed once all bytes are written. The "csv"
+// encoding and XML tile elements are handled separately and can't be
+// replaced. Not safe to call concurrently with decoding or encoding
+// layer data.
+func RegisterEncoding(name string, reader func(r io.Reader) io.Reader, writer func(w io.Writer) io.WriteCloser) {
+	encodings[name] = textEncoding{reader, writer}
+}
+
+// The size of layer data with one encoding and compression and the time
+// taken to encode and decode it.
+type EncodingResult struct {
+	Encoding, Compression string
+
+	// The size of the serialized data element, in bytes.
+	Size int
+
+	Encode, Decode time.Duration
+}
+
+// Encodes the data of l with every supported combination of encoding and
+// compression, including registered ones, and decodes it again, to help
+// pick the settings best suited to a platform. Returns an error if any
+// combination fails to reproduce the gids of l. The compression level of
+// l's map is applied, and l itself is left unchanged. Results are sorted
+// by size. Timings are of a single run, so use a large layer or repeat
+// the comparison to get meaningful numbers.
+func (l *Layer) CompareEncodings() (results []EncodingResult, err error) {
+	var (
+		gids     []uint32
+		grid     DataTileGrid
+		combos   = [][2]string{{"", ""}, {"csv", ""}}
+		names    []string
+		codecs   = []string{""}
+		expected []uint32
+	)
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	if expected, err = l.Data.Gids(); err != nil {
+		return
+	}
+	for name := range encodings {
+		names = append(names, name)
+	}
+	for name := range compressions {
+		codecs = append(codecs, name)
+	}
+	sort.Strings(names)
+	sort.Strings(codecs)
+	for i := 0; i < len(names); i++ {
+		for j := 0; j < len(codecs); j++ {
+			combos = append(combos, [2]string{names[i], codecs[j]})
+		}
+	}
+	for i := 0; i < len(combos); i++ {
+		var (
+			d     = &Data{Encoding: combos[i][0], Compression: combos[i][1], level: l.Data.level}
+			r     = EncodingResult{Encoding: d.Encoding, Compression: d.Compression}
+			start = time.Now()
+			out   []byte
+		)
+		if err = d.SetTileGrid(grid); err != nil {
+			return nil, err
+		}
+		r.Encode = time.Since(start)
+		if out, err = xml.Marshal(d); err != nil {
+			return nil, err
+		}
+		r.Size = len(out)
+		start = time.Now()
+		if gids, err = d.Gids(); err != nil {
+			return nil, err
+		}
+		r.Decode = time.Since(start)
+		if len(gids) != len(expected) {
+			return nil, d.wrapError(fmt.Errorf("Decoded %v gids, expected %v", len(gids), len(expected)))
+		}
+		for j := 0; j < len(gids); j++ {
+			if gids[j] != expected[j] {
+				return nil, d.wrapError(fmt.Errorf("Gid %v decoded as %v, expected %v", j, gids[j], expected[j]))
+			}
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(a, b int) bool { return results[a].Size < results[b].Size })
+	return
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestRegisterCompression(t *testing.T) {
+	var (
+		grid  = NewDataTileGrid(2, 1)
+		layer *Layer
+		tiles []DataTile
+		err   error
+	)
+	RegisterCompression("identity",
+		func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(r), nil },
+		func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} })
+	defer delete(compressions, "identity")
+	grid.Tiles[1][0].Id = 5
+	layer = &Layer{Name: "art", Width: 2, Height: 1, Data: &Data{Compression: "identity"}}
+	if err = layer.SetGrid(grid); err != nil {
+		t.Fatalf("Could not set grid: %v", err)
+	}
+	if layer.Data.Compression != "identity" || layer.Data.RawContents != "AAAAAAUAAAA=" {
+		t.Errorf("Codec not used: %v %v", layer.Data.Compression, layer.Data.RawContents)
+	}
+	if tiles, err = layer.Data.Tiles(); err != nil {
+		t.Fatalf("Could not decode: %v", err)
+	}
+	if len(tiles) != 2 || tiles[1].Gid != 5 {
+		t.Errorf("Invalid tiles: %v", tiles)
+	}
+	layer.Data.Compression = "zstd"
+	if _, err = layer.Data.Tiles(); err == nil || !strings.Contains(err.Error(), "Unsupported compression") {
+		t.Errorf("Expected unsupported compression error, got %v", err)
+	}
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	var (
+		grid  = NewDataTileGrid(2, 1)
+		layer *Layer
+		tiles []DataTile
+		err   error
+	)
+	RegisterEncoding("hex",
+		func(r io.Reader) io.Reader { return hex.NewDecoder(r) },
+		func(w io.Writer) io.WriteCloser { return nopWriteCloser{hex.NewEncoder(w)} })
+	defer delete(encodings, "hex")
+	grid.Tiles[1][0].Id = 5
+	if layer, err = NewLayer("art", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	if err = layer.SetEncoding("hex", ""); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if layer.Data.RawContents != "0000000005000000" {
+		t.Errorf("Encoding not used: %v", layer.Data.RawContents)
+	}
+	if err = layer.SetEncoding("hex", "gzip"); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if tiles, err = layer.Data.Tiles(); err != nil {
+		t.Fatalf("Could not decode: %v", err)
+	}
+	if len(tiles) != 2 || tiles[1].Gid != 5 {
+		t.Errorf("Invalid tiles: %v", tiles)
+	}
+	if err = layer.SetEncoding("base85", ""); err == nil {
+		t.Errorf("Expected error for unregistered encoding")
+	}
+	layer.Data.Encoding = "base85"
+	if _, err = layer.Data.Tiles(); err == nil || !strings.Contains(err.Error(), "Unsupported encoding") {
+		t.Errorf("Expected unsupported encoding error, got %v", err)
+	}
+}
+
+func TestCompareEncodings(t *testing.T) {
+	var (
+		m       *Map
+		results []EncodingResult
+		err     error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var before = m.Layers[1].Data.RawContents
+	if results, err = m.Layers[1].CompareEncodings(); err != nil {
+		t.Fatalf("Could not compare encodings: %v", err)
+	}
+	if len(results) != 2+len(encodings)*(len(compressions)+1) {
+		t.Fatalf("Wrong number of results: %v", results)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Size < results[i-1].Size {
+			t.Errorf("Results not sorted by size: %v", results)
+		}
+	}
+	if last := results[len(results)-1]; last.Encoding != "" {
+		t.Errorf("Expected XML tile elements to be largest, got %v", last)
+	}
+	if m.Layers[1].Data.RawContents != before {
+		t.Errorf("Layer data was changed")
+	}
+}
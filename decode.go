@@ -0,0 +1,80 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Decodes the data of every tile layer ahead of use, spreading the
+// layers over one worker per CPU. Later calls to GetGrid and the like
+// return the decoded gids without decompressing the data again, until
+// the layer's grid is set. Maps with many compressed layers load
+// noticeably faster than when each layer is decoded on first use.
+// Layers of infinite maps are left to be decoded when used.
+func (m *Map) DecodeAllLayers() error {
+	return m.DecodeAllLayersContext(context.Background())
+}
+
+// Like DecodeAllLayers, but stops decoding and returns ctx.Err() once
+// ctx is done. Returns the error of the first layer that failed to
+// decode, after which the remaining layers are skipped.
+func (m *Map) DecodeAllLayersContext(ctx context.Context) (err error) {
+	var (
+		layers  = make(chan *Layer)
+		workers = runtime.GOMAXPROCS(0)
+		once    sync.Once
+		wg      sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if workers > len(m.Layers) {
+		workers = len(m.Layers)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range layers {
+				var gids, e = l.Data.GidsContext(ctx)
+				if e != nil {
+					once.Do(func() {
+						err = m.layerError(l, e)
+						cancel()
+					})
+					continue
+				}
+				l.Data.cached = gids
+			}
+		}()
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if m.Layers[i].Data == nil || m.Layers[i].Data.cached != nil || m.Layers[i].Data.chunked() {
+			continue
+		}
+		select {
+		case layers <- m.Layers[i]:
+		case <-ctx.Done():
+		}
+	}
+	close(layers)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return
+}
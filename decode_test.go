@@ -0,0 +1,91 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeAllLayers(t *testing.T) {
+	var (
+		m        *Map
+		expected []DataTileGrid
+		grid     DataTileGrid
+		err      error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if grid, err = m.Layers[i].GetGrid(); err != nil {
+			t.Fatalf("Could not get grid: %v", err)
+		}
+		expected = append(expected, grid)
+	}
+	if err = m.DecodeAllLayers(); err != nil {
+		t.Fatalf("Could not decode layers: %v", err)
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if m.Layers[i].Data.cached == nil {
+			t.Errorf("Layer %v was not decoded", m.Layers[i].Name)
+		}
+		if grid, err = m.Layers[i].GetGrid(); err != nil || !reflect.DeepEqual(grid, expected[i]) {
+			t.Errorf("Layer %v decoded differently: %v", m.Layers[i].Name, err)
+		}
+	}
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Layers[1].Data.RawContents = "!"
+	var layerErr *LayerError
+	if err = m.DecodeAllLayers(); !errors.As(err, &layerErr) || layerErr.Layer != m.Layers[1].Name {
+		t.Errorf("Expected error for layer %v, got %v", m.Layers[1].Name, err)
+	}
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err = m.DecodeAllLayersContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+}
+
+func BenchmarkDecodeAllLayers(b *testing.B) {
+	var (
+		m   = &Map{}
+		src = benchmarkLayer(b, 256)
+		err error
+	)
+	for i := 0; i < 32; i++ {
+		var l = *src
+		l.Data = &Data{}
+		*l.Data = *src.Data
+		m.Layers = append(m.Layers, &l)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(m.Layers); j++ {
+			m.Layers[j].Data.cached = nil
+		}
+		if err = m.DecodeAllLayers(); err != nil {
+			b.Fatalf("Could not decode layers: %v", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+)
+
+// An error concerning a tile layer of a map. Use errors.As to find
+// the layer an error returned by this package originated from.
+type LayerError struct {
+	// The name of the layer.
+	Layer string
+
+	// The position of the layer in Map.Layers.
+	Index int
+
+	Cause error
+}
+
+func (e *LayerError) Error() string {
+	return fmt.Sprintf("Layer %v (%v): %v", e.Layer, e.Index, e.Cause)
+}
+
+func (e *LayerError) Unwrap() error {
+	return e.Cause
+}
+
+// An error concerning a tileset of a map.
+type TilesetError struct {
+	// The name of the tileset.
+	Tileset string
+
+	// The position of the tileset in Map.Tilesets.
+	Index int
+
+	Cause error
+}
+
+func (e *TilesetError) Error() string {
+	return fmt.Sprintf("Tileset %v (%v): %v", e.Tileset, e.Index, e.Cause)
+}
+
+func (e *TilesetError) Unwrap() error {
+	return e.Cause
+}
+
+// An error encoding or decoding the tile data of a layer.
+type DataError struct {
+	// The encoding and compression of the data.
+	Encoding    string
+	Compression string
+
+	Cause error
+}
+
+func (e *DataError) Error() string {
+	return fmt.Sprintf("Data (encoding %q, compression %q): %v",
+		e.Encoding, e.Compression, e.Cause)
+}
+
+func (e *DataError) Unwrap() error {
+	return e.Cause
+}
+
+// An error returned when decoding a map would exceed the Limits of a Loader.
+type LimitError struct {
+	// The limit exceeded: "map bytes", "layer bytes", "tiles" or "layers".
+	Limit string
+
+	// The value found, which may be cut off just past Max for sizes.
+	Value int64
+
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Limit of %v %v exceeded: %v", e.Max, e.Limit, e.Value)
+}
+
+func (d *Data) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DataError{Encoding: d.Encoding, Compression: d.Compression, Cause: err}
+}
+
+// Wraps err in a LayerError for l, which must be a layer of m.
+func (m *Map) layerError(l *Layer, err error) error {
+	if err == nil {
+		return nil
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if m.Layers[i] == l {
+			return &LayerError{Layer: l.Name, Index: i, Cause: err}
+		}
+	}
+	return &LayerError{Layer: l.Name, Index: -1, Cause: err}
+}
+
+func (m *Map) tilesetError(t *Tileset, err error) error {
+	if err == nil {
+		return nil
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		if m.Tilesets[i] == t {
+			return &TilesetError{Tileset: t.Name, Index: i, Cause: err}
+		}
+	}
+	return &TilesetError{Tileset: t.Name, Index: -1, Cause: err}
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"errors"
+	"testing"
+)
+
+const TEST_BROKEN_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="sprites" tilewidth="16" tileheight="16">
+  <image source="sprites.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ok" width="1" height="1">
+  <data><tile gid="1"/></data>
+ </layer>
+ <layer name="broken" width="1" height="1">
+  <data encoding="base64" compression="zlib">not base64!</data>
+ </layer>
+</map>
+`
+
+func TestLayerError(t *testing.T) {
+	var (
+		m         *Map
+		layerErr  *LayerError
+		dataErr   *DataError
+		tilesetEr *TilesetError
+		err       error
+	)
+	if m, err = ParseMapString(TEST_BROKEN_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = m.TilesFromLayerName("broken"); err == nil {
+		t.Fatalf("Expected error decoding broken layer")
+	}
+	if !errors.As(err, &layerErr) || layerErr.Layer != "broken" || layerErr.Index != 1 {
+		t.Errorf("Expected layer error for broken layer: %v", err)
+	}
+	if !errors.As(err, &dataErr) || dataErr.Compression != "zlib" {
+		t.Errorf("Expected data error: %v", err)
+	}
+	_, err = ParseMapString(`<map><tileset name="bad"><wangsets><wangset><wangtile wangid="1,2"/></wangset></wangsets></tileset></map>`)
+	if !errors.As(err, &tilesetEr) || tilesetEr.Tileset != "bad" || tilesetEr.Index != 0 {
+		t.Errorf("Expected tileset error: %v", err)
+	}
+}
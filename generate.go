@@ -0,0 +1,175 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Number of candidate placements tried per cell before
+// GenerateWangLayer gives up.
+const WANG_MAX_STEPS_PER_CELL = 1000
+
+// Fills a width x height layer with tiles from set, picked at random
+// such that the Wang colors along every shared edge and corner of
+// adjacent tiles match. Placement backtracks when it runs into a cell
+// no tile fits. If rnd is nil the default random source is used.
+func GenerateWangLayer(tileset *Tileset, set *WangSet, name string, width, height int, rnd *rand.Rand) (l *Layer, err error) {
+	var (
+		cells   = width * height
+		choices = make([][]*WangTile, cells)
+		pos     = make([]int, cells)
+		steps   = 0
+		grid    DataTileGrid
+		i       = 0
+	)
+	if len(set.Tiles) == 0 {
+		err = fmt.Errorf("Wang set %v has no tiles", set.Name)
+		return
+	}
+	for i < cells {
+		if steps++; steps > cells*WANG_MAX_STEPS_PER_CELL {
+			err = fmt.Errorf("Gave up placing tiles from wang set %v", set.Name)
+			return
+		}
+		if choices[i] == nil {
+			var left, top *WangTile
+			if i%width > 0 {
+				left = choices[i-1][pos[i-1]]
+			}
+			if i >= width {
+				top = choices[i-width][pos[i-width]]
+			}
+			choices[i] = wangCandidates(set, left, top, rnd)
+			pos[i] = 0
+		} else {
+			pos[i]++
+		}
+		if pos[i] >= len(choices[i]) {
+			choices[i] = nil
+			if i--; i < 0 {
+				err = fmt.Errorf("No valid arrangement of wang set %v", set.Name)
+				return
+			}
+			continue
+		}
+		i++
+	}
+	grid = NewDataTileGrid(width, height)
+	for i = 0; i < cells; i++ {
+		grid.Tiles[i%width][i/width].Id = tileset.FirstGid + choices[i][pos[i]].TileId
+	}
+	return NewLayer(name, grid)
+}
+
+// Returns the tiles of set which fit to the right of left and below top,
+// either of which may be nil, in random order. Like Tiled, tiles are
+// weighted by the probabilities of their colors, so likelier tiles tend
+// to come first, and tiles with a probability of 0 are left out.
+func wangCandidates(set *WangSet, left, top *WangTile, rnd *rand.Rand) (out []*WangTile) {
+	var (
+		keys  = map[*WangTile]float64{}
+		float = rand.Float64
+	)
+	if rnd != nil {
+		float = rnd.Float64
+	}
+	out = []*WangTile{}
+	for i := 0; i < len(set.Tiles); i++ {
+		var id = set.Tiles[i].WangId
+		if left != nil && (id[WANG_LEFT] != left.WangId[WANG_RIGHT] ||
+			id[WANG_TOP_LEFT] != left.WangId[WANG_TOP_RIGHT] ||
+			id[WANG_BOTTOM_LEFT] != left.WangId[WANG_BOTTOM_RIGHT]) {
+			continue
+		}
+		if top != nil && (id[WANG_TOP] != top.WangId[WANG_BOTTOM] ||
+			id[WANG_TOP_LEFT] != top.WangId[WANG_BOTTOM_LEFT] ||
+			id[WANG_TOP_RIGHT] != top.WangId[WANG_BOTTOM_RIGHT]) {
+			continue
+		}
+		var p = set.WangIdProbability(id)
+		if p <= 0 {
+			continue
+		}
+		// Sorting by u^(1/p) for uniform u draws a weighted random order.
+		keys[set.Tiles[i]] = math.Pow(float(), 1/p)
+		out = append(out, set.Tiles[i])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return keys[out[i]] > keys[out[j]] })
+	return
+}
+
+// Creates a width x height layer where the tile at x, y is the gid
+// returned by sampler, including any flip flags. A gid of 0 leaves
+// the cell empty.
+func GenerateLayer(width, height int, sampler func(x, y int) uint32) (l *Layer, err error) {
+	var grid = NewDataTileGrid(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			grid.Tiles[x][y] = gridTile(sampler(x, y))
+		}
+	}
+	return NewLayer("", grid)
+}
+
+// Returns a sampler for GenerateLayer which maps values of noise to gids.
+// Values below limits[i] map to gids[i], values at or above the last
+// limit map to the last gid, so gids must have one more entry than limits.
+// Limits must be sorted in increasing order.
+func Thresholds(noise func(x, y int) float64, limits []float64, gids []uint32) (sampler func(x, y int) uint32, err error) {
+	if len(gids) != len(limits)+1 {
+		err = fmt.Errorf("Expected %v gids for %v limits, got %v", len(limits)+1, len(limits), len(gids))
+		return
+	}
+	for i := 1; i < len(limits); i++ {
+		if limits[i] < limits[i-1] {
+			err = fmt.Errorf("Limits not sorted at index %v", i)
+			return
+		}
+	}
+	sampler = func(x, y int) uint32 {
+		var v = noise(x, y)
+		for i := 0; i < len(limits); i++ {
+			if v < limits[i] {
+				return gids[i]
+			}
+		}
+		return gids[len(gids)-1]
+	}
+	return
+}
+
+// Returns a sampler for GenerateLayer which splits the range [0, 1] of
+// noise into equally sized bands, one per gid. Values outside the range
+// are clamped to the first or last band. At least one gid is required.
+func Palette(noise func(x, y int) float64, gids []uint32) (sampler func(x, y int) uint32, err error) {
+	if len(gids) == 0 {
+		err = fmt.Errorf("No gids given")
+		return
+	}
+	sampler = func(x, y int) uint32 {
+		var i = int(noise(x, y) * float64(len(gids)))
+		if i < 0 {
+			i = 0
+		} else if i >= len(gids) {
+			i = len(gids) - 1
+		}
+		return gids[i]
+	}
+	return
+}
@@ -0,0 +1,179 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const TEST_WANG_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="terrain" tilewidth="16" tileheight="16">
+  <image source="terrain.png" width="64" height="16"/>
+  <wangsets>
+   <wangset name="ground" type="corner" tile="-1">
+    <wangcolor name="grass" color="#00ff00" tile="-1"/>
+    <wangcolor name="dirt" color="#c17d11" tile="-1"/>
+    <wangtile tileid="0" wangid="0,1,0,1,0,1,0,1"/>
+    <wangtile tileid="1" wangid="0,2,0,2,0,2,0,2"/>
+    <wangtile tileid="2" wangid="0,2,0,2,0,1,0,1"/>
+    <wangtile tileid="3" wangid="0,1,0,1,0,2,0,2"/>
+   </wangset>
+  </wangsets>
+ </tileset>
+</map>
+`
+
+func TestGenerateWangLayer(t *testing.T) {
+	var (
+		m      *Map
+		set    *WangSet
+		layer  *Layer
+		grid   DataTileGrid
+		byTile = map[uint32]*WangTile{}
+		err    error
+	)
+	if m, err = ParseMapString(TEST_WANG_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if len(m.Tilesets[0].WangSets) != 1 {
+		t.Fatalf("Wang set not parsed")
+	}
+	set = m.Tilesets[0].WangSets[0]
+	if set.Tiles[2].WangId[WANG_TOP_RIGHT] != 2 || set.Tiles[2].WangId[WANG_BOTTOM_LEFT] != 1 {
+		t.Errorf("Invalid wangid: %v", set.Tiles[2].WangId)
+	}
+	for i := 0; i < len(set.Tiles); i++ {
+		byTile[set.Tiles[i].TileId+1] = set.Tiles[i]
+	}
+	if layer, err = GenerateWangLayer(m.Tilesets[0], set, "ground", 8, 6, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			var c = byTile[grid.Tiles[x][y].Id]
+			if c == nil {
+				t.Fatalf("Invalid tile at %v,%v: %v", x, y, grid.Tiles[x][y].Id)
+			}
+			if x > 0 && byTile[grid.Tiles[x-1][y].Id].WangId[WANG_TOP_RIGHT] != c.WangId[WANG_TOP_LEFT] {
+				t.Errorf("Mismatched horizontal neighbors at %v,%v", x, y)
+			}
+			if y > 0 && byTile[grid.Tiles[x][y-1].Id].WangId[WANG_BOTTOM_LEFT] != c.WangId[WANG_TOP_LEFT] {
+				t.Errorf("Mismatched vertical neighbors at %v,%v", x, y)
+			}
+		}
+	}
+}
+
+func TestGenerateLayer(t *testing.T) {
+	var (
+		noise   = func(x, y int) float64 { return float64(x) / 4.0 }
+		layer   *Layer
+		grid    DataTileGrid
+		sampler func(x, y int) uint32
+		err     error
+	)
+	if _, err = Thresholds(noise, []float64{0.3, 0.6}, []uint32{1, 2}); err == nil {
+		t.Errorf("Expected error for too few gids")
+	}
+	if _, err = Thresholds(noise, []float64{0.6, 0.3}, []uint32{1, 2, 3}); err == nil {
+		t.Errorf("Expected error for unsorted limits")
+	}
+	if _, err = Palette(noise, nil); err == nil {
+		t.Errorf("Expected error for empty palette")
+	}
+	if sampler, err = Thresholds(noise, []float64{0.3, 0.6}, []uint32{1, 2, 3}); err != nil {
+		t.Fatalf("Could not create thresholds: %v", err)
+	}
+	if layer, err = GenerateLayer(4, 2, sampler); err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for x, want := range []uint32{1, 1, 2, 3} {
+		if grid.Tiles[x][1].Id != want {
+			t.Errorf("Wrong threshold tile at %v: %v", x, grid.Tiles[x][1].Id)
+		}
+	}
+	if sampler, err = Palette(noise, []uint32{5, 6}); err != nil {
+		t.Fatalf("Could not create palette: %v", err)
+	}
+	if layer, err = GenerateLayer(4, 1, sampler); err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for x, want := range []uint32{5, 5, 6, 6} {
+		if grid.Tiles[x][0].Id != want {
+			t.Errorf("Wrong palette tile at %v: %v", x, grid.Tiles[x][0].Id)
+		}
+	}
+}
+
+func TestWangColorProbability(t *testing.T) {
+	var (
+		m      *Map
+		set    *WangSet
+		layer  *Layer
+		grid   DataTileGrid
+		counts = map[uint32]int{}
+		out    string
+		err    error
+	)
+	if m, err = ParseMapString(TEST_WANG_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	set = m.Tilesets[0].WangSets[0]
+	if set.Colors[0].Probability != 1 {
+		t.Errorf("Probability does not default to 1: %v", set.Colors[0].Probability)
+	}
+	set.Colors[1].Probability = 0
+	if layer, err = GenerateWangLayer(m.Tilesets[0], set, "ground", 4, 4, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatalf("Could not generate: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for x := 0; x < grid.Width; x++ {
+		for y := 0; y < grid.Height; y++ {
+			if grid.Tiles[x][y].Id != 1 {
+				t.Fatalf("Tile with color of probability 0 placed at %v,%v", x, y)
+			}
+		}
+	}
+	set.Colors[1].Probability = 0.01
+	for i := 0; i < 20; i++ {
+		var candidates = wangCandidates(set, nil, nil, rand.New(rand.NewSource(int64(i))))
+		counts[candidates[0].TileId]++
+	}
+	if counts[0] < 15 {
+		t.Errorf("Likely tile not preferred: %v", counts)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `<wangcolor name="dirt" color="#c17d11" tile="-1" probability="0.01">`) ||
+		strings.Contains(out, `probability="1"`) {
+		t.Errorf("Probability not serialized: %v", out)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// The orientations of maps Tiled supports.
+type MapOrientation int
+
+const (
+	ORIENTATION_UNKNOWN MapOrientation = iota
+	ORIENTATION_ORTHOGONAL
+	ORIENTATION_ISOMETRIC
+	ORIENTATION_STAGGERED
+	ORIENTATION_HEXAGONAL
+)
+
+var mapOrientations = map[string]MapOrientation{
+	"orthogonal": ORIENTATION_ORTHOGONAL,
+	"isometric":  ORIENTATION_ISOMETRIC,
+	"staggered":  ORIENTATION_STAGGERED,
+	"hexagonal":  ORIENTATION_HEXAGONAL,
+}
+
+// The order in which tiles of a layer are drawn.
+type RenderOrder int
+
+const (
+	RENDER_ORDER_RIGHT_DOWN RenderOrder = iota
+	RENDER_ORDER_RIGHT_UP
+	RENDER_ORDER_LEFT_DOWN
+	RENDER_ORDER_LEFT_UP
+)
+
+var renderOrders = map[string]RenderOrder{
+	"right-down": RENDER_ORDER_RIGHT_DOWN,
+	"right-up":   RENDER_ORDER_RIGHT_UP,
+	"left-down":  RENDER_ORDER_LEFT_DOWN,
+	"left-up":    RENDER_ORDER_LEFT_UP,
+}
+
+// Returns the orientation named s, as in the orientation attribute of
+// maps.
+func ParseOrientation(s string) (o MapOrientation, err error) {
+	var ok bool
+	if o, ok = mapOrientations[s]; !ok {
+		err = fmt.Errorf("Invalid orientation %v", s)
+	}
+	return
+}
+
+// Returns the name of the orientation as used in the orientation
+// attribute of maps, or "" for ORIENTATION_UNKNOWN.
+func (o MapOrientation) String() string {
+	for name, value := range mapOrientations {
+		if value == o {
+			return name
+		}
+	}
+	return ""
+}
+
+// Returns the render order named s, as in the renderorder attribute of
+// maps. The empty string is the default, RENDER_ORDER_RIGHT_DOWN.
+func ParseRenderOrder(s string) (r RenderOrder, err error) {
+	var ok bool
+	if s == "" {
+		return RENDER_ORDER_RIGHT_DOWN, nil
+	}
+	if r, ok = renderOrders[s]; !ok {
+		err = fmt.Errorf("Invalid render order %v", s)
+	}
+	return
+}
+
+// Returns the name of the render order as used in the renderorder
+// attribute of maps.
+func (r RenderOrder) String() string {
+	for name, value := range renderOrders {
+		if value == r {
+			return name
+		}
+	}
+	return ""
+}
+
+// Calls fn with every tile of layer l in the order given by the map's
+// render order, so tiles overlapping their neighbours, such as tiles
+// taller than the grid, are drawn the way Tiled draws them. Empty tiles
+// are skipped. The x and y passed to fn are the tile's cell on the map.
+// Iteration stops at the first error fn returns, which is passed on to
+// the caller.
+func (m *Map) TilesInRenderOrder(l *Layer, fn func(x, y int, t *Tile) error) error {
+	return m.TilesInRenderOrderContext(context.Background(), l, fn)
+}
+
+// Like TilesInRenderOrder, but stops decoding the layer data and returns
+// ctx.Err() once ctx is done.
+func (m *Map) TilesInRenderOrderContext(ctx context.Context, l *Layer, fn func(x, y int, t *Tile) error) (err error) {
+	var (
+		order  RenderOrder
+		tiles  []*Tile
+		bounds = image.Rect(0, 0, int(l.Width), int(l.Height))
+	)
+	if order, err = ParseRenderOrder(m.RenderOrder); err != nil {
+		return
+	}
+	if l.Data.chunked() {
+		bounds = l.Data.ChunkBounds()
+	}
+	if tiles, err = m.tilesFromLayer(ctx, l); err != nil {
+		return
+	}
+	var (
+		w, h = bounds.Dx(), bounds.Dy()
+		left = order == RENDER_ORDER_LEFT_DOWN || order == RENDER_ORDER_LEFT_UP
+		up   = order == RENDER_ORDER_RIGHT_UP || order == RENDER_ORDER_LEFT_UP
+	)
+	if len(tiles) != w*h {
+		return m.layerError(l, fmt.Errorf("Tile length %v didn't match width x height (%v,%v)", len(tiles), w, h))
+	}
+	for row := 0; row < h; row++ {
+		for col := 0; col < w; col++ {
+			var x, y = col, row
+			if left {
+				x = w - 1 - col
+			}
+			if up {
+				y = h - 1 - row
+			}
+			if tiles[y*w+x] == nil {
+				continue
+			}
+			if err = fn(bounds.Min.X+x, bounds.Min.Y+y, tiles[y*w+x]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// The properties of a map an engine needs to set up rendering, parsed
+// from the attributes of the map.
+type MapInfo struct {
+	Orientation MapOrientation
+	RenderOrder RenderOrder
+
+	// The size of the map in tiles and of its tiles in pixels.
+	Width, Height         int32
+	TileWidth, TileHeight int32
+
+	// The size of the whole map on screen, as by PixelSize.
+	PixelWidth, PixelHeight float32
+
+	// The background color of the map, nil if it has none.
+	BackgroundColor color.Color
+
+	Infinite bool
+}
+
+// Returns the attributes of the map in parsed form. Unknown orientations
+// are ORIENTATION_UNKNOWN. Returns an error for an invalid render order
+// or background color.
+func (m *Map) Info() (info MapInfo, err error) {
+	info = MapInfo{
+		Orientation: mapOrientations[m.Orientation],
+		Width:       m.Width,
+		Height:      m.Height,
+		TileWidth:   m.TileWidth,
+		TileHeight:  m.TileHeight,
+		Infinite:    m.Infinite,
+	}
+	info.PixelWidth, info.PixelHeight = m.PixelSize()
+	if info.RenderOrder, err = ParseRenderOrder(m.RenderOrder); err != nil {
+		return
+	}
+	if m.BackgroundColor != "" {
+		if info.BackgroundColor, err = ParseColor(m.BackgroundColor); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Parses a color in the #RRGGBB or #AARRGGBB format Tiled uses. The
+// leading # is optional.
+func ParseColor(s string) (c color.NRGBA, err error) {
+	var (
+		hex = strings.TrimPrefix(s, "#")
+		v   uint64
+	)
+	if len(hex) != 6 && len(hex) != 8 {
+		err = fmt.Errorf("Invalid color %q", s)
+		return
+	}
+	if v, err = strconv.ParseUint(hex, 16, 32); err != nil {
+		err = fmt.Errorf("Invalid color %q", s)
+		return
+	}
+	c = color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+	if len(hex) == 8 {
+		c.A = uint8(v >> 24)
+	}
+	return
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapInfo(t *testing.T) {
+	var (
+		m    *Map
+		info MapInfo
+		err  error
+	)
+	if m, err = ParseMapString(strings.Replace(TEST_MAP, `orientation="orthogonal"`,
+		`orientation="isometric" renderorder="left-up" backgroundcolor="#80ff0000"`, 1)); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if info, err = m.Info(); err != nil {
+		t.Fatalf("Could not get info: %v", err)
+	}
+	if info.Orientation != ORIENTATION_ISOMETRIC || info.RenderOrder != RENDER_ORDER_LEFT_UP || info.Infinite {
+		t.Errorf("Invalid info: %+v", info)
+	}
+	if info.BackgroundColor != (color.NRGBA{255, 0, 0, 128}) {
+		t.Errorf("Invalid background color: %v", info.BackgroundColor)
+	}
+	if w, h := m.PixelSize(); info.PixelWidth != w || info.PixelHeight != h || info.TileWidth != m.TileWidth {
+		t.Errorf("Invalid size: %+v", info)
+	}
+	m.BackgroundColor = ""
+	m.RenderOrder = ""
+	if info, err = m.Info(); err != nil || info.BackgroundColor != nil || info.RenderOrder != RENDER_ORDER_RIGHT_DOWN {
+		t.Errorf("Invalid defaults: %+v %v", info, err)
+	}
+	m.RenderOrder = "down-right"
+	if _, err = m.Info(); err == nil {
+		t.Errorf("Expected error for invalid render order")
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		color color.NRGBA
+		valid bool
+	}{
+		{"#c17d11", color.NRGBA{0xc1, 0x7d, 0x11, 0xff}, true},
+		{"ffc17d11", color.NRGBA{0xc1, 0x7d, 0x11, 0xff}, true},
+		{"#00000000", color.NRGBA{}, true},
+		{"#c17d1", color.NRGBA{}, false},
+		{"#gggggg", color.NRGBA{}, false},
+	} {
+		if parsed, err := ParseColor(c.s); (err == nil) != c.valid || (c.valid && parsed != c.color) {
+			t.Errorf("Parsed %v as %v, %v", c.s, parsed, err)
+		}
+	}
+}
+
+func TestOrientationAndRenderOrder(t *testing.T) {
+	for _, name := range []string{"orthogonal", "isometric", "staggered", "hexagonal"} {
+		if o, err := ParseOrientation(name); err != nil || o.String() != name {
+			t.Errorf("Orientation %v parsed as %v: %v", name, o, err)
+		}
+	}
+	if _, err := ParseOrientation("cubic"); err == nil {
+		t.Errorf("Expected error for invalid orientation")
+	}
+	if ORIENTATION_UNKNOWN.String() != "" {
+		t.Errorf("Invalid name for unknown orientation: %v", ORIENTATION_UNKNOWN)
+	}
+	for _, name := range []string{"right-down", "right-up", "left-down", "left-up"} {
+		if r, err := ParseRenderOrder(name); err != nil || r.String() != name {
+			t.Errorf("Render order %v parsed as %v: %v", name, r, err)
+		}
+	}
+	if r, err := ParseRenderOrder(""); err != nil || r != RENDER_ORDER_RIGHT_DOWN {
+		t.Errorf("Invalid default render order %v: %v", r, err)
+	}
+}
+
+func TestTilesInRenderOrder(t *testing.T) {
+	var (
+		m      *Map
+		orders = map[string][]image.Point{
+			"":           {{0, 0}, {0, 1}, {1, 1}},
+			"right-up":   {{0, 1}, {1, 1}, {0, 0}},
+			"left-down":  {{0, 0}, {1, 1}, {0, 1}},
+			"left-up":    {{1, 1}, {0, 1}, {0, 0}},
+			"right-down": {{0, 0}, {0, 1}, {1, 1}},
+		}
+		err error
+	)
+	if m, err = ParseMapString(TEST_TILES_FROM_LAYER_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	for order, expected := range orders {
+		var visited []image.Point
+		m.RenderOrder = order
+		err = m.TilesInRenderOrder(m.Layers[0], func(x, y int, tile *Tile) error {
+			visited = append(visited, image.Pt(x, y))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Could not iterate in %v order: %v", order, err)
+		}
+		if !reflect.DeepEqual(visited, expected) {
+			t.Errorf("Wrong %v order: %v, expected %v", order, visited, expected)
+		}
+	}
+	var calls int
+	err = m.TilesInRenderOrder(m.Layers[0], func(x, y int, tile *Tile) error {
+		calls++
+		return fmt.Errorf("Stop")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Iteration not stopped: %v calls, %v", calls, err)
+	}
+	m.RenderOrder = "diagonal"
+	if err = m.TilesInRenderOrder(m.Layers[0], func(x, y int, tile *Tile) error { return nil }); err == nil {
+		t.Errorf("Expected error for invalid render order")
+	}
+}
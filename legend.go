@@ -0,0 +1,85 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Returns the tiles of the layer as text, one line per row, with every
+// tile written as its string in legend. Tiles are looked up by their gid
+// including flip flags first and without them second, so a legend only
+// needs entries for flipped tiles that should look different. Returns
+// an error for tiles missing from the legend. Handy for reviewing simple
+// levels, such as in tests.
+func (l *Layer) ExportLegend(legend map[uint32]string) (lines []string, err error) {
+	var grid DataTileGrid
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	lines = make([]string, grid.Height)
+	for y := 0; y < grid.Height; y++ {
+		var line bytes.Buffer
+		for x := 0; x < grid.Width; x++ {
+			var gid = uint32(grid.Tiles[x][y].GID())
+			var s, ok = legend[gid]
+			if !ok {
+				s, ok = legend[gid&^CLEAR_FLIP]
+			}
+			if !ok {
+				return nil, fmt.Errorf("Tile %v,%v: gid %v not in legend", x, y, gid)
+			}
+			line.WriteString(s)
+		}
+		lines[y] = line.String()
+	}
+	return
+}
+
+// Sets the tiles of the layer from text, one line per row, with every
+// rune standing for the gid it has in legend. All lines must be of the
+// same length, which becomes the width of the layer, while the number of
+// lines becomes its height. Layers of infinite maps keep their size and
+// are written starting at the top left of their chunk bounds.
+func (l *Layer) ImportFromRunes(lines []string, legend map[rune]uint32) (err error) {
+	var width int
+	if len(lines) > 0 {
+		width = utf8.RuneCountInString(lines[0])
+	}
+	var grid = NewDataTileGrid(width, len(lines))
+	for y := 0; y < len(lines); y++ {
+		if n := utf8.RuneCountInString(lines[y]); n != width {
+			return fmt.Errorf("Line %v is %v runes long, expected %v", y, n, width)
+		}
+		var x int
+		for _, r := range lines[y] {
+			var gid, ok = legend[r]
+			if !ok {
+				return fmt.Errorf("Line %v: rune %q not in legend", y, r)
+			}
+			grid.Tiles[x][y] = gridTile(gid)
+			x++
+		}
+	}
+	if err = l.SetGrid(grid); err != nil {
+		return
+	}
+	if !l.Data.chunked() {
+		l.Width, l.Height = int32(width), int32(len(lines))
+	}
+	return
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLegend(t *testing.T) {
+	var (
+		m     *Map
+		lines = []string{
+			"#####",
+			"#..~#",
+			"#####",
+		}
+		runes  = map[rune]uint32{'.': 0, '#': 1, '~': 2 | FLIPPED_H_FLAG}
+		legend = map[uint32]string{0: ".", 1: "#", 2: "~"}
+		out    []string
+		err    error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var layer = m.Layers[0]
+	if err = layer.ImportFromRunes(lines, runes); err != nil {
+		t.Fatalf("Could not import: %v", err)
+	}
+	if layer.Width != 5 || layer.Height != 3 {
+		t.Errorf("Invalid layer size %vx%v", layer.Width, layer.Height)
+	}
+	if out, err = layer.ExportLegend(legend); err != nil || !reflect.DeepEqual(out, lines) {
+		t.Errorf("Exported %v, expected %v: %v", out, lines, err)
+	}
+	legend[2|FLIPPED_H_FLAG] = "<"
+	if out, _ = layer.ExportLegend(legend); out[1] != "#..<#" {
+		t.Errorf("Flipped tile not looked up first: %v", out)
+	}
+	delete(legend, 1)
+	if _, err = layer.ExportLegend(legend); err == nil {
+		t.Errorf("Expected error for tile missing from legend")
+	}
+	if err = layer.ImportFromRunes([]string{"##", "#"}, runes); err == nil {
+		t.Errorf("Expected error for ragged lines")
+	}
+	if err = layer.ImportFromRunes([]string{"#?"}, runes); err == nil {
+		t.Errorf("Expected error for rune missing from legend")
+	}
+}
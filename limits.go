@@ -0,0 +1,97 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Bounds on the resources decoding a map may use, for parsing maps from
+// untrusted sources. A zero field means no limit.
+type Limits struct {
+	// The size of a map file after gzip decompression, in bytes.
+	MaxMapBytes int64
+
+	// The size of the decoded and decompressed data of a layer, in bytes.
+	MaxLayerBytes int64
+
+	// The number of tiles of all tile layers of a map taken together,
+	// as given by their width and height, and of a layer's data.
+	MaxTiles int64
+
+	// The number of tile layers, object groups and image layers of a map.
+	MaxLayers int
+}
+
+// Checks the layer counts and sizes of m against limits.
+func (m *Map) checkLimits(limits Limits) (err error) {
+	var (
+		layers = len(m.Layers) + len(m.ObjectGroups) + len(m.ImageLayers)
+		tiles  int64
+	)
+	if limits.MaxLayers > 0 && layers > limits.MaxLayers {
+		return &LimitError{Limit: "layers", Value: int64(layers), Max: int64(limits.MaxLayers)}
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		tiles += int64(m.Layers[i].Width) * int64(m.Layers[i].Height)
+	}
+	if limits.MaxTiles > 0 && tiles > limits.MaxTiles {
+		return &LimitError{Limit: "tiles", Value: tiles, Max: limits.MaxTiles}
+	}
+	return
+}
+
+// Applies limits to the decoding of the data of every tile layer of m.
+func (m *Map) setLimits(limits Limits) {
+	for i := 0; i < len(m.Layers); i++ {
+		if m.Layers[i].Data != nil {
+			m.Layers[i].Data.limits = limits
+		}
+	}
+}
+
+// Reads all of r, failing with a LimitError named limit once more than
+// max bytes are read. max is ignored unless positive.
+func readLimited(r io.Reader, limit string, max int64) (data []byte, err error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	if data, err = ioutil.ReadAll(io.LimitReader(r, max+1)); err != nil {
+		return
+	}
+	if int64(len(data)) > max {
+		return nil, &LimitError{Limit: limit, Value: int64(len(data)), Max: max}
+	}
+	return
+}
+
+// Fails reads with a LimitError named limit once more than max bytes
+// were read from r. max is ignored unless positive.
+type limitedReader struct {
+	r     io.Reader
+	limit string
+	n     int64
+	max   int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = l.r.Read(p)
+	l.n += int64(n)
+	if l.max > 0 && l.n > l.max {
+		return n, &LimitError{Limit: l.limit, Value: l.n, Max: l.max}
+	}
+	return
+}
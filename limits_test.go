@@ -0,0 +1,96 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoaderLimits(t *testing.T) {
+	var (
+		m       *Map
+		limit   *LimitError
+		gzipped bytes.Buffer
+		w       = gzip.NewWriter(&gzipped)
+		loader  *Loader
+		err     error
+	)
+	w.Write([]byte(TEST_MAP_ENCODED))
+	w.Close()
+	loader = NewLoader(fstest.MapFS{
+		"level.tmx.gz": &fstest.MapFile{Data: gzipped.Bytes()},
+		"level.tmx":    &fstest.MapFile{Data: []byte(TEST_MAP_ENCODED)},
+	})
+	for _, c := range []struct {
+		limits Limits
+		name   string
+	}{
+		{Limits{MaxLayers: 1}, "layers"},
+		{Limits{MaxTiles: 71*40*2 - 1}, "tiles"},
+		{Limits{MaxMapBytes: 100}, "map bytes"},
+	} {
+		loader.Limits = c.limits
+		if _, err = loader.ParseMapFile("level.tmx.gz"); !errors.As(err, &limit) || limit.Limit != c.name {
+			t.Errorf("Expected %v limit error, got %v", c.name, err)
+		}
+	}
+	if _, err = ParseMapReader(bytes.NewReader(gzipped.Bytes())); err != nil {
+		t.Errorf("Limits applied outside of loader: %v", err)
+	}
+	// A small upload inflating to far more than the limit.
+	var bomb bytes.Buffer
+	w = gzip.NewWriter(&bomb)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<map>"))
+	w.Write(make([]byte, 1<<24))
+	w.Close()
+	var uploads = &Loader{Limits: Limits{MaxMapBytes: 1 << 20}}
+	if _, err = uploads.ParseMapReader(bytes.NewReader(bomb.Bytes())); !errors.As(err, &limit) || limit.Limit != "map bytes" {
+		t.Errorf("Expected map bytes limit error, got %v", err)
+	}
+	if _, err = uploads.ParseMapString(bomb.String()); !errors.As(err, &limit) || limit.Limit != "map bytes" {
+		t.Errorf("Expected map bytes limit error, got %v", err)
+	}
+	if _, err = uploads.ParseMapString(strings.Repeat(" ", 1<<20+1)); !errors.As(err, &limit) || limit.Limit != "map bytes" {
+		t.Errorf("Expected map bytes limit error, got %v", err)
+	}
+	uploads.Limits = Limits{MaxLayers: 1}
+	if _, err = uploads.ParseMapString(TEST_MAP_ENCODED); !errors.As(err, &limit) || limit.Limit != "layers" {
+		t.Errorf("Expected layers limit error, got %v", err)
+	}
+	uploads.Limits = Limits{}
+	if _, err = uploads.ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Errorf("Could not parse: %v", err)
+	}
+	loader.Limits = Limits{MaxLayers: 2, MaxTiles: 71 * 40 * 2, MaxLayerBytes: 71*40*4 - 1}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse within limits: %v", err)
+	}
+	loader.Limits = Limits{}
+	if _, err = m.Layers[0].GetGrid(); !errors.As(err, &limit) || limit.Limit != "layer bytes" {
+		t.Errorf("Expected layer bytes limit error, got %v", err)
+	}
+	loader.Limits.MaxLayerBytes = 71 * 40 * 4
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse within limits: %v", err)
+	}
+	if _, err = m.Layers[0].GetGrid(); err != nil {
+		t.Errorf("Could not decode within limits: %v", err)
+	}
+}
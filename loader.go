@@ -0,0 +1,252 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A Loader reads maps out of a file system and resolves the files
+// they reference relative to the map's location in that file system.
+type Loader struct {
+	// The file system maps and referenced files are read from.
+	FS fs.FS
+
+	// If set, applied to every map parsed with ApplyTranslations.
+	Translations map[string]string
+
+	// If set, elements not known to this package are kept in the
+	// Unknown fields of their parents and written back on Serialize,
+	// so maps from newer versions of Tiled can be rewritten safely.
+	PreserveUnknown bool
+
+	// If set, maps written by the Java version of Tiled are accepted:
+	// signed gid attributes and property values given as element text
+	// are converted, so archives of old maps can be read and rewritten.
+	TiledJavaQuirks bool
+
+	// If set, ParseMapFile reads the gids of the map's layers from a
+	// decode cache at the map's name with ".cache" appended, if one was
+	// written for the same file contents by Map.WriteDecodeCache.
+	DecodeCache bool
+
+	// Bounds on the resources parsing maps and decoding their layer
+	// data may use, for reading maps from untrusted sources. Layer data
+	// keeps the limits of the loader it was read through.
+	Limits Limits
+
+	// If set, the custom property types of maps read by the loader.
+	// Class properties are resolved to include the defaults of their
+	// class, see Project.ResolveProperty.
+	Project *Project
+}
+
+func NewLoader(fsys fs.FS) *Loader {
+	return &Loader{FS: fsys}
+}
+
+// Parses the map at name, which is a slash separated path within l.FS.
+func (l *Loader) ParseMapFile(name string) (m *Map, err error) {
+	var data []byte
+	if data, err = fs.ReadFile(l.FS, name); err != nil {
+		return
+	}
+	if m, err = parseMap(data, l); err != nil {
+		return
+	}
+	if l.DecodeCache {
+		l.readDecodeCache(name+".cache", data, m)
+	}
+	m.BaseDir = path.Dir(name)
+	m.Loader = l
+	err = l.applyOptions(m)
+	return
+}
+
+// Parses a map read from r, such as an upload which is not in l.FS,
+// with the options and Limits of l. MaxMapBytes also bounds the data
+// read from r. Paths in the map are not resolved through l, which may
+// have no FS.
+func (l *Loader) ParseMapReader(r io.Reader) (m *Map, err error) {
+	var data []byte
+	if data, err = readLimited(r, "map bytes", l.Limits.MaxMapBytes); err != nil {
+		return
+	}
+	if m, err = parseMap(data, l); err != nil {
+		return
+	}
+	err = l.applyOptions(m)
+	return
+}
+
+// Like ParseMapReader, for a map held in a string.
+func (l *Loader) ParseMapString(data string) (m *Map, err error) {
+	return l.ParseMapReader(strings.NewReader(data))
+}
+
+// Resolves the properties of m against the Project of l and applies
+// its Translations.
+func (l *Loader) applyOptions(m *Map) (err error) {
+	if l.Project != nil {
+		m.Project = l.Project
+		if err = m.ResolveProperties(l.Project); err != nil {
+			return
+		}
+	}
+	if l.Translations != nil {
+		m.ApplyTranslations(l.Translations)
+	}
+	return
+}
+
+// Parses the external tileset (TSX file) at name, which is a slash
+// separated path within l.FS. Image sources in the tileset remain
+// relative to the tileset file.
+func (l *Loader) ParseTilesetFile(name string) (ts *Tileset, err error) {
+	var (
+		data    []byte
+		decoder *xml.Decoder
+	)
+	if data, err = fs.ReadFile(l.FS, name); err != nil {
+		return
+	}
+	if decoder, err = newMapDecoder(data); err != nil {
+		return
+	}
+	ts = &Tileset{}
+	if err = decoder.Decode(ts); err != nil {
+		return
+	}
+	if !l.PreserveUnknown {
+		ts.Unknown = nil
+	}
+	err = ts.afterDeserialize()
+	return
+}
+
+// Replaces every tileset of the map stored in an external TSX file with
+// the contents of that file, read through l, so the map no longer
+// depends on other files for its tilesets. The firstgid of each tileset
+// is kept, and image sources are rewritten to be relative to the map.
+// Sources are resolved against m.BaseDir, which must be a path within
+// l.FS, as it is for maps read by l.
+func (m *Map) EmbedExternalTilesets(l *Loader) (err error) {
+	for i := 0; i < len(m.Tilesets); i++ {
+		var (
+			ts       = m.Tilesets[i]
+			name     = ts.Source
+			embedded *Tileset
+		)
+		if ts.Source == "" {
+			continue
+		}
+		if !path.IsAbs(name) {
+			name = path.Join(m.BaseDir, name)
+		}
+		if embedded, err = l.ParseTilesetFile(name); err != nil {
+			return m.tilesetError(ts, err)
+		}
+		embedded.FirstGid = ts.FirstGid
+		embedded.Source = ""
+		var dir = path.Dir(ts.Source)
+		rebase(embedded.Image, dir)
+		for j := 0; j < len(embedded.TilesetTile); j++ {
+			rebase(embedded.TilesetTile[j].Image, dir)
+		}
+		m.Tilesets[i] = embedded
+	}
+	return
+}
+
+// Prefixes the relative source of img with dir, the directory of the
+// tileset file relative to the map.
+func rebase(img *Image, dir string) {
+	if img == nil || img.Source == "" || path.IsAbs(img.Source) {
+		return
+	}
+	img.Source = path.Join(dir, img.Source)
+}
+
+// Returns p relative to the directory the map was loaded from.
+// Maps read through a Loader produce slash separated paths within
+// the loader's file system, other maps produce OS paths.
+func (m *Map) ResolvePath(p string) string {
+	if m.Loader != nil {
+		if path.IsAbs(p) {
+			return p
+		}
+		return path.Join(m.BaseDir, p)
+	}
+	p = filepath.FromSlash(p)
+	if filepath.IsAbs(p) || m.BaseDir == "" {
+		return p
+	}
+	return filepath.Join(m.BaseDir, p)
+}
+
+// Opens the file at p, resolved relative to the map.
+func (m *Map) OpenPath(p string) (r io.ReadCloser, err error) {
+	var resolved = m.ResolvePath(p)
+	if m.Loader != nil {
+		return m.Loader.FS.Open(resolved)
+	}
+	return os.Open(resolved)
+}
+
+// Returns the path referenced by a property of type "file",
+// resolved relative to the map.
+func (m *Map) PropertyPath(p Property) (resolved string, err error) {
+	if p.Type != "file" {
+		err = fmt.Errorf("Property %v is not of type file", p.Name)
+		return
+	}
+	resolved = m.ResolvePath(p.Value)
+	return
+}
+
+// Opens the file referenced by a property of type "file".
+func (m *Map) OpenProperty(p Property) (r io.ReadCloser, err error) {
+	if p.Type != "file" {
+		err = fmt.Errorf("Property %v is not of type file", p.Name)
+		return
+	}
+	return m.OpenPath(p.Value)
+}
+
+// Decodes the file referenced by img. PNG, GIF and JPEG images are supported.
+func (m *Map) LoadImage(img *Image) (decoded image.Image, err error) {
+	var r io.ReadCloser
+	if img.Source == "" {
+		err = fmt.Errorf("Embedded images are not supported")
+		return
+	}
+	if r, err = m.OpenPath(img.Source); err != nil {
+		return
+	}
+	defer r.Close()
+	decoded, _, err = image.Decode(r)
+	return
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_FILE_PROPERTY_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="music" type="file" value="../sounds/theme.ogg"/>
+  <property name="title" value="Level 1"/>
+ </properties>
+</map>
+`
+
+const TEST_EXTERNAL_TILESET_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="3" source="../tilesets/terrain.tsx"/>
+ <layer name="ground" width="1" height="1">
+  <data><tile gid="4"/></data>
+ </layer>
+</map>
+`
+
+const TEST_EXTERNAL_TILESET = `
+<?xml version="1.0" encoding="UTF-8"?>
+<tileset name="terrain" tilewidth="16" tileheight="16" tilecount="4" columns="4">
+ <image source="terrain.png" width="64" height="16"/>
+ <tile id="1">
+  <image source="../images/door.png" width="16" height="16"/>
+ </tile>
+</tileset>
+`
+
+func TestEmbedExternalTilesets(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"maps/level.tmx":       &fstest.MapFile{Data: []byte(TEST_EXTERNAL_TILESET_MAP)},
+			"tilesets/terrain.tsx": &fstest.MapFile{Data: []byte(TEST_EXTERNAL_TILESET)},
+		})
+		m   *Map
+		ts  *Tileset
+		err error
+	)
+	if m, err = loader.ParseMapFile("maps/level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.EmbedExternalTilesets(loader); err != nil {
+		t.Fatalf("Could not embed tilesets: %v", err)
+	}
+	ts = m.Tilesets[0]
+	if ts.Source != "" || ts.FirstGid != 3 || ts.Name != "terrain" || ts.TileCount != 4 {
+		t.Errorf("Tileset not embedded: %+v", ts)
+	}
+	if ts.Image.Source != "../tilesets/terrain.png" || ts.TilesetTile[0].Image.Source != "../images/door.png" {
+		t.Errorf("Image sources not rebased: %v %v", ts.Image.Source, ts.TilesetTile[0].Image.Source)
+	}
+	m.Tilesets[0] = &Tileset{FirstGid: 3, Source: "missing.tsx"}
+	if err = m.EmbedExternalTilesets(loader); err == nil {
+		t.Errorf("Expected error embedding missing tileset")
+	}
+}
+
+func TestLoaderFileProperty(t *testing.T) {
+	var (
+		fsys = fstest.MapFS{
+			"maps/level1.tmx":  &fstest.MapFile{Data: []byte(TEST_FILE_PROPERTY_MAP)},
+			"sounds/theme.ogg": &fstest.MapFile{Data: []byte("OggS")},
+		}
+		m    *Map
+		p    string
+		data []byte
+		err  error
+	)
+	if m, err = NewLoader(fsys).ParseMapFile("maps/level1.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if p, err = m.PropertyPath(m.Properties[0]); err != nil {
+		t.Fatalf("Could not resolve property: %v", err)
+	}
+	if p != "sounds/theme.ogg" {
+		t.Errorf("Invalid resolved path: %v", p)
+	}
+	r, err := m.OpenProperty(m.Properties[0])
+	if err != nil {
+		t.Fatalf("Could not open property: %v", err)
+	}
+	defer r.Close()
+	if data, err = ioutil.ReadAll(r); err != nil || string(data) != "OggS" {
+		t.Errorf("Invalid file contents: %v %v", string(data), err)
+	}
+	if _, err = m.PropertyPath(m.Properties[1]); err == nil {
+		t.Errorf("Expected error resolving non-file property")
+	}
+}
+
+func TestResolvePathOS(t *testing.T) {
+	var m = &Map{BaseDir: filepath.Join("assets", "maps")}
+	if p := m.ResolvePath("../sounds/theme.ogg"); p != filepath.Join("assets", "sounds", "theme.ogg") {
+		t.Errorf("Invalid resolved path: %v", p)
+	}
+}
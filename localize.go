@@ -0,0 +1,153 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches placeholders such as ${DIFFICULTY} in property values.
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Collects the translatable strings of the map into a table keyed by
+// the location of each string. Translatable strings are the contents of
+// text objects and the values of properties whose name starts with prefix.
+//
+// Keys have the form "map/<property>", "tileset/<firstgid>/<property>",
+// "tileset/<firstgid>/tile/<tile>/<property>", "layer/<id>/<property>",
+// "imagelayer/<id>/<property>", "objectgroup/<id>/<property>",
+// "object/<id>/<property>" and "object/<id>/text", where id is the
+// unique id of the layer or object, so keys survive renaming and
+// reordering. Layers saved without ids use "#<index>" in place of the id,
+// their position in the map, and objects saved without ids use
+// "#<group index>.<object index>".
+func (m *Map) ExtractStrings(prefix string) (table map[string]string) {
+	table = map[string]string{}
+	m.eachString(prefix, func(key string, value *string) {
+		table[key] = *value
+	})
+	return
+}
+
+// Replaces every string of the map whose key appears in table with the
+// translated value. Keys are the ones produced by ExtractStrings.
+func (m *Map) ApplyTranslations(table map[string]string) {
+	m.eachString("", func(key string, value *string) {
+		if translated, ok := table[key]; ok {
+			*value = translated
+		}
+	})
+}
+
+// Replaces placeholders of the form ${NAME} in the values of every
+// property of the map, its tilesets, layers and objects, including the
+// members of class properties, with vars[NAME]. If text is set, the
+// contents of text objects are expanded as well. Placeholders whose
+// name is not in vars are left in place, and their names are returned
+// in ascending order.
+func (m *Map) SubstituteProperties(vars map[string]string, text bool) (missing []string) {
+	var (
+		unset  = map[string]bool{}
+		expand func(value *string)
+		member func(prop *Property)
+	)
+	expand = func(value *string) {
+		*value = placeholder.ReplaceAllStringFunc(*value, func(match string) string {
+			var name = match[2 : len(match)-1]
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			unset[name] = true
+			return match
+		})
+	}
+	member = func(prop *Property) {
+		expand(&prop.Value)
+		if prop.Members != nil {
+			for i := 0; i < len(prop.Members.Properties); i++ {
+				member(&prop.Members.Properties[i])
+			}
+		}
+	}
+	m.eachProperty(func(element string, prop *Property) error {
+		member(prop)
+		return nil
+	})
+	if text {
+		m.EachObject(func(g *ObjectGroup, o *Object) error {
+			if o.Text != nil {
+				expand(&o.Text.Contents)
+			}
+			return nil
+		})
+	}
+	for name := range unset {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return
+}
+
+func (m *Map) eachString(prefix string, fn func(key string, value *string)) {
+	var (
+		props = func(base string, properties []Property) {
+			for i := 0; i < len(properties); i++ {
+				if strings.HasPrefix(properties[i].Name, prefix) {
+					fn(base+properties[i].Name, &properties[i].Value)
+				}
+			}
+		}
+		idKey = func(kind string, id int32, position string) string {
+			if id != 0 {
+				return fmt.Sprintf("%v/%v/", kind, id)
+			}
+			return fmt.Sprintf("%v/#%v/", kind, position)
+		}
+	)
+	props("map/", m.Properties)
+	for i := 0; i < len(m.Tilesets); i++ {
+		var (
+			ts   = m.Tilesets[i]
+			base = fmt.Sprintf("tileset/%v/", ts.FirstGid)
+		)
+		props(base, ts.Properties)
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			props(fmt.Sprintf("%vtile/%v/", base, ts.TilesetTile[j].Id), ts.TilesetTile[j].Properties)
+		}
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		props(idKey("layer", m.Layers[i].Id, fmt.Sprint(i)), m.Layers[i].Properties)
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		props(idKey("imagelayer", m.ImageLayers[i].Id, fmt.Sprint(i)), m.ImageLayers[i].Properties)
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var group = m.ObjectGroups[i]
+		props(idKey("objectgroup", group.Id, fmt.Sprint(i)), group.Properties)
+		for j := 0; j < len(group.Objects); j++ {
+			var (
+				o    = &group.Objects[j]
+				base = idKey("object", o.Id, fmt.Sprintf("%v.%v", i, j))
+			)
+			props(base, o.Properties)
+			if o.Text != nil {
+				fn(base+"text", &o.Text.Contents)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_LOCALIZE_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="l10n_title" value="The Caves"/>
+  <property name="difficulty" value="3"/>
+ </properties>
+ <tileset firstgid="1" name="caves" tilewidth="16" tileheight="16">
+  <properties>
+   <property name="l10n_name" value="Caves"/>
+  </properties>
+  <tile id="2">
+   <properties>
+    <property name="l10n_name" value="Stalagmite"/>
+   </properties>
+  </tile>
+ </tileset>
+ <layer id="1" name="a/b" width="1" height="1">
+  <properties>
+   <property name="l10n_label" value="First"/>
+  </properties>
+  <data><tile gid="0"/></data>
+ </layer>
+ <layer id="2" name="a/b" width="1" height="1">
+  <properties>
+   <property name="l10n_label" value="Second"/>
+  </properties>
+  <data><tile gid="0"/></data>
+ </layer>
+ <objectgroup id="3" name="signs">
+  <object id="5" name="sign" x="0" y="0" width="64" height="16">
+   <properties>
+    <property name="l10n_hint" value="Press up"/>
+   </properties>
+   <text wrap="1">Welcome!</text>
+  </object>
+  <object name="old" x="0" y="0">
+   <text>Legacy</text>
+  </object>
+ </objectgroup>
+</map>
+`
+
+func TestExtractStrings(t *testing.T) {
+	var (
+		m     *Map
+		table map[string]string
+		err   error
+	)
+	if m, err = ParseMapString(TEST_LOCALIZE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	table = m.ExtractStrings("l10n_")
+	for key, want := range map[string]string{
+		"map/l10n_title":             "The Caves",
+		"tileset/1/l10n_name":        "Caves",
+		"tileset/1/tile/2/l10n_name": "Stalagmite",
+		"layer/1/l10n_label":         "First",
+		"layer/2/l10n_label":         "Second",
+		"object/5/l10n_hint":         "Press up",
+		"object/5/text":              "Welcome!",
+		"object/#0.1/text":           "Legacy",
+	} {
+		if table[key] != want {
+			t.Errorf("Invalid value for %v: %v", key, table[key])
+		}
+	}
+	if len(table) != 8 {
+		t.Errorf("Invalid table: %v", table)
+	}
+}
+
+func TestLoaderTranslations(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_LOCALIZE_MAP)},
+		})
+		m   *Map
+		err error
+	)
+	loader.Translations = map[string]string{
+		"map/l10n_title": "Les Grottes",
+		"object/5/text":  "Bienvenue !",
+	}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Properties[0].Value != "Les Grottes" {
+		t.Errorf("Title not translated: %v", m.Properties[0].Value)
+	}
+	if m.Properties[1].Value != "3" {
+		t.Errorf("Untranslated property changed: %v", m.Properties[1].Value)
+	}
+	if m.ObjectGroups[0].Objects[0].Text.Contents != "Bienvenue !" {
+		t.Errorf("Text not translated: %v", m.ObjectGroups[0].Objects[0].Text.Contents)
+	}
+}
+
+const TEST_SUBSTITUTE_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="spawns" value="${DIFFICULTY}x${WAVES}"/>
+  <property name="price" value="$5"/>
+ </properties>
+ <objectgroup name="signs">
+  <object name="sign" x="0" y="0" width="64" height="16">
+   <properties>
+    <property name="enemy" type="class" propertytype="Enemy">
+     <properties>
+      <property name="health" value="${HEALTH}"/>
+     </properties>
+    </property>
+   </properties>
+   <text>Mode: ${MODE}</text>
+  </object>
+ </objectgroup>
+</map>
+`
+
+func TestSubstituteProperties(t *testing.T) {
+	var (
+		m       *Map
+		object  *Object
+		missing []string
+		err     error
+	)
+	if m, err = ParseMapString(TEST_SUBSTITUTE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	object = &m.ObjectGroups[0].Objects[0]
+	missing = m.SubstituteProperties(map[string]string{"DIFFICULTY": "hard", "HEALTH": "10", "MODE": "arcade"}, false)
+	if len(missing) != 1 || missing[0] != "WAVES" {
+		t.Errorf("Invalid missing names: %v", missing)
+	}
+	if m.Properties[0].Value != "hardx${WAVES}" || m.Properties[1].Value != "$5" {
+		t.Errorf("Invalid map properties: %v %v", m.Properties[0].Value, m.Properties[1].Value)
+	}
+	if v := object.Properties[0].Members.Properties[0].Value; v != "10" {
+		t.Errorf("Class member not substituted: %v", v)
+	}
+	if object.Text.Contents != "Mode: ${MODE}" {
+		t.Errorf("Text substituted without text set: %v", object.Text.Contents)
+	}
+	m.SubstituteProperties(map[string]string{"MODE": "arcade"}, true)
+	if object.Text.Contents != "Mode: arcade" {
+		t.Errorf("Text not substituted: %v", object.Text.Contents)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+// An estimate of the memory, in bytes, a map takes up once decoded.
+type MemoryEstimate struct {
+	// The grids of every layer, as returned by Layer.GetGrid.
+	Grids int64
+
+	// The tiles of every layer, as returned by Map.TilesFromLayerIndex.
+	Tiles int64
+
+	// The images of tilesets, tiles and image layers decoded to RGBA.
+	// Images sharing a source are counted once.
+	Images int64
+
+	// The number of images whose size could not be determined, which
+	// are not included in Images.
+	UnknownImages int
+}
+
+// Returns the sum of the estimates.
+func (e MemoryEstimate) Total() int64 {
+	return e.Grids + e.Tiles + e.Images
+}
+
+// Estimates the memory the map takes up once decoded for rendering,
+// so it can be budgeted for before loading on a device. The layer data
+// is decoded to count its tiles. Image sizes are taken from the width
+// and height attributes where set, and read from the image header
+// otherwise.
+func (m *Map) EstimateMemory() (e MemoryEstimate, err error) {
+	var (
+		cell   = int64(unsafe.Sizeof(DataTileGridTile{}))
+		column = int64(unsafe.Sizeof([]DataTileGridTile{}))
+		tile   = int64(unsafe.Sizeof(Tile{}))
+		ptr    = int64(unsafe.Sizeof(&Tile{}))
+		seen   = map[string]bool{}
+		grid   DataTileGrid
+	)
+	for i := 0; i < len(m.Layers); i++ {
+		if grid, err = m.Layers[i].GetGrid(); err != nil {
+			err = m.layerError(m.Layers[i], err)
+			return
+		}
+		e.Grids += int64(grid.Width)*int64(grid.Height)*cell + int64(grid.Width)*column
+		e.Tiles += int64(grid.Width) * int64(grid.Height) * ptr
+		for x := 0; x < grid.Width; x++ {
+			for y := 0; y < grid.Height; y++ {
+				if grid.Tiles[x][y].Id != 0 {
+					e.Tiles += tile
+				}
+			}
+		}
+	}
+	var add = func(img *Image) {
+		if img == nil {
+			return
+		}
+		if img.Source != "" {
+			var resolved = m.ResolvePath(img.Source)
+			if seen[resolved] {
+				return
+			}
+			seen[resolved] = true
+		}
+		var w, h = int64(img.Width), int64(img.Height)
+		if w <= 0 || h <= 0 {
+			var config, err = m.imageConfig(img)
+			if err != nil {
+				e.UnknownImages++
+				return
+			}
+			w, h = int64(config.Width), int64(config.Height)
+		}
+		e.Images += w * h * 4
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		add(m.Tilesets[i].Image)
+		for j := 0; j < len(m.Tilesets[i].TilesetTile); j++ {
+			add(m.Tilesets[i].TilesetTile[j].Image)
+		}
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		add(m.ImageLayers[i].Image)
+	}
+	return
+}
+
+// Reads the dimensions of the file referenced by img from its header.
+func (m *Map) imageConfig(img *Image) (config image.Config, err error) {
+	var r io.ReadCloser
+	if img.Source == "" {
+		err = fmt.Errorf("Embedded images are not supported")
+		return
+	}
+	if r, err = m.OpenPath(img.Source); err != nil {
+		return
+	}
+	defer r.Close()
+	config, _, err = image.DecodeConfig(r)
+	return
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+	"testing/fstest"
+	"unsafe"
+)
+
+const TEST_MEMORY_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="a" tilewidth="16" tileheight="16">
+  <image source="strip.png"/>
+ </tileset>
+ <tileset firstgid="5" name="b" tilewidth="16" tileheight="16">
+  <image source="strip.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ground" width="2" height="1">
+  <data><tile gid="2"/><tile gid="0"/></data>
+ </layer>
+ <imagelayer name="sky">
+  <image source="missing.png"/>
+ </imagelayer>
+</map>
+`
+
+func TestEstimateMemory(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_MEMORY_MAP)},
+			"strip.png": &fstest.MapFile{Data: testStripPNG(t, 4)},
+		})
+		m    *Map
+		e    MemoryEstimate
+		grid = int64(2*unsafe.Sizeof(DataTileGridTile{}) + 2*unsafe.Sizeof([]DataTileGridTile{}))
+		tile = int64(2*unsafe.Sizeof(&Tile{}) + unsafe.Sizeof(Tile{}))
+		err  error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if e, err = m.EstimateMemory(); err != nil {
+		t.Fatalf("Could not estimate: %v", err)
+	}
+	if e.Grids != grid || e.Tiles != tile {
+		t.Errorf("Invalid layer estimate: %+v", e)
+	}
+	if e.Images != 64*16*4 || e.UnknownImages != 1 {
+		t.Errorf("Invalid image estimate: %+v", e)
+	}
+	if e.Total() != grid+tile+64*16*4 {
+		t.Errorf("Invalid total: %v", e.Total())
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMapFileMapped(t *testing.T) {
+	var (
+		filename = filepath.Join(t.TempDir(), "level.tmx")
+		m        *Map
+		err      error
+	)
+	if err = ioutil.WriteFile(filename, []byte(TEST_MAP), 0644); err != nil {
+		t.Fatalf("Could not write map: %v", err)
+	}
+	if m, err = ParseMapFileMapped(filename); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Width != 71 || len(m.Layers) != 2 || m.Layers[1].Name != "Stars" {
+		t.Errorf("Invalid map: %v", m)
+	}
+	if m.BaseDir != filepath.Dir(filename) {
+		t.Errorf("Invalid base dir: %v", m.BaseDir)
+	}
+}
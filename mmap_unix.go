@@ -0,0 +1,55 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package tmxgo
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Like ParseMapFile, but maps the file into memory and parses it from
+// there instead of reading it onto the heap first. Useful for very large
+// maps on memory constrained platforms. The map does not keep references
+// to the file contents, which are unmapped before returning.
+func ParseMapFileMapped(filename string) (m *Map, err error) {
+	var (
+		f    *os.File
+		info os.FileInfo
+		data []byte
+	)
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	if info, err = f.Stat(); err != nil {
+		return
+	}
+	if info.Size() == 0 {
+		return ParseMapFile(filename)
+	}
+	if data, err = syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED); err != nil {
+		return
+	}
+	defer syscall.Munmap(data)
+	if m, err = parseMap(data, nil); err != nil {
+		return
+	}
+	m.BaseDir = filepath.Dir(filename)
+	return
+}
@@ -0,0 +1,52 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/xml"
+)
+
+// An XML element not known to this package, kept along with its
+// attributes, text and children so it can be written back unchanged.
+type Node struct {
+	XMLName xml.Name
+
+	Attrs []xml.Attr `xml:",any,attr"`
+
+	Contents string `xml:",chardata"`
+
+	Nodes []*Node `xml:",any"`
+}
+
+// Drops the unrecognized elements of the map and everything in it.
+func (m *Map) dropUnknown() {
+	m.Unknown = nil
+	for i := 0; i < len(m.Tilesets); i++ {
+		m.Tilesets[i].Unknown = nil
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		m.Layers[i].Unknown = nil
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		m.ImageLayers[i].Unknown = nil
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = m.ObjectGroups[i]
+		g.Unknown = nil
+		for j := 0; j < len(g.Objects); j++ {
+			g.Objects[j].Unknown = nil
+		}
+	}
+}
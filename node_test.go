@@ -0,0 +1,70 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_UNKNOWN_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <overview scale="2">
+  <zoom level="3"/>
+ </overview>
+ <layer name="ground" width="1" height="1">
+  <data><tile gid="0"/></data>
+  <future kind="new">text</future>
+ </layer>
+</map>
+`
+
+func TestPreserveUnknown(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_UNKNOWN_MAP)},
+		})
+		m   *Map
+		out string
+		err error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if len(m.Unknown) != 0 || len(m.Layers[0].Unknown) != 0 {
+		t.Errorf("Unknown elements kept by default")
+	}
+	loader.PreserveUnknown = true
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if len(m.Unknown) != 1 || m.Unknown[0].XMLName.Local != "overview" || len(m.Unknown[0].Nodes) != 1 {
+		t.Fatalf("Unknown map element not kept: %v", m.Unknown)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	for _, s := range []string{
+		`<overview scale="2">`,
+		`<zoom level="3"></zoom>`,
+		`<future kind="new">text</future>`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Missing %v in %v", s, out)
+		}
+	}
+}
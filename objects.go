@@ -0,0 +1,437 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// An object along with the object group containing it.
+type GroupObject struct {
+	Group  *ObjectGroup
+	Object *Object
+}
+
+// Returns every object of the map paired with its group, in document order.
+func (m *Map) AllObjects() (objects []GroupObject) {
+	m.EachObject(func(g *ObjectGroup, o *Object) error {
+		objects = append(objects, GroupObject{g, o})
+		return nil
+	})
+	return
+}
+
+// Calls fn with every object of the map and the group containing it,
+// in document order. Iteration stops at the first error fn returns,
+// which is passed on to the caller.
+func (m *Map) EachObject(fn func(g *ObjectGroup, o *Object) error) (err error) {
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = m.ObjectGroups[i]
+		for j := 0; j < len(g.Objects); j++ {
+			if err = fn(g, &g.Objects[j]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Returns the group of m containing o, or nil if o is not in m.
+func (m *Map) objectGroup(o *Object) *ObjectGroup {
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = m.ObjectGroups[i]
+		for j := 0; j < len(g.Objects); j++ {
+			if &g.Objects[j] == o {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the area of the map objects may be placed in, in map pixels.
+// Object coordinates on isometric maps measure both axes in tile heights,
+// on other maps they are screen pixels.
+func (m *Map) objectArea() Bounds {
+	if _, ok := m.layout().(isometric); ok {
+		return Bounds{W: float32(m.Width * m.TileHeight), H: float32(m.Height * m.TileHeight)}
+	}
+	var w, h = m.PixelSize()
+	return Bounds{W: w, H: h}
+}
+
+// Returns the objects of the map that extend beyond its edges, taking
+// their rotation and the offset of their group into account. Objects
+// dragged off the map by accident are easy to miss in the editor, where
+// they only show up as triggers that never fire. Infinite maps have no
+// edges, so none of their objects are returned.
+func (m *Map) ObjectsOutOfBounds() (objects []GroupObject, err error) {
+	if m.Infinite {
+		return
+	}
+	var area = m.objectArea()
+	err = m.EachObject(func(g *ObjectGroup, o *Object) (err error) {
+		var b Bounds
+		if b, err = g.WorldBounds(o); err != nil {
+			return
+		}
+		if b.X < area.X || b.Y < area.Y || b.X+b.W > area.X+area.W || b.Y+b.H > area.Y+area.H {
+			objects = append(objects, GroupObject{g, o})
+		}
+		return
+	})
+	return
+}
+
+// Moves every object extending beyond the edges of the map the shortest
+// distance that brings it back within them. Objects larger than the map
+// are aligned with its top left corner. Returns the objects moved.
+func (m *Map) ClampObjects() (moved []GroupObject, err error) {
+	var area = m.objectArea()
+	if moved, err = m.ObjectsOutOfBounds(); err != nil {
+		return
+	}
+	var shift = func(min, size, lo, hi float32) int32 {
+		switch {
+		case min < lo || size > hi-lo:
+			return int32(math.Ceil(float64(lo - min)))
+		case min+size > hi:
+			return int32(math.Floor(float64(hi - min - size)))
+		}
+		return 0
+	}
+	for i := 0; i < len(moved); i++ {
+		var (
+			o = moved[i].Object
+			b Bounds
+		)
+		if b, err = moved[i].Group.WorldBounds(o); err != nil {
+			return
+		}
+		o.X += shift(b.X, b.W, area.X, area.X+area.W)
+		o.Y += shift(b.Y, b.H, area.Y, area.Y+area.H)
+	}
+	return
+}
+
+// Creates a layer the size of m where every cell whose center lies within
+// an object of the group, shifted by the group's offset, is set to the
+// gid gidFor returns for that object.
+// Rectangles, ellipses, polygons and tile objects are rasterized, taking
+// their rotation into account. Objects for which gidFor returns 0 are
+// skipped, and later objects overwrite earlier ones where they overlap.
+func (g *ObjectGroup) Rasterize(m *Map, gidFor func(o *Object) uint32) (l *Layer, err error) {
+	var (
+		grid   = NewDataTileGrid(int(m.Width), int(m.Height))
+		tw, th = float32(m.TileWidth), float32(m.TileHeight)
+	)
+	if tw <= 0 || th <= 0 {
+		err = fmt.Errorf("Invalid tile size %vx%v", m.TileWidth, m.TileHeight)
+		return
+	}
+	for i := 0; i < len(g.Objects); i++ {
+		var (
+			o      = &g.Objects[i]
+			gid    = gidFor(o)
+			points []Point
+			b      Bounds
+		)
+		if gid == 0 || o.Polyline != nil {
+			continue
+		}
+		if o.Polygon != nil {
+			if points, err = o.Polygon.Points(); err != nil {
+				return
+			}
+		}
+		if b, err = g.WorldBounds(o); err != nil {
+			return
+		}
+		// Only the cells under the bounds of the object can hold it.
+		var (
+			x0 = maxInt(int(math.Floor(float64(b.X/tw))), 0)
+			y0 = maxInt(int(math.Floor(float64(b.Y/th))), 0)
+			x1 = minInt(int(math.Ceil(float64((b.X+b.W)/tw))), grid.Width-1)
+			y1 = minInt(int(math.Ceil(float64((b.Y+b.H)/th))), grid.Height-1)
+		)
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				var p = Point{
+					X: (float32(x)+0.5)*tw - g.OffsetX,
+					Y: (float32(y)+0.5)*th - g.OffsetY,
+				}
+				if o.contains(p, points) {
+					grid.Tiles[x][y] = gridTile(gid)
+				}
+			}
+		}
+	}
+	return NewLayer(g.Name, grid)
+}
+
+// Returns whether the map space point p lies within the object.
+// The points argument holds the parsed points of polygon objects.
+func (o *Object) contains(p Point, points []Point) bool {
+	var local = o.toLocal(p)
+	switch {
+	case o.Polygon != nil:
+		return pointInPolygon(local, points)
+	case o.Ellipse != nil:
+		if o.Width <= 0 || o.Height <= 0 {
+			return false
+		}
+		var (
+			rx, ry = float64(o.Width) / 2, float64(o.Height) / 2
+			dx, dy = (float64(local.X) - rx) / rx, (float64(local.Y) - ry) / ry
+		)
+		return dx*dx+dy*dy <= 1
+	case o.Gid != nil:
+		// Tile objects are anchored at their bottom left corner.
+		return local.X >= 0 && local.X < float32(o.Width) &&
+			local.Y >= -float32(o.Height) && local.Y < 0
+	default:
+		return local.X >= 0 && local.X < float32(o.Width) &&
+			local.Y >= 0 && local.Y < float32(o.Height)
+	}
+}
+
+// Converts a map space point into the object's unrotated local space,
+// which has its origin at the object's position.
+func (o *Object) toLocal(p Point) Point {
+	var (
+		dx, dy = float64(p.X - float32(o.X)), float64(p.Y - float32(o.Y))
+		theta  = -float64(o.Rotation) * math.Pi / 180
+		sin    = math.Sin(theta)
+		cos    = math.Cos(theta)
+	)
+	return Point{
+		X: float32(dx*cos - dy*sin),
+		Y: float32(dx*sin + dy*cos),
+	}
+}
+
+// Even-odd test of whether p lies within the polygon.
+func pointInPolygon(p Point, polygon []Point) (inside bool) {
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		var a, b = polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return
+}
+
+// Resolves the tile a tile object refers to, with the flips of its gid
+// applied. TileBounds holds the rectangle covered by the object in map
+// pixels with the origin at the top left, positioned according to the
+// tileset's objectalignment, where "unspecified" is treated as
+// "bottomleft" as on orthogonal maps. Use DrawBounds to place objects on
+// maps of other orientations.
+func (o *Object) Tile(tilesets []*Tileset) (t *Tile, err error) {
+	return o.tile(tilesets, "")
+}
+
+func (o *Object) tile(tilesets []*Tileset, orientation string) (t *Tile, err error) {
+	var sorted = append([]*Tileset{}, tilesets...)
+	if o.Gid == nil {
+		err = fmt.Errorf("Object %v is not a tile object", o.Name)
+		return
+	}
+	sort.Sort(byFirstGid(sorted))
+	if t, err = newTile(*o.Gid, sorted, Bounds{}, ORIGIN_TOP_LEFT); err != nil {
+		return
+	}
+	var (
+		w, h   = float32(o.Width), float32(o.Height)
+		ax, ay = objectAnchor(t.Tileset.ObjectAlignment, orientation)
+	)
+	if w == 0 || h == 0 {
+		w, h = float32(t.Tileset.TileWidth), float32(t.Tileset.TileHeight)
+	}
+	t.TileBounds = Bounds{
+		X: float32(o.X) - ax*w,
+		Y: float32(o.Y) - ay*h,
+		W: w,
+		H: h,
+	}
+	return
+}
+
+// Returns a key for drawing the objects of m back to front: objects
+// with a lower depth are drawn first. The key is taken at the point of
+// the object nearest to the viewer, which is its lowest point on screen.
+// On orthogonal maps that is the largest Y, on isometric maps, where
+// screen Y grows with the sum of the map coordinates, the largest X+Y.
+// Tile objects use the bottom of their image, found from the tileset's
+// objectalignment.
+func (m *Map) ObjectDepth(o *Object) (depth float32, err error) {
+	var (
+		iso    = m.Orientation == "isometric"
+		points Path
+	)
+	if o.Gid != nil {
+		var t *Tile
+		if t, err = o.tile(m.Tilesets, m.Orientation); err != nil {
+			return
+		}
+		var _, ay = objectAnchor(t.Tileset.ObjectAlignment, m.Orientation)
+		// The distance from the anchor down to the bottom of the image
+		// in screen pixels, which are half a map pixel on isometric maps.
+		var foot = (1 - ay) * float32(o.Height)
+		if iso {
+			return float32(o.X+o.Y) + 2*foot, nil
+		}
+		return float32(o.Y) + foot, nil
+	}
+	if points, err = o.MapPoints(); err != nil {
+		return
+	}
+	for i := 0; i < len(points); i++ {
+		var d = points[i].Y
+		if iso {
+			d += points[i].X
+		}
+		if i == 0 || d > depth {
+			depth = d
+		}
+	}
+	return
+}
+
+// Returns every object of the map in the order to draw them in, back to
+// front by ObjectDepth. Objects of equal depth keep document order.
+func (m *Map) DrawOrder() (objects []GroupObject, err error) {
+	var depths = map[*Object]float32{}
+	objects = m.AllObjects()
+	for i := 0; i < len(objects); i++ {
+		if depths[objects[i].Object], err = m.ObjectDepth(objects[i].Object); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(objects, func(a, b int) bool {
+		return depths[objects[a].Object] < depths[objects[b].Object]
+	})
+	return
+}
+
+// Returns the position of a tile object's anchor point within its
+// rectangle, as fractions of its width and height from the top left.
+func objectAnchor(alignment, orientation string) (ax, ay float32) {
+	switch alignment {
+	case "topleft":
+		return 0, 0
+	case "top":
+		return 0.5, 0
+	case "topright":
+		return 1, 0
+	case "left":
+		return 0, 0.5
+	case "center":
+		return 0.5, 0.5
+	case "right":
+		return 1, 0.5
+	case "bottom":
+		return 0.5, 1
+	case "bottomright":
+		return 1, 1
+	case "bottomleft":
+		return 0, 1
+	}
+	if orientation == "isometric" {
+		return 0.5, 1
+	}
+	return 0, 1
+}
+
+// Where and how to draw a tile object on screen.
+type ObjectDraw struct {
+	// The unrotated rectangle covered by the tile image, in map pixels
+	// relative to the map's Origin.
+	Bounds Bounds
+
+	// The point the image is rotated around, which is the object's position.
+	Anchor Point
+
+	// The rotation of the image around Anchor, in degrees clockwise.
+	Rotation float32
+
+	// The corners of the rotated image, in the order top-left, top-right,
+	// bottom-right, bottom-left of the unrotated image.
+	Corners [4]Point
+
+	// The factors the tile image is scaled by to fill Bounds.
+	ScaleX, ScaleY float32
+}
+
+// Computes the on-screen placement of a tile object. The tile image is
+// anchored at the object's position according to the tileset's
+// objectalignment, which defaults to the bottom left on orthogonal maps
+// and the bottom center on isometric ones, scaled to the object's width
+// and height, and rotated around the anchor by the object's rotation.
+// The offset of the object group containing o is applied.
+func (o *Object) DrawBounds(m *Map) (d ObjectDraw, err error) {
+	var (
+		t      *Tile
+		anchor = m.projectPixel(Point{float32(o.X), float32(o.Y)})
+	)
+	if g := m.objectGroup(o); g != nil {
+		anchor.X += g.OffsetX
+		anchor.Y += g.OffsetY
+	}
+	if t, err = o.tile(m.Tilesets, m.Orientation); err != nil {
+		return
+	}
+	d = ObjectDraw{
+		Bounds: Bounds{
+			X: anchor.X + t.TileBounds.X - float32(o.X),
+			Y: anchor.Y + t.TileBounds.Y - float32(o.Y),
+			W: t.TileBounds.W,
+			H: t.TileBounds.H,
+		},
+		Anchor:   anchor,
+		Rotation: float32(o.Rotation),
+		ScaleX:   1,
+		ScaleY:   1,
+	}
+	if t.Tileset.TileWidth > 0 && t.Tileset.TileHeight > 0 {
+		d.ScaleX = d.Bounds.W / float32(t.Tileset.TileWidth)
+		d.ScaleY = d.Bounds.H / float32(t.Tileset.TileHeight)
+	}
+	var (
+		b     = d.Bounds
+		theta = float64(o.Rotation) * math.Pi / 180
+		sin   = float32(math.Sin(theta))
+		cos   = float32(math.Cos(theta))
+	)
+	for i, c := range [4]Point{{b.X, b.Y}, {b.X + b.W, b.Y}, {b.X + b.W, b.Y + b.H}, {b.X, b.Y + b.H}} {
+		var dx, dy = c.X - anchor.X, c.Y - anchor.Y
+		d.Corners[i] = Point{
+			X: anchor.X + dx*cos - dy*sin,
+			Y: anchor.Y + dx*sin + dy*cos,
+		}
+	}
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		var height = m.screenHeight()
+		d.Bounds.Y = height - d.Bounds.Y - d.Bounds.H
+		d.Anchor.Y = height - d.Anchor.Y
+		for i := 0; i < len(d.Corners); i++ {
+			d.Corners[i].Y = height - d.Corners[i].Y
+		}
+	}
+	return
+}
@@ -0,0 +1,371 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+const TEST_OBJECTS_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="4" height="4" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="sprites" tilewidth="16" tileheight="16">
+  <image source="sprites.png" width="64" height="16"/>
+ </tileset>
+ <objectgroup name="triggers">
+  <object name="door" type="warp" x="16" y="0" width="16" height="32"/>
+  <object name="lake" x="0" y="32">
+   <polygon points="0,0 32,0 32,16 0,16"/>
+  </object>
+ </objectgroup>
+ <objectgroup name="items">
+  <object name="chest" x="32" y="48" width="16" height="16" gid="3"/>
+ </objectgroup>
+</map>
+`
+
+func TestAllObjects(t *testing.T) {
+	var (
+		m       *Map
+		objects []GroupObject
+		err     error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	objects = m.AllObjects()
+	if len(objects) != 3 {
+		t.Fatalf("Wrong number of objects: %v", len(objects))
+	}
+	if objects[2].Group.Name != "items" || objects[2].Object.Name != "chest" {
+		t.Errorf("Wrong pairing: %v %v", objects[2].Group.Name, objects[2].Object.Name)
+	}
+	objects[0].Object.Name = "renamed"
+	if m.ObjectGroups[0].Objects[0].Name != "renamed" {
+		t.Errorf("Objects not returned by reference")
+	}
+	var count = 0
+	err = m.EachObject(func(g *ObjectGroup, o *Object) error {
+		if count++; count == 2 {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	if err == nil || count != 2 {
+		t.Errorf("Iteration did not stop: %v %v", err, count)
+	}
+}
+
+func TestRasterize(t *testing.T) {
+	var (
+		m     *Map
+		layer *Layer
+		grid  DataTileGrid
+		err   error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	layer, err = m.ObjectGroups[0].Rasterize(m, func(o *Object) uint32 {
+		if o.Name == "lake" {
+			return 2
+		}
+		return 1
+	})
+	if err != nil {
+		t.Fatalf("Could not rasterize: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	var want = [4][4]uint32{
+		{0, 1, 0, 0},
+		{0, 1, 0, 0},
+		{2, 2, 0, 0},
+		{0, 0, 0, 0},
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if grid.Tiles[x][y].Id != want[y][x] {
+				t.Errorf("Wrong tile at %v,%v: %v", x, y, grid.Tiles[x][y].Id)
+			}
+		}
+	}
+	if layer, err = m.ObjectGroups[1].Rasterize(m, func(o *Object) uint32 { return 3 }); err != nil {
+		t.Fatalf("Could not rasterize: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[2][2].Id != 3 || grid.Tiles[2][3].Id != 0 {
+		t.Errorf("Tile object not anchored at bottom left")
+	}
+	var g = &ObjectGroup{Name: "shifted", OffsetX: 32, OffsetY: 32, Objects: []Object{
+		{Name: "box", X: -16, Y: -16, Width: 32, Height: 32},
+		{Name: "far", X: 1000, Y: -1000, Width: 16, Height: 16},
+	}}
+	if layer, err = g.Rasterize(m, func(o *Object) uint32 { return 1 }); err != nil {
+		t.Fatalf("Could not rasterize: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			var want uint32
+			if x >= 1 && x <= 2 && y >= 1 && y <= 2 {
+				want = 1
+			}
+			if grid.Tiles[x][y].Id != want {
+				t.Errorf("Wrong offset tile at %v,%v: %v", x, y, grid.Tiles[x][y].Id)
+			}
+		}
+	}
+}
+
+func TestObjectTile(t *testing.T) {
+	var (
+		m    *Map
+		tile *Tile
+		gid  = uint32(3) | FLIPPED_H_FLAG
+		err  error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var chest = &m.ObjectGroups[1].Objects[0]
+	if tile, err = chest.Tile(m.Tilesets); err != nil {
+		t.Fatalf("Could not resolve tile: %v", err)
+	}
+	if tile.Index != 2 || tile.Tileset.Name != "sprites" {
+		t.Errorf("Wrong tile: %v %v", tile.Index, tile.Tileset.Name)
+	}
+	if tile.TileBounds != (Bounds{32, 32, 16, 16}) {
+		t.Errorf("Wrong bounds: %v", tile.TileBounds)
+	}
+	chest.Gid = &gid
+	m.Tilesets[0].ObjectAlignment = "center"
+	if tile, err = chest.Tile(m.Tilesets); err != nil {
+		t.Fatalf("Could not resolve tile: %v", err)
+	}
+	if !tile.FlipHorz || tile.TileBounds != (Bounds{24, 40, 16, 16}) {
+		t.Errorf("Wrong flipped, centered tile: %v %v", tile.FlipHorz, tile.TileBounds)
+	}
+	if _, err = m.ObjectGroups[0].Objects[0].Tile(m.Tilesets); err == nil {
+		t.Errorf("Expected error resolving non-tile object")
+	}
+}
+
+func TestObjectDrawBounds(t *testing.T) {
+	var (
+		m   *Map
+		d   ObjectDraw
+		err error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	var chest = &m.ObjectGroups[1].Objects[0]
+	chest.Width = 32
+	chest.Rotation = 90
+	if d, err = chest.DrawBounds(m); err != nil {
+		t.Fatalf("Could not place object: %v", err)
+	}
+	if d.Bounds != (Bounds{32, 32, 32, 16}) || d.ScaleX != 2 || d.ScaleY != 1 {
+		t.Errorf("Wrong bounds: %v %v %v", d.Bounds, d.ScaleX, d.ScaleY)
+	}
+	if d.Anchor != (Point{32, 48}) {
+		t.Errorf("Wrong anchor: %v", d.Anchor)
+	}
+	var want = [4]Point{{48, 48}, {48, 80}, {32, 80}, {32, 48}}
+	for i := 0; i < 4; i++ {
+		if math.Abs(float64(d.Corners[i].X-want[i].X)) > 1e-4 ||
+			math.Abs(float64(d.Corners[i].Y-want[i].Y)) > 1e-4 {
+			t.Errorf("Wrong rotated corner %v: %v", i, d.Corners[i])
+		}
+	}
+	m.Orientation = "isometric"
+	m.TileWidth = 32
+	chest.Rotation = 0
+	if d, err = chest.DrawBounds(m); err != nil {
+		t.Fatalf("Could not place object: %v", err)
+	}
+	// (32, 48) is grid position (2, 3), which is drawn at (48, 40).
+	if d.Anchor != (Point{48, 40}) || d.Bounds != (Bounds{32, 24, 32, 16}) {
+		t.Errorf("Wrong isometric placement: %v %v", d.Anchor, d.Bounds)
+	}
+}
+
+func TestObjectGroupOffset(t *testing.T) {
+	var (
+		data = strings.Replace(TEST_OBJECTS_MAP, `<objectgroup name="items">`,
+			`<objectgroup name="items" offsetx="16" offsety="-16" parallaxx="0.5">`, 1)
+		m     *Map
+		g     *ObjectGroup
+		b     Bounds
+		d     ObjectDraw
+		layer *Layer
+		grid  DataTileGrid
+		out   string
+		err   error
+	)
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	g = m.ObjectGroups[1]
+	if g.OffsetX != 16 || g.OffsetY != -16 || g.ParallaxX != 0.5 || g.ParallaxY != 1 {
+		t.Errorf("Invalid offset or parallax: %v,%v %v,%v", g.OffsetX, g.OffsetY, g.ParallaxX, g.ParallaxY)
+	}
+	if m.ObjectGroups[0].ParallaxX != 1 || m.ObjectGroups[0].ParallaxY != 1 {
+		t.Errorf("Parallax does not default to 1")
+	}
+	m.ObjectGroups = append(m.ObjectGroups, NewObjectGroup("new"))
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `name="new" color="" x="0" y="0" width="0" height="0" opacity="1" visible="true"></objectgroup>`) {
+		t.Errorf("Default parallax written for new object group: %v", out)
+	}
+	m.ObjectGroups = m.ObjectGroups[:2]
+	if b, err = g.WorldBounds(&g.Objects[0]); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{48, 16, 16, 16}) {
+		t.Errorf("Wrong world bounds: %v", b)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if d, err = g.Objects[0].DrawBounds(m); err != nil {
+		t.Fatalf("Could not place object: %v", err)
+	}
+	if d.Anchor != (Point{48, 32}) || d.Bounds != (Bounds{48, 16, 16, 16}) {
+		t.Errorf("Offset not applied to placement: %v %v", d.Anchor, d.Bounds)
+	}
+	if layer, err = g.Rasterize(m, func(o *Object) uint32 { return 3 }); err != nil {
+		t.Fatalf("Could not rasterize: %v", err)
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[3][1].Id != 3 || grid.Tiles[2][2].Id != 0 {
+		t.Errorf("Offset not applied to rasterized tiles")
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `offsetx="16" offsety="-16" parallaxx="0.5">`) || strings.Contains(out, "parallaxy") {
+		t.Errorf("Invalid serialized group: %v", out)
+	}
+}
+
+func TestDrawOrder(t *testing.T) {
+	var (
+		m       *Map
+		objects []GroupObject
+		depth   float32
+		names   []string
+		err     error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var chest = &m.ObjectGroups[1].Objects[0]
+	m.Tilesets[0].ObjectAlignment = "top"
+	if depth, err = m.ObjectDepth(chest); err != nil || depth != 64 {
+		t.Errorf("Wrong orthogonal depth: %v %v", depth, err)
+	}
+	m.Orientation = "isometric"
+	if depth, err = m.ObjectDepth(chest); err != nil || depth != 112 {
+		t.Errorf("Wrong isometric depth: %v %v", depth, err)
+	}
+	chest.Y = 0
+	if objects, err = m.DrawOrder(); err != nil {
+		t.Fatalf("Could not sort objects: %v", err)
+	}
+	for i := 0; i < len(objects); i++ {
+		names = append(names, objects[i].Object.Name)
+	}
+	if strings.Join(names, ",") != "door,chest,lake" {
+		t.Errorf("Wrong draw order: %v", names)
+	}
+}
+
+const TEST_OUT_OF_BOUNDS_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="4" height="4" tilewidth="16" tileheight="16">
+ <objectgroup name="triggers">
+  <object name="inside" x="0" y="0" width="16" height="16"/>
+  <object name="right" x="56" y="0" width="16" height="16"/>
+  <object name="corner" x="-8" y="-4" width="10" height="10"/>
+  <object name="wide" x="10" y="10" width="100" height="10"/>
+ </objectgroup>
+ <objectgroup name="shifted" offsetx="16">
+  <object name="edge" x="48" y="48" width="16" height="16"/>
+ </objectgroup>
+</map>
+`
+
+func TestObjectsOutOfBounds(t *testing.T) {
+	var (
+		m     *Map
+		out   []GroupObject
+		moved []GroupObject
+		err   error
+	)
+	if m, err = ParseMapString(TEST_OUT_OF_BOUNDS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if out, err = m.ObjectsOutOfBounds(); err != nil {
+		t.Fatalf("Could not check bounds: %v", err)
+	}
+	var names []string
+	for i := 0; i < len(out); i++ {
+		names = append(names, out[i].Object.Name)
+	}
+	if strings.Join(names, ",") != "right,corner,wide,edge" {
+		t.Errorf("Wrong objects out of bounds: %v", names)
+	}
+	if errs := m.ValidateObjects(); len(errs) != 4 {
+		t.Errorf("Wrong number of problems: %v", errs)
+	}
+	if moved, err = m.ClampObjects(); err != nil || len(moved) != 4 {
+		t.Fatalf("Could not clamp: %v %v", moved, err)
+	}
+	for i, pos := range [][2]int32{{0, 0}, {48, 0}, {0, 0}, {0, 10}} {
+		if o := m.ObjectGroups[0].Objects[i]; o.X != pos[0] || o.Y != pos[1] {
+			t.Errorf("Object %v at %v,%v, expected %v", o.Name, o.X, o.Y, pos)
+		}
+	}
+	if o := m.ObjectGroups[1].Objects[0]; o.X != 32 || o.Y != 48 {
+		t.Errorf("Object %v at %v,%v, expected 32,48", o.Name, o.X, o.Y)
+	}
+	// Only the object wider than the map can not be brought inside it.
+	if out, _ = m.ObjectsOutOfBounds(); len(out) != 1 || out[0].Object.Name != "wide" {
+		t.Errorf("Objects still out of bounds after clamping: %v", out)
+	}
+	var data = strings.Replace(TEST_OUT_OF_BOUNDS_MAP, `tileheight="16">`, `tileheight="16" infinite="1">`, 1)
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if errs := m.ValidateObjects(); len(errs) != 0 {
+		t.Errorf("Objects of infinite map reported: %v", errs)
+	}
+	if moved, err = m.ClampObjects(); err != nil || len(moved) != 0 {
+		t.Errorf("Objects of infinite map clamped: %v %v", moved, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+)
+
+// Which tiles of a layer are set, computed from its data once and
+// reused until the data changes.
+type layerOccupancy struct {
+	data     *Data
+	contents string
+	rawTiles int
+	count    int
+	bounds   image.Rectangle
+}
+
+func (l *Layer) getOccupancy() (o *layerOccupancy, err error) {
+	var grid DataTileGrid
+	if o = l.occupancy; o != nil && o.data == l.Data && o.contents == l.Data.RawContents && o.rawTiles == len(l.Data.RawTiles) {
+		return
+	}
+	if grid, err = l.GetGrid(); err != nil {
+		return nil, err
+	}
+	o = &layerOccupancy{
+		data:     l.Data,
+		contents: l.Data.RawContents,
+		rawTiles: len(l.Data.RawTiles),
+	}
+	for x := 0; x < grid.Width; x++ {
+		for y := 0; y < grid.Height; y++ {
+			if grid.Tiles[x][y].Id == 0 {
+				continue
+			}
+			var cell = image.Rect(x, y, x+1, y+1)
+			if o.count == 0 {
+				o.bounds = cell
+			} else {
+				o.bounds = o.bounds.Union(cell)
+			}
+			o.count++
+		}
+	}
+	l.occupancy = o
+	return
+}
+
+// Returns whether no tile of the layer is set.
+func (l *Layer) IsEmpty() (empty bool, err error) {
+	var o *layerOccupancy
+	if o, err = l.getOccupancy(); err != nil {
+		return
+	}
+	return o.count == 0, nil
+}
+
+// Returns the number of tiles of the layer that are set.
+func (l *Layer) NonEmptyCount() (count int, err error) {
+	var o *layerOccupancy
+	if o, err = l.getOccupancy(); err != nil {
+		return
+	}
+	return o.count, nil
+}
+
+// Returns the smallest rectangle of tiles, with Y growing down as in
+// TMX files, containing every tile of the layer that is set. Empty
+// layers return an empty rectangle.
+func (l *Layer) OccupiedBounds() (bounds image.Rectangle, err error) {
+	var o *layerOccupancy
+	if o, err = l.getOccupancy(); err != nil {
+		return
+	}
+	return o.bounds, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+	"testing"
+)
+
+func TestLayerOccupancy(t *testing.T) {
+	var (
+		grid   = NewDataTileGrid(4, 3)
+		layer  *Layer
+		empty  bool
+		count  int
+		bounds image.Rectangle
+		err    error
+	)
+	if layer, err = NewLayer("art", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	if empty, err = layer.IsEmpty(); err != nil || !empty {
+		t.Errorf("Expected empty layer: %v", err)
+	}
+	if bounds, err = layer.OccupiedBounds(); err != nil || !bounds.Empty() {
+		t.Errorf("Expected empty bounds: %v %v", bounds, err)
+	}
+	grid.Tiles[1][0].Id = 3
+	grid.Tiles[2][1].Id = 5
+	if err = layer.SetGrid(grid); err != nil {
+		t.Fatalf("Could not set grid: %v", err)
+	}
+	if empty, err = layer.IsEmpty(); err != nil || empty {
+		t.Errorf("Expected non-empty layer: %v", err)
+	}
+	if count, err = layer.NonEmptyCount(); err != nil || count != 2 {
+		t.Errorf("Invalid count: %v %v", count, err)
+	}
+	if bounds, err = layer.OccupiedBounds(); err != nil || bounds != image.Rect(1, 0, 3, 2) {
+		t.Errorf("Invalid bounds: %v %v", bounds, err)
+	}
+	layer.Data.Encoding = ""
+	layer.Data.RawContents = ""
+	layer.Data.RawTiles = make([]DataTile, 12)
+	if empty, err = layer.IsEmpty(); err != nil || !empty {
+		t.Errorf("Stale occupancy after data change: %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+)
+
+// The geometry of a map orientation: where cells are drawn, which cells
+// are adjacent and how object coordinates map to the screen. All screen
+// positions are in pixels with the origin at the top left of the map.
+//
+// The orientations supported by Tiled are built in. Others can be added
+// with RegisterOrientation.
+type Orientation interface {
+	// Returns the rectangle enclosing the cell at col, row on screen.
+	CellBounds(m *Map, col, row int32) Bounds
+
+	// Returns the cells sharing an edge with the cell at col, row,
+	// as (col, row) pairs. Cells outside of the map may be included.
+	Neighbors(m *Map, col, row int32) [][2]int32
+
+	// Converts a position in object pixel coordinates, as stored in
+	// TMX files, into screen pixels.
+	PixelToScreen(m *Map, p Point) Point
+
+	// The inverse of PixelToScreen.
+	ScreenToPixel(m *Map, p Point) Point
+
+	// Returns the size of the whole map on screen.
+	ScreenSize(m *Map) (w, h float32)
+}
+
+var orientations = map[string]Orientation{
+	"orthogonal": orthogonal{},
+	"isometric":  isometric{},
+	"staggered":  staggered{},
+	"hexagonal":  staggered{hexagonal: true},
+}
+
+// Makes o the geometry of maps whose orientation attribute is name,
+// replacing any orientation registered under that name before.
+// Not safe to call concurrently with parsing maps.
+func RegisterOrientation(name string, o Orientation) {
+	orientations[name] = o
+}
+
+// Returns the geometry of the map.
+func (m *Map) layout() Orientation {
+	if m.Layout != nil {
+		return m.Layout
+	}
+	if o, ok := orientations[m.Orientation]; ok {
+		return o
+	}
+	return orthogonal{}
+}
+
+// Cells laid out in a grid of rectangles.
+type orthogonal struct{}
+
+func (orthogonal) CellBounds(m *Map, col, row int32) Bounds {
+	return Bounds{
+		X: float32(col * m.TileWidth),
+		Y: float32(row * m.TileHeight),
+		W: float32(m.TileWidth),
+		H: float32(m.TileHeight),
+	}
+}
+
+func (orthogonal) Neighbors(m *Map, col, row int32) [][2]int32 {
+	return [][2]int32{{col, row - 1}, {col + 1, row}, {col, row + 1}, {col - 1, row}}
+}
+
+func (orthogonal) PixelToScreen(m *Map, p Point) Point { return p }
+
+func (orthogonal) ScreenToPixel(m *Map, p Point) Point { return p }
+
+func (orthogonal) ScreenSize(m *Map) (w, h float32) {
+	return float32(m.Width * m.TileWidth), float32(m.Height * m.TileHeight)
+}
+
+// Cells laid out in a grid of diamonds, with the first row running
+// from the top corner of the map down to the right. Both object axes
+// are measured in units of the tile height along the grid's diagonals.
+type isometric struct{}
+
+func (isometric) CellBounds(m *Map, col, row int32) Bounds {
+	var (
+		th  = float32(m.TileHeight)
+		top = isometric{}.PixelToScreen(m, Point{float32(col) * th, float32(row) * th})
+	)
+	return Bounds{
+		X: top.X - float32(m.TileWidth)/2,
+		Y: top.Y,
+		W: float32(m.TileWidth),
+		H: th,
+	}
+}
+
+func (isometric) Neighbors(m *Map, col, row int32) [][2]int32 {
+	return orthogonal{}.Neighbors(m, col, row)
+}
+
+func (isometric) PixelToScreen(m *Map, p Point) Point {
+	if m.TileHeight == 0 {
+		return p
+	}
+	var (
+		tw, th = float32(m.TileWidth), float32(m.TileHeight)
+		gx, gy = p.X / th, p.Y / th
+	)
+	return Point{
+		X: float32(m.Height)*tw/2 + (gx-gy)*tw/2,
+		Y: (gx + gy) * th / 2,
+	}
+}
+
+func (isometric) ScreenToPixel(m *Map, p Point) Point {
+	if m.TileWidth == 0 || m.TileHeight == 0 {
+		return p
+	}
+	var (
+		tw, th = float32(m.TileWidth), float32(m.TileHeight)
+		diff   = (p.X - float32(m.Height)*tw/2) * 2 / tw
+		sum    = p.Y * 2 / th
+	)
+	return Point{
+		X: (sum + diff) / 2 * th,
+		Y: (sum - diff) / 2 * th,
+	}
+}
+
+func (isometric) ScreenSize(m *Map) (w, h float32) {
+	var sum = float32(m.Width + m.Height)
+	return sum * float32(m.TileWidth) / 2, sum * float32(m.TileHeight) / 2
+}
+
+// Cells laid out in rows or columns where every other one is shifted by
+// half a cell, as used by staggered isometric and hexagonal maps. Object
+// coordinates are screen pixels on these maps.
+type staggered struct {
+	hexagonal bool
+}
+
+// Returns the size of the edges parallel to the staggered axis, the
+// distance between columns and the distance between rows.
+func (s staggered) params(m *Map) (sideX, sideY, colW, rowH float32) {
+	var side float32
+	if s.hexagonal {
+		side = float32(m.HexSideLength)
+	}
+	if m.StaggerAxis == "x" {
+		sideX = side
+	} else {
+		sideY = side
+	}
+	colW = (float32(m.TileWidth)-sideX)/2 + sideX
+	rowH = (float32(m.TileHeight)-sideY)/2 + sideY
+	return
+}
+
+// Whether the row or column i along the staggered axis is shifted.
+func (s staggered) shifted(m *Map, i int32) bool {
+	return (i%2 != 0) != (m.StaggerIndex == "even")
+}
+
+func (s staggered) CellBounds(m *Map, col, row int32) (b Bounds) {
+	var sideX, sideY, colW, rowH = s.params(m)
+	b.W, b.H = float32(m.TileWidth), float32(m.TileHeight)
+	if m.StaggerAxis == "x" {
+		b.X = float32(col) * colW
+		b.Y = float32(row) * (b.H + sideY)
+		if s.shifted(m, col) {
+			b.Y += rowH
+		}
+	} else {
+		b.X = float32(col) * (b.W + sideX)
+		b.Y = float32(row) * rowH
+		if s.shifted(m, row) {
+			b.X += colW
+		}
+	}
+	return
+}
+
+func (s staggered) Neighbors(m *Map, col, row int32) (cells [][2]int32) {
+	if m.StaggerAxis == "x" {
+		var up, down = row - 1, row
+		if s.shifted(m, col) {
+			up, down = row, row+1
+		}
+		cells = [][2]int32{{col - 1, up}, {col + 1, up}, {col + 1, down}, {col - 1, down}}
+		if s.hexagonal {
+			cells = append(cells, [2]int32{col, row - 1}, [2]int32{col, row + 1})
+		}
+	} else {
+		var left, right = col - 1, col
+		if s.shifted(m, row) {
+			left, right = col, col+1
+		}
+		cells = [][2]int32{{left, row - 1}, {right, row - 1}, {right, row + 1}, {left, row + 1}}
+		if s.hexagonal {
+			cells = append(cells, [2]int32{col - 1, row}, [2]int32{col + 1, row})
+		}
+	}
+	return
+}
+
+func (staggered) PixelToScreen(m *Map, p Point) Point { return p }
+
+func (staggered) ScreenToPixel(m *Map, p Point) Point { return p }
+
+func (s staggered) ScreenSize(m *Map) (w, h float32) {
+	var (
+		sideX, sideY, colW, rowH = s.params(m)
+		tw, th                   = float32(m.TileWidth), float32(m.TileHeight)
+	)
+	if m.StaggerAxis == "x" {
+		w = colW*float32(m.Width) + (tw-sideX)/2
+		h = (th + sideY) * float32(m.Height)
+		if m.Width > 1 {
+			h += rowH
+		}
+	} else {
+		w = (tw + sideX) * float32(m.Width)
+		h = rowH*float32(m.Height) + (th-sideY)/2
+		if m.Height > 1 {
+			w += colW
+		}
+	}
+	return
+}
+
+// Converts a position in object pixel coordinates into screen pixels
+// with the origin at the top left.
+func (m *Map) projectPixel(p Point) Point {
+	return m.layout().PixelToScreen(m, p)
+}
+
+// Returns the height of the map on screen, in pixels.
+func (m *Map) screenHeight() float32 {
+	var _, h = m.PixelSize()
+	return h
+}
+
+// Returns the size of the whole map on screen, in pixels. This is the
+// area covered by the map's grid, which tiles larger than the grid or
+// drawn with an offset may extend beyond. See LayerPixelBounds.
+func (m *Map) PixelSize() (w, h float32) {
+	return m.layout().ScreenSize(m)
+}
+
+// Returns the screen area covered by the tiles of l, relative to the
+// map's Origin. Accounts for tiles larger than the grid, tileset tile
+// offsets and the layer's offset. Empty layers return empty bounds.
+func (m *Map) LayerPixelBounds(l *Layer) (b Bounds, err error) {
+	var (
+		tiles   []*Tile
+		corners Path
+		dy      = float32(1)
+	)
+	if tiles, err = m.tilesFromLayer(context.Background(), l); err != nil {
+		return
+	}
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		dy = -1
+	}
+	for i := 0; i < len(tiles); i++ {
+		if tiles[i] == nil {
+			continue
+		}
+		var (
+			tb     = tiles[i].TileBounds
+			dx, oy = l.OffsetX, l.OffsetY
+		)
+		if off := tiles[i].Tileset.TileOffset; off != nil {
+			dx += float32(off.X)
+			oy += float32(off.Y)
+		}
+		tb.X += dx
+		tb.Y += oy * dy
+		corners = append(corners, Point{tb.X, tb.Y}, Point{tb.X + tb.W, tb.Y + tb.H})
+	}
+	b = corners.Bounds()
+	return
+}
+
+// Converts a position in object pixel coordinates, as stored in TMX
+// files, into screen pixels relative to the map's Origin. On orthogonal
+// maps this only accounts for the Origin.
+func (m *Map) PixelToScreen(p Point) Point {
+	p = m.projectPixel(p)
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		p.Y = m.screenHeight() - p.Y
+	}
+	return p
+}
+
+// Converts a position in screen pixels relative to the map's Origin
+// into object pixel coordinates. This is the inverse of PixelToScreen.
+func (m *Map) ScreenToPixel(p Point) Point {
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		p.Y = m.screenHeight() - p.Y
+	}
+	return m.layout().ScreenToPixel(m, p)
+}
+
+// Returns the screen bounds of the cell at col, row, relative to the
+// map's Origin.
+func (m *Map) CellBounds(col, row int32) (b Bounds) {
+	b = m.layout().CellBounds(m, col, row)
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		b.Y = m.screenHeight() - b.Y - b.H
+	}
+	return
+}
+
+// Returns the cells of the map sharing an edge with the cell at col, row.
+func (m *Map) Neighbors(col, row int32) (cells [][2]int32) {
+	var all = m.layout().Neighbors(m, col, row)
+	for i := 0; i < len(all); i++ {
+		if all[i][0] >= 0 && all[i][0] < m.Width && all[i][1] >= 0 && all[i][1] < m.Height {
+			cells = append(cells, all[i])
+		}
+	}
+	return
+}
+
+// Returns the screen bounds of an object on an isometric map. Tile
+// objects are drawn upright, centered on their position. Other objects
+// are projected and enclosed by their bounds.
+func (m *Map) isometricObjectBounds(o *Object) (b Bounds) {
+	var (
+		x, y = float32(o.X), float32(o.Y)
+		w, h = float32(o.Width), float32(o.Height)
+	)
+	if o.Gid != nil {
+		var p = m.projectPixel(Point{x, y})
+		b = Bounds{X: p.X - w/2, Y: p.Y - h, W: w, H: h}
+	} else {
+		var corners = Path{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}
+		for i := 0; i < len(corners); i++ {
+			corners[i] = m.projectPixel(corners[i])
+		}
+		b = corners.Bounds()
+	}
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		b.Y = m.screenHeight() - b.Y - b.H
+	}
+	return
+}
@@ -0,0 +1,228 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+)
+
+const TEST_ISOMETRIC_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="isometric" width="2" height="2" tilewidth="32" tileheight="16">
+ <tileset firstgid="1" name="trees" tilewidth="16" tileheight="32">
+  <image source="trees.png" width="64" height="32"/>
+ </tileset>
+ <layer name="ground" width="2" height="2">
+  <data>
+   <tile gid="1" />
+   <tile gid="1" />
+   <tile gid="1" />
+   <tile gid="1" />
+  </data>
+ </layer>
+ <objectgroup name="things">
+  <object name="zone" x="0" y="0" width="16" height="16"/>
+  <object name="tree" gid="1" x="16" y="16" width="16" height="32"/>
+ </objectgroup>
+</map>
+`
+
+func TestIsometricTileBounds(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		err   error
+	)
+	if m, err = ParseMapString(TEST_ISOMETRIC_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if tiles, err = m.TilesFromLayerName("ground"); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if tiles[3].TileBounds != (Bounds{24, 0, 16, 32}) {
+		t.Errorf("Invalid bounds: %v", tiles[3].TileBounds)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if tiles, err = m.TilesFromLayerName("ground"); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if tiles[0].TileBounds != (Bounds{24, -16, 16, 32}) {
+		t.Errorf("Invalid bounds: %v", tiles[0].TileBounds)
+	}
+	if tiles[1].TileBounds.X != 40 || tiles[2].TileBounds.X != 8 {
+		t.Errorf("Invalid bounds: %v %v", tiles[1].TileBounds, tiles[2].TileBounds)
+	}
+}
+
+func TestIsometricObjectBounds(t *testing.T) {
+	var (
+		m   *Map
+		err error
+	)
+	if m, err = ParseMapString(TEST_ISOMETRIC_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	var objects = m.ObjectGroups[0].Objects
+	if b := m.ObjectBounds(&objects[0]); b != (Bounds{16, 0, 32, 16}) {
+		t.Errorf("Invalid zone bounds: %v", b)
+	}
+	if b := m.ObjectBounds(&objects[1]); b != (Bounds{24, -16, 16, 32}) {
+		t.Errorf("Invalid tree bounds: %v", b)
+	}
+}
+
+func TestPixelToScreen(t *testing.T) {
+	var (
+		m   *Map
+		err error
+	)
+	if m, err = ParseMapString(TEST_ISOMETRIC_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var p = m.PixelToScreen(Point{16, 0})
+	if p != (Point{48, 24}) {
+		t.Errorf("Invalid screen position: %v", p)
+	}
+	if p = m.ScreenToPixel(p); p != (Point{16, 0}) {
+		t.Errorf("Invalid pixel position: %v", p)
+	}
+}
+
+const TEST_HEXAGONAL_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="hexagonal" width="2" height="2" tilewidth="28" tileheight="32" hexsidelength="16" staggeraxis="y" staggerindex="odd">
+ <tileset firstgid="1" name="hexes" tilewidth="28" tileheight="32">
+  <image source="hexes.png" width="112" height="32"/>
+ </tileset>
+ <layer name="ground" width="2" height="2">
+  <data>
+   <tile gid="1" />
+   <tile gid="2" />
+   <tile gid="3" />
+   <tile gid="4" />
+  </data>
+ </layer>
+</map>
+`
+
+func TestHexagonalOrientation(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		out   string
+		err   error
+	)
+	if m, err = ParseMapString(TEST_HEXAGONAL_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if tiles, err = m.TilesFromLayerName("ground"); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if tiles[2].TileBounds != (Bounds{14, 24, 28, 32}) {
+		t.Errorf("Invalid bounds: %v", tiles[2].TileBounds)
+	}
+	if w, h := m.layout().ScreenSize(m); w != 70 || h != 56 {
+		t.Errorf("Invalid screen size: %vx%v", w, h)
+	}
+	var cells = m.Neighbors(0, 1)
+	if len(cells) != 3 || cells[0] != [2]int32{0, 0} || cells[1] != [2]int32{1, 0} || cells[2] != [2]int32{1, 1} {
+		t.Errorf("Invalid neighbors: %v", cells)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if m.HexSideLength != 16 || m.StaggerAxis != "y" || m.StaggerIndex != "odd" {
+		t.Errorf("Stagger attributes not round tripped: %v", out)
+	}
+}
+
+type testOrientation struct {
+	orthogonal
+}
+
+func (testOrientation) CellBounds(m *Map, col, row int32) Bounds {
+	return Bounds{X: float32(col), Y: float32(row), W: 1, H: 1}
+}
+
+func TestRegisterOrientation(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		err   error
+	)
+	RegisterOrientation("test", testOrientation{})
+	defer delete(orientations, "test")
+	if m, err = ParseMapString(strings.Replace(TEST_HEXAGONAL_MAP, "hexagonal", "test", 1)); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if tiles, err = m.TilesFromLayerName("ground"); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if tiles[3].TileBounds.X != 1 || tiles[2].TileBounds.X != 0 {
+		t.Errorf("Custom orientation not used: %v", tiles[3].TileBounds)
+	}
+}
+
+const TEST_OFFSET_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="2" height="2" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="trees" tilewidth="16" tileheight="32">
+  <tileoffset x="2" y="-4"/>
+  <image source="trees.png" width="64" height="32"/>
+ </tileset>
+ <layer name="trees" width="2" height="2" offsetx="10" offsety="5">
+  <data>
+   <tile gid="0" />
+   <tile gid="0" />
+   <tile gid="0" />
+   <tile gid="1" />
+  </data>
+ </layer>
+</map>
+`
+
+func TestLayerPixelBounds(t *testing.T) {
+	var (
+		m   *Map
+		b   Bounds
+		err error
+	)
+	if m, err = ParseMapString(TEST_OFFSET_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if w, h := m.PixelSize(); w != 32 || h != 32 {
+		t.Errorf("Invalid pixel size: %vx%v", w, h)
+	}
+	if b, err = m.LayerPixelBounds(m.Layers[0]); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{28, -1, 16, 32}) {
+		t.Errorf("Invalid bounds: %v", b)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if b, err = m.LayerPixelBounds(m.Layers[0]); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{28, 1, 16, 32}) {
+		t.Errorf("Invalid bounds: %v", b)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"math"
+)
+
+// A list of points, such as those of a polygon or polyline. Polylines
+// are treated as if they were closed by the methods below.
+type Path []Point
+
+// Returns the shoelace area of the path. The sign is positive when the
+// points run clockwise on screen, with Y growing down as in TMX files.
+func (p Path) SignedArea() (area float32) {
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		area += p[j].X*p[i].Y - p[i].X*p[j].Y
+	}
+	return area / 2
+}
+
+func (p Path) Area() float32 {
+	return float32(math.Abs(float64(p.SignedArea())))
+}
+
+// Returns whether the points run clockwise on screen, with Y growing down.
+func (p Path) Clockwise() bool {
+	return p.SignedArea() > 0
+}
+
+// Returns the center of mass of the enclosed area, or the average of
+// the points if the area is zero.
+func (p Path) Centroid() (c Point) {
+	var area = p.SignedArea()
+	if len(p) == 0 {
+		return
+	}
+	if area == 0 {
+		for i := 0; i < len(p); i++ {
+			c.X += p[i].X
+			c.Y += p[i].Y
+		}
+		c.X /= float32(len(p))
+		c.Y /= float32(len(p))
+		return
+	}
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		var cross = p[j].X*p[i].Y - p[i].X*p[j].Y
+		c.X += (p[j].X + p[i].X) * cross
+		c.Y += (p[j].Y + p[i].Y) * cross
+	}
+	c.X /= 6 * area
+	c.Y /= 6 * area
+	return
+}
+
+// Returns whether the path forms a convex polygon. Collinear points are
+// allowed, paths of fewer than three points are not convex.
+func (p Path) Convex() bool {
+	var sign float32
+	if len(p) < 3 {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		var (
+			a     = p[i]
+			b     = p[(i+1)%len(p)]
+			c     = p[(i+2)%len(p)]
+			cross = (b.X-a.X)*(c.Y-b.Y) - (b.Y-a.Y)*(c.X-b.X)
+		)
+		if cross == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = cross
+		} else if (cross > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return sign != 0
+}
+
+// Returns the smallest axis aligned rectangle containing every point.
+func (p Path) Bounds() (b Bounds) {
+	if len(p) == 0 {
+		return
+	}
+	var minX, minY, maxX, maxY = p[0].X, p[0].Y, p[0].X, p[0].Y
+	for i := 1; i < len(p); i++ {
+		minX = float32(math.Min(float64(minX), float64(p[i].X)))
+		minY = float32(math.Min(float64(minY), float64(p[i].Y)))
+		maxX = float32(math.Max(float64(maxX), float64(p[i].X)))
+		maxY = float32(math.Max(float64(maxY), float64(p[i].Y)))
+	}
+	return Bounds{X: minX, Y: minY, W: maxX - minX, H: maxY - minY}
+}
+
+// Returns the outline of the object in map pixels, with Y growing down
+// as in TMX files and the object's rotation applied. Polygons and
+// polylines return their points, all other objects the corners of
+// their rectangle.
+func (o *Object) MapPoints() (points Path, err error) {
+	var (
+		theta = float64(o.Rotation) * math.Pi / 180
+		sin   = float32(math.Sin(theta))
+		cos   = float32(math.Cos(theta))
+		w, h  = float32(o.Width), float32(o.Height)
+	)
+	switch {
+	case o.Polygon != nil:
+		points, err = o.Polygon.Points()
+	case o.Polyline != nil:
+		points, err = o.Polyline.Points()
+	case o.Gid != nil:
+		points = Path{{0, -h}, {w, -h}, {w, 0}, {0, 0}}
+	default:
+		points = Path{{0, 0}, {w, 0}, {w, h}, {0, h}}
+	}
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(points); i++ {
+		var x, y = points[i].X, points[i].Y
+		points[i] = Point{
+			X: float32(o.X) + x*cos - y*sin,
+			Y: float32(o.Y) + x*sin + y*cos,
+		}
+	}
+	return
+}
+
+// Returns the bounding box of the object in map pixels, for culling.
+func (o *Object) MapBounds() (b Bounds, err error) {
+	var points Path
+	if points, err = o.MapPoints(); err != nil {
+		return
+	}
+	return points.Bounds(), nil
+}
+
+// Like o.MapPoints, but shifted by the offset of the group, so the points
+// line up with the group as it is drawn. o should be an object of g.
+func (g *ObjectGroup) WorldPoints(o *Object) (points Path, err error) {
+	if points, err = o.MapPoints(); err != nil {
+		return
+	}
+	for i := 0; i < len(points); i++ {
+		points[i].X += g.OffsetX
+		points[i].Y += g.OffsetY
+	}
+	return
+}
+
+// Like o.MapBounds, but shifted by the offset of the group.
+func (g *ObjectGroup) WorldBounds(o *Object) (b Bounds, err error) {
+	var points Path
+	if points, err = g.WorldPoints(o); err != nil {
+		return
+	}
+	return points.Bounds(), nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	var (
+		square = Path{{0, 0}, {4, 0}, {4, 4}, {0, 4}}
+		arrow  = Path{{0, 0}, {4, 2}, {0, 4}, {1, 2}}
+	)
+	if square.Area() != 16 || !square.Clockwise() {
+		t.Errorf("Wrong square area or winding: %v %v", square.SignedArea(), square.Clockwise())
+	}
+	if c := square.Centroid(); c != (Point{2, 2}) {
+		t.Errorf("Wrong centroid: %v", c)
+	}
+	if !square.Convex() || arrow.Convex() {
+		t.Errorf("Wrong convexity")
+	}
+	if b := arrow.Bounds(); b != (Bounds{0, 0, 4, 4}) {
+		t.Errorf("Wrong bounds: %v", b)
+	}
+	var reversed = Path{{0, 4}, {4, 4}, {4, 0}, {0, 0}}
+	if reversed.Clockwise() || reversed.Area() != 16 {
+		t.Errorf("Wrong reversed winding")
+	}
+}
+
+func TestObjectMapBounds(t *testing.T) {
+	var (
+		m   *Map
+		b   Bounds
+		err error
+	)
+	if m, err = ParseMapString(TEST_OBJECTS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = m.ObjectGroups[0].Objects[1].MapBounds(); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{0, 32, 32, 16}) {
+		t.Errorf("Wrong polygon bounds: %v", b)
+	}
+	if b, err = m.ObjectGroups[1].Objects[0].MapBounds(); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{32, 32, 16, 16}) {
+		t.Errorf("Wrong tile object bounds: %v", b)
+	}
+}
@@ -0,0 +1,559 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How deeply classes may be nested in one another.
+const MAX_CLASS_DEPTH = 32
+
+// The color InferProject gives classes, which is Tiled's default.
+const DEFAULT_CLASS_COLOR = "#ffa0a0a4"
+
+// The parts of a Tiled project file (.tiled-project) that concern maps,
+// namely the custom property types they use. (since 1.8)
+type Project struct {
+	PropertyTypes []*PropertyType `json:"propertyTypes"`
+
+	// The ranges of numeric properties by name, as set by
+	// SetPropertyRange. Not part of the project file.
+	PropertyRanges map[string]PropertyRange `json:"-"`
+}
+
+// A custom property type, either an enum or a class.
+type PropertyType struct {
+	Id int `json:"id"`
+
+	// The name properties refer to the type by.
+	Name string `json:"name"`
+
+	// Either "enum" or "class".
+	Type string `json:"type"`
+
+	// For enums, whether values are stored as "string" or "int".
+	StorageType string `json:"storageType,omitempty"`
+
+	// For enums, the allowed values.
+	Values []string `json:"values,omitempty"`
+
+	// For enums, whether a property may hold several values at once.
+	// Several values are stored comma separated or as a bit mask.
+	ValuesAsFlags bool `json:"valuesAsFlags,omitempty"`
+
+	// For classes, the kinds of objects the class can be used for.
+	UseAs []string `json:"useAs,omitempty"`
+
+	// For classes, the color in #AARRGGBB format.
+	Color string `json:"color,omitempty"`
+
+	// For classes, the members and their default values.
+	Members []PropertyMember `json:"members,omitempty"`
+}
+
+// A member of a class along with its default value.
+type PropertyMember struct {
+	Name string `json:"name"`
+
+	// The type of the member, as in Property.Type.
+	Type string `json:"type"`
+
+	// The name of the custom type of class and enum members.
+	PropertyType string `json:"propertyType,omitempty"`
+
+	// The default value. A string, number or bool for most types, and
+	// an object holding the members that differ from their defaults
+	// for class members.
+	Value interface{} `json:"value"`
+}
+
+func ParseProject(r io.Reader) (p *Project, err error) {
+	p = &Project{}
+	if err = json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Writes the project as JSON in the format of Tiled project files.
+// Tiled reads property types from the "propertyTypes" member, so the
+// output can be pasted into an existing project or imported as is.
+func (p *Project) Write(w io.Writer) (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(p, "", "    "); err != nil {
+		return
+	}
+	_, err = w.Write(append(data, '\n'))
+	return
+}
+
+func ParseProjectFile(filename string) (p *Project, err error) {
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	return ParseProject(f)
+}
+
+// Returns the property type called name, or nil if there is none.
+func (p *Project) PropertyTypeByName(name string) *PropertyType {
+	for i := 0; i < len(p.PropertyTypes); i++ {
+		if p.PropertyTypes[i].Name == name {
+			return p.PropertyTypes[i]
+		}
+	}
+	return nil
+}
+
+func (p *Project) class(name string) (class *PropertyType, err error) {
+	if class = p.PropertyTypeByName(name); class == nil || class.Type != "class" {
+		err = fmt.Errorf("No class with name %v", name)
+	}
+	return
+}
+
+// Returns prop with every member of its class filled in, taking the
+// value from prop where given and from the class defaults otherwise.
+// Members that are classes themselves are resolved in the same way.
+// Properties that are not of type "class" are returned unchanged.
+func (p *Project) ResolveProperty(prop Property) (resolved Property, err error) {
+	var (
+		class     *PropertyType
+		overrides []Property
+		members   []Property
+	)
+	resolved = prop
+	if prop.Type != "class" {
+		return
+	}
+	if class, err = p.class(prop.PropertyType); err != nil {
+		return
+	}
+	if prop.Members != nil {
+		overrides = prop.Members.Properties
+	}
+	if members, err = p.resolveClass(class, overrides, 0); err != nil {
+		return
+	}
+	resolved.Members = &PropertyList{members}
+	return
+}
+
+func (p *Project) resolveClass(class *PropertyType, overrides []Property, depth int) (members []Property, err error) {
+	if depth > MAX_CLASS_DEPTH {
+		err = fmt.Errorf("Class %v nested too deeply", class.Name)
+		return
+	}
+	for i := 0; i < len(class.Members); i++ {
+		var (
+			m      = class.Members[i]
+			member = Property{Name: m.Name, Type: m.Type, PropertyType: m.PropertyType}
+			nested []Property
+		)
+		if m.Type == "class" {
+			nested = jsonMembers(m.Value)
+		} else {
+			member.Value = jsonString(m.Value)
+		}
+		member.fromClass = true
+		for j := 0; j < len(overrides); j++ {
+			if overrides[j].Name != m.Name {
+				continue
+			}
+			member.fromClass = overrides[j].fromClass
+			if m.Type != "class" {
+				member.Value = overrides[j].Value
+			} else if overrides[j].Members != nil {
+				nested = mergeProperties(nested, overrides[j].Members.Properties)
+			}
+		}
+		if m.Type == "class" {
+			var (
+				sub      *PropertyType
+				resolved []Property
+			)
+			if sub, err = p.class(m.PropertyType); err != nil {
+				return
+			}
+			if resolved, err = p.resolveClass(sub, nested, depth+1); err != nil {
+				return
+			}
+			member.Members = &PropertyList{resolved}
+		}
+		if member.fromClass {
+			member.defaultValue = member.Value
+		}
+		members = append(members, member)
+	}
+	return
+}
+
+// Returns the properties of a, replaced by those of b with the same
+// name, followed by the remaining properties of b.
+func mergeProperties(a, b []Property) (merged []Property) {
+	var replaced = map[string]bool{}
+	for i := 0; i < len(a); i++ {
+		var p = a[i]
+		for j := 0; j < len(b); j++ {
+			if b[j].Name == p.Name {
+				p = b[j]
+				replaced[p.Name] = true
+			}
+		}
+		merged = append(merged, p)
+	}
+	for j := 0; j < len(b); j++ {
+		if !replaced[b[j].Name] {
+			merged = append(merged, b[j])
+		}
+	}
+	return
+}
+
+// Converts the JSON object holding the values of class members into
+// properties, ordered by name, marked as filled in from class defaults.
+func jsonMembers(v interface{}) (members []Property) {
+	var (
+		object, _ = v.(map[string]interface{})
+		names     []string
+	)
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names); i++ {
+		var member = Property{Name: names[i], fromClass: true}
+		if _, ok := object[names[i]].(map[string]interface{}); ok {
+			member.Members = &PropertyList{jsonMembers(object[names[i]])}
+		} else {
+			member.Value = jsonString(object[names[i]])
+		}
+		members = append(members, member)
+	}
+	return
+}
+
+// Formats a JSON value the way it is stored in TMX files.
+func jsonString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Checks that enum properties hold allowed values, including enum
+// members of class properties. Properties with no or unknown custom
+// types are not checked.
+func (p *Project) ValidateProperty(prop Property) (err error) {
+	var t = p.PropertyTypeByName(prop.PropertyType)
+	if t == nil {
+		return
+	}
+	if t.Type == "class" {
+		if prop.Members == nil {
+			return
+		}
+		for i := 0; i < len(prop.Members.Properties); i++ {
+			if err = p.ValidateProperty(prop.Members.Properties[i]); err != nil {
+				return fmt.Errorf("%v: %v", prop.Name, err)
+			}
+		}
+		return
+	}
+	if t.StorageType == "int" {
+		var (
+			v     int64
+			limit = int64(len(t.Values))
+		)
+		if t.ValuesAsFlags {
+			limit = 1 << uint(len(t.Values))
+		}
+		if v, err = strconv.ParseInt(prop.Value, 10, 64); err != nil || v < 0 || v >= limit {
+			return fmt.Errorf("%v: Invalid value %q for enum %v", prop.Name, prop.Value, t.Name)
+		}
+		return
+	}
+	var values = []string{prop.Value}
+	if t.ValuesAsFlags {
+		values = nil
+		if prop.Value != "" {
+			values = strings.Split(prop.Value, ",")
+		}
+	}
+	for i := 0; i < len(values); i++ {
+		var found bool
+		for j := 0; j < len(t.Values); j++ {
+			found = found || t.Values[j] == values[i]
+		}
+		if !found {
+			return fmt.Errorf("%v: Invalid value %q for enum %v", prop.Name, values[i], t.Name)
+		}
+	}
+	return
+}
+
+// Replaces every class property of the map by its resolved form.
+func (m *Map) ResolveProperties(project *Project) error {
+	return m.eachProperty(func(element string, prop *Property) (err error) {
+		*prop, err = project.ResolveProperty(*prop)
+		return
+	})
+}
+
+// Checks the values of every enum property of the map against the
+// map's Project, if it has one, and of every numeric property against
+// the ranges set on it by SetPropertyRange.
+func (m *Map) ValidateProperties() (errs []error) {
+	m.eachProperty(func(element string, prop *Property) error {
+		if m.Project == nil {
+			return nil
+		}
+		if err := m.Project.ValidateProperty(*prop); err != nil {
+			errs = append(errs, &ValidationError{element, err.Error()})
+		}
+		if err := m.Project.checkPropertyRange(prop); err != nil {
+			errs = append(errs, &ValidationError{element, err.Error()})
+		}
+		return nil
+	})
+	return
+}
+
+// Calls fn with every property of the map, its tilesets, layers and
+// objects, along with a description of the element holding it.
+func (m *Map) eachProperty(fn func(element string, prop *Property) error) (err error) {
+	var each = func(element string, props []Property) (err error) {
+		for i := 0; i < len(props); i++ {
+			if err = fn(element, &props[i]); err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := 0; i < len(m.Properties); i++ {
+		if err = fn("map", &m.Properties[i]); err != nil {
+			return
+		}
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		var ts = m.Tilesets[i]
+		if err = each(fmt.Sprintf("tileset %v", ts.Name), ts.Properties); err != nil {
+			return
+		}
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			var element = fmt.Sprintf("tileset %v tile %v", ts.Name, ts.TilesetTile[j].Id)
+			if err = each(element, ts.TilesetTile[j].Properties); err != nil {
+				return
+			}
+		}
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if err = each(fmt.Sprintf("layer %v", m.Layers[i].Name), m.Layers[i].Properties); err != nil {
+			return
+		}
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		if err = each(fmt.Sprintf("imagelayer %v", m.ImageLayers[i].Name), m.ImageLayers[i].Properties); err != nil {
+			return
+		}
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = m.ObjectGroups[i]
+		if err = each(fmt.Sprintf("objectgroup %v", g.Name), g.Properties); err != nil {
+			return
+		}
+		for j := 0; j < len(g.Objects); j++ {
+			var element = fmt.Sprintf("objectgroup %v object %v", g.Name, j)
+			if err = each(element, g.Objects[j].Properties); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// The values seen for a property of objects of one class.
+type observedMember struct {
+	types  map[string]bool
+	values map[string]int
+}
+
+// Infers custom property types from the properties of the objects of
+// maps, to retrofit typing onto maps predating them. Every object type
+// becomes a class with a member for each property seen on objects of
+// that type. Members take their type from the property type if given
+// and from the values seen otherwise, and default to the most common
+// value. String properties that repeat no more than maxEnumValues
+// distinct values become enums named after the property.
+func InferProject(maps []*Map, maxEnumValues int) (p *Project) {
+	var (
+		classes = map[string]map[string]*observedMember{}
+		enums   = map[string]map[string]bool{}
+		names   []string
+	)
+	for i := 0; i < len(maps); i++ {
+		maps[i].EachObject(func(g *ObjectGroup, o *Object) error {
+			if o.Type == "" {
+				return nil
+			}
+			if classes[o.Type] == nil {
+				classes[o.Type] = map[string]*observedMember{}
+			}
+			for j := 0; j < len(o.Properties); j++ {
+				var prop = o.Properties[j]
+				var member = classes[o.Type][prop.Name]
+				if member == nil {
+					member = &observedMember{map[string]bool{}, map[string]int{}}
+					classes[o.Type][prop.Name] = member
+				}
+				member.types[prop.Type] = true
+				member.values[prop.Value]++
+			}
+			return nil
+		})
+	}
+	p = &Project{}
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names); i++ {
+		var (
+			class = &PropertyType{
+				Name:  names[i],
+				Type:  "class",
+				UseAs: []string{"object"},
+				Color: DEFAULT_CLASS_COLOR,
+			}
+			members []string
+		)
+		for name := range classes[names[i]] {
+			members = append(members, name)
+		}
+		sort.Strings(members)
+		for j := 0; j < len(members); j++ {
+			var (
+				observed = classes[names[i]][members[j]]
+				member   = PropertyMember{Name: members[j], Type: observed.inferType()}
+				best     string
+				count    int
+				total    int
+			)
+			for value, n := range observed.values {
+				if n > count || n == count && value < best {
+					best, count = value, n
+				}
+				total += n
+			}
+			if member.Type == "string" && len(observed.values) <= maxEnumValues && len(observed.values) < total && classes[members[j]] == nil {
+				member.PropertyType = members[j]
+				if enums[members[j]] == nil {
+					enums[members[j]] = map[string]bool{}
+				}
+				for value := range observed.values {
+					enums[members[j]][value] = true
+				}
+			}
+			member.Value = typedJSONValue(member.Type, best)
+			class.Members = append(class.Members, member)
+		}
+		p.PropertyTypes = append(p.PropertyTypes, class)
+	}
+	names = nil
+	for name := range enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names); i++ {
+		var enum = &PropertyType{Name: names[i], Type: "enum", StorageType: "string"}
+		for value := range enums[names[i]] {
+			enum.Values = append(enum.Values, value)
+		}
+		sort.Strings(enum.Values)
+		p.PropertyTypes = append(p.PropertyTypes, enum)
+	}
+	for i := 0; i < len(p.PropertyTypes); i++ {
+		p.PropertyTypes[i].Id = i + 1
+	}
+	return
+}
+
+// Returns the declared type of the member if all uses agree on one,
+// and otherwise the narrowest type all its values can be parsed as.
+func (o *observedMember) inferType() string {
+	if len(o.types) == 1 {
+		for t := range o.types {
+			if t != "" {
+				return t
+			}
+		}
+	}
+	var isInt, isFloat, isBool = true, true, true
+	for value := range o.values {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			isInt = false
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			isFloat = false
+		}
+		if _, err := strconv.ParseBool(value); err != nil || value != "true" && value != "false" {
+			isBool = false
+		}
+	}
+	switch {
+	case isInt:
+		return "int"
+	case isFloat:
+		return "float"
+	case isBool:
+		return "bool"
+	}
+	return "string"
+}
+
+// Converts a value as stored in TMX files into the JSON value Tiled
+// project files use for members of type t.
+func typedJSONValue(t, value string) interface{} {
+	switch t {
+	case "int", "object":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case "float":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case "bool":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,194 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_PROJECT = `{
+ "propertyTypes": [
+  {"id": 1, "name": "Dir", "type": "enum", "storageType": "string", "values": ["N", "E", "S", "W"]},
+  {"id": 2, "name": "Stats", "type": "class", "members": [
+   {"name": "hp", "type": "int", "value": 10},
+   {"name": "facing", "type": "string", "propertyType": "Dir", "value": "N"}
+  ]},
+  {"id": 3, "name": "Enemy", "type": "class", "members": [
+   {"name": "name", "type": "string", "value": "grunt"},
+   {"name": "stats", "type": "class", "propertyType": "Stats", "value": {"hp": 20}}
+  ]}
+ ]
+}`
+
+const TEST_CLASS_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <objectgroup name="spawns">
+  <object name="a" x="0" y="0">
+   <properties>
+    <property name="enemy" type="class" propertytype="Enemy">
+     <properties>
+      <property name="stats">
+       <properties>
+        <property name="facing" value="S"/>
+       </properties>
+      </property>
+     </properties>
+    </property>
+   </properties>
+  </object>
+ </objectgroup>
+</map>
+`
+
+func TestProjectResolveProperty(t *testing.T) {
+	var (
+		project *Project
+		loader  = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_CLASS_MAP)},
+		})
+		m   *Map
+		out string
+		err error
+	)
+	if project, err = ParseProject(strings.NewReader(TEST_PROJECT)); err != nil {
+		t.Fatalf("Could not parse project: %v", err)
+	}
+	loader.Project = project
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var enemy = m.ObjectGroups[0].Objects[0].Properties[0]
+	if enemy.Members == nil || len(enemy.Members.Properties) != 2 {
+		t.Fatalf("Class not resolved: %v", enemy)
+	}
+	var name, stats = enemy.Members.Properties[0], enemy.Members.Properties[1]
+	if name.Name != "name" || name.Value != "grunt" {
+		t.Errorf("Invalid default member: %v", name)
+	}
+	if stats.Members == nil || len(stats.Members.Properties) != 2 {
+		t.Fatalf("Nested class not resolved: %v", stats)
+	}
+	if hp := stats.Members.Properties[0]; hp.Value != "20" || hp.Type != "int" {
+		t.Errorf("Invalid nested default: %v", hp)
+	}
+	if facing := stats.Members.Properties[1]; facing.Value != "S" || facing.PropertyType != "Dir" {
+		t.Errorf("Invalid nested override: %v", facing)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Errorf("Could not serialize: %v", err)
+	}
+	if strings.Contains(out, `"grunt"`) || strings.Contains(out, `"hp"`) || !strings.Contains(out, `name="facing" value="S"`) {
+		t.Errorf("Class defaults written: %v", out)
+	}
+	enemy.Members.Properties[0].Value = "boss"
+	if out, err = m.Serialize(); err != nil || !strings.Contains(out, `name="name" value="boss"`) {
+		t.Errorf("Changed default not written: %v %v", out, err)
+	}
+	stats.Members.Properties[1].Value = "X"
+	if _, err = m.Serialize(); err == nil || !strings.Contains(err.Error(), "Invalid value") {
+		t.Errorf("Expected invalid enum error, got %v", err)
+	}
+}
+
+func TestProjectValidateFlags(t *testing.T) {
+	var project = &Project{PropertyTypes: []*PropertyType{
+		{Name: "Dirs", Type: "enum", StorageType: "string", Values: []string{"N", "S"}, ValuesAsFlags: true},
+		{Name: "Mask", Type: "enum", StorageType: "int", Values: []string{"N", "S"}, ValuesAsFlags: true},
+	}}
+	for _, c := range []struct {
+		prop  Property
+		valid bool
+	}{
+		{Property{Name: "a", PropertyType: "Dirs", Value: "N,S"}, true},
+		{Property{Name: "b", PropertyType: "Dirs", Value: ""}, true},
+		{Property{Name: "c", PropertyType: "Dirs", Value: "N,E"}, false},
+		{Property{Name: "d", PropertyType: "Mask", Value: "3"}, true},
+		{Property{Name: "e", PropertyType: "Mask", Value: "4"}, false},
+	} {
+		if err := project.ValidateProperty(c.prop); (err == nil) != c.valid {
+			t.Errorf("Property %v: unexpected result %v", c.prop.Name, err)
+		}
+	}
+}
+
+const TEST_UNTYPED_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <objectgroup name="spawns">
+  <object name="a" type="enemy" x="0" y="0">
+   <properties>
+    <property name="hp" value="10"/>
+    <property name="facing" value="N"/>
+   </properties>
+  </object>
+  <object name="b" type="enemy" x="0" y="0">
+   <properties>
+    <property name="hp" value="2.5"/>
+    <property name="facing" value="N"/>
+    <property name="boss" value="true"/>
+   </properties>
+  </object>
+  <object name="c" type="enemy" x="0" y="0">
+   <properties>
+    <property name="facing" value="S"/>
+   </properties>
+  </object>
+ </objectgroup>
+</map>
+`
+
+func TestInferProject(t *testing.T) {
+	var (
+		m       *Map
+		project *Project
+		buf     strings.Builder
+		err     error
+	)
+	if m, err = ParseMapString(TEST_UNTYPED_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	project = InferProject([]*Map{m}, 4)
+	if len(project.PropertyTypes) != 2 {
+		t.Fatalf("Invalid types: %v", project.PropertyTypes)
+	}
+	var class, enum = project.PropertyTypes[0], project.PropertyTypes[1]
+	if class.Name != "enemy" || class.Id != 1 || len(class.Members) != 3 {
+		t.Fatalf("Invalid class: %v", class)
+	}
+	if m := class.Members[0]; m.Name != "boss" || m.Type != "bool" || m.Value != true {
+		t.Errorf("Invalid member: %v", m)
+	}
+	if m := class.Members[1]; m.Name != "facing" || m.PropertyType != "facing" || m.Value != "N" {
+		t.Errorf("Invalid member: %v", m)
+	}
+	if m := class.Members[2]; m.Name != "hp" || m.Type != "float" {
+		t.Errorf("Invalid member: %v", m)
+	}
+	if enum.Name != "facing" || enum.Type != "enum" || strings.Join(enum.Values, ",") != "N,S" {
+		t.Errorf("Invalid enum: %v", enum)
+	}
+	if err = project.Write(&buf); err != nil {
+		t.Fatalf("Could not write: %v", err)
+	}
+	if project, err = ParseProject(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("Could not parse written project: %v", err)
+	}
+	if project.PropertyTypeByName("facing") == nil {
+		t.Errorf("Enum not written: %v", buf.String())
+	}
+}
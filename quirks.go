@@ -0,0 +1,112 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// Rewrites the tokens of maps written by the Java version of Tiled
+// into the form the current format uses:
+//
+//   - gid attributes written as signed integers, which is how flipped
+//     tiles came out, are converted to their unsigned value; empty gid
+//     attributes are dropped.
+//   - property values written as the text of the property element
+//     rather than its value attribute are moved into the attribute.
+//
+// The id attribute Tiled Java wrote on images is read into Image.Id
+// with or without these rewrites.
+type tiledJavaReader struct {
+	r       xml.TokenReader
+	pending []xml.Token
+}
+
+func (j *tiledJavaReader) Token() (tok xml.Token, err error) {
+	if len(j.pending) > 0 {
+		tok, j.pending = j.pending[0], j.pending[1:]
+		return
+	}
+	if tok, err = j.r.Token(); err != nil {
+		return
+	}
+	var start, ok = tok.(xml.StartElement)
+	if !ok {
+		return
+	}
+	start.Attr = tiledJavaGids(start.Attr)
+	if start.Name.Local == "property" && !hasAttr(start.Attr, "value") {
+		return j.propertyText(start)
+	}
+	tok = start
+	return
+}
+
+// Reads ahead of the property element start. If the element only holds
+// text, the text is returned as its value attribute. Otherwise the
+// tokens read are queued to be returned unchanged.
+func (j *tiledJavaReader) propertyText(start xml.StartElement) (tok xml.Token, err error) {
+	var text []byte
+	for {
+		if tok, err = j.r.Token(); err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+			j.pending = append(j.pending, t.Copy())
+			continue
+		case xml.EndElement:
+			if value := strings.TrimSpace(string(text)); value != "" {
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "value"}, Value: value})
+				j.pending = []xml.Token{t}
+				tok = start
+				return
+			}
+		}
+		j.pending = append(j.pending, xml.CopyToken(tok))
+		tok = start
+		return
+	}
+}
+
+// Returns attrs with signed gid values converted and empty ones dropped.
+func tiledJavaGids(attrs []xml.Attr) (out []xml.Attr) {
+	out = attrs[:0]
+	for i := 0; i < len(attrs); i++ {
+		if attrs[i].Name.Local == "gid" {
+			var value = strings.TrimSpace(attrs[i].Value)
+			if value == "" {
+				continue
+			}
+			if gid, err := strconv.ParseInt(value, 10, 32); err == nil && gid < 0 {
+				attrs[i].Value = strconv.FormatUint(uint64(uint32(int32(gid))), 10)
+			}
+		}
+		out = append(out, attrs[i])
+	}
+	return
+}
+
+func hasAttr(attrs []xml.Attr, name string) bool {
+	for i := 0; i < len(attrs); i++ {
+		if attrs[i].Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_TILED_JAVA_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="0.99b" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="author">somebody</property>
+  <property name="level" value="3"/>
+ </properties>
+ <tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16">
+  <image source="tiles.png" id="0"/>
+ </tileset>
+ <layer name="ground" width="2" height="1">
+  <data><tile gid="-2147483647"/><tile gid=""/></data>
+ </layer>
+ <objectgroup name="things">
+  <object x="0" y="16" gid="-1073741822"/>
+ </objectgroup>
+</map>
+`
+
+func TestTiledJavaQuirks(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"old.tmx": &fstest.MapFile{Data: []byte(TEST_TILED_JAVA_MAP)},
+		})
+		m     *Map
+		tiles []DataTile
+		err   error
+	)
+	if _, err = loader.ParseMapFile("old.tmx"); err == nil {
+		t.Errorf("Expected signed gid to fail without quirks")
+	}
+	loader.TiledJavaQuirks = true
+	if m, err = loader.ParseMapFile("old.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if len(m.Properties) != 2 || m.Properties[0].Value != "somebody" || m.Properties[1].Value != "3" {
+		t.Errorf("Invalid properties: %v", m.Properties)
+	}
+	if tiles, err = m.Layers[0].Data.Tiles(); err != nil {
+		t.Fatalf("Could not decode tiles: %v", err)
+	}
+	if len(tiles) != 2 || tiles[0].Gid != 0x80000001 || tiles[1].Gid != 0 {
+		t.Errorf("Invalid tiles: %v", tiles)
+	}
+	if gid := m.ObjectGroups[0].Objects[0].Gid; gid == nil || *gid != 0xC0000002 {
+		t.Errorf("Invalid object gid: %v", gid)
+	}
+}
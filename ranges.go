@@ -0,0 +1,129 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// The values a numeric property may take, inclusive.
+type PropertyRange struct {
+	Min, Max float64
+}
+
+// Restricts int and float properties called name to the range min to
+// max, inclusive, which ValidateProperties then checks for maps using
+// the project. Setting a name again replaces its range.
+func (p *Project) SetPropertyRange(name string, min, max float64) {
+	if p.PropertyRanges == nil {
+		p.PropertyRanges = map[string]PropertyRange{}
+	}
+	p.PropertyRanges[name] = PropertyRange{min, max}
+}
+
+// Returns an error if prop, or a member of it if it is a class property,
+// is a number outside its range in the project.
+func (p *Project) checkPropertyRange(prop *Property) (err error) {
+	if prop.Members != nil {
+		for i := 0; i < len(prop.Members.Properties); i++ {
+			if err = p.checkPropertyRange(&prop.Members.Properties[i]); err != nil {
+				return fmt.Errorf("%v: %v", prop.Name, err)
+			}
+		}
+		return
+	}
+	var (
+		r, ok = p.PropertyRanges[prop.Name]
+		v     float64
+	)
+	if !ok || (prop.Type != "int" && prop.Type != "float") {
+		return
+	}
+	if v, err = strconv.ParseFloat(prop.Value, 64); err != nil {
+		return fmt.Errorf("%v: Invalid %v %q", prop.Name, prop.Type, prop.Value)
+	}
+	if v < r.Min || v > r.Max {
+		return fmt.Errorf("%v: Value %v out of range %v to %v", prop.Name, prop.Value, r.Min, r.Max)
+	}
+	return
+}
+
+// Statistics of the values of the int and float properties sharing a
+// name across a set of maps.
+type PropertyStats struct {
+	Name string
+
+	// The number of properties seen and how many of them were outside
+	// the range of the name in the Project of their map.
+	Count, OutOfRange int
+
+	Min, Max, Mean float64
+}
+
+// Collects statistics of the int and float properties of the maps,
+// including members of class properties, sorted by name. Comparing them
+// across a whole game makes typos such as a speed of 1000 among speeds
+// of 10 stand out, whether or not a range was set.
+func NumericPropertyStats(maps ...*Map) (stats []*PropertyStats) {
+	var (
+		byName = map[string]*PropertyStats{}
+		add    func(project *Project, prop *Property)
+	)
+	add = func(project *Project, prop *Property) {
+		if prop.Members != nil {
+			for i := 0; i < len(prop.Members.Properties); i++ {
+				add(project, &prop.Members.Properties[i])
+			}
+			return
+		}
+		if prop.Type != "int" && prop.Type != "float" {
+			return
+		}
+		var v, err = strconv.ParseFloat(prop.Value, 64)
+		if err != nil {
+			return
+		}
+		var s = byName[prop.Name]
+		if s == nil {
+			s = &PropertyStats{Name: prop.Name, Min: v, Max: v}
+			byName[prop.Name] = s
+			stats = append(stats, s)
+		}
+		if project != nil {
+			if r, ok := project.PropertyRanges[prop.Name]; ok && (v < r.Min || v > r.Max) {
+				s.OutOfRange++
+			}
+		}
+		if v < s.Min {
+			s.Min = v
+		}
+		if v > s.Max {
+			s.Max = v
+		}
+		s.Mean += (v - s.Mean) / float64(s.Count+1)
+		s.Count++
+	}
+	for i := 0; i < len(maps); i++ {
+		var project = maps[i].Project
+		maps[i].eachProperty(func(element string, prop *Property) error {
+			add(project, prop)
+			return nil
+		})
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Name < stats[b].Name })
+	return
+}
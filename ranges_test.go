@@ -0,0 +1,76 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"math"
+	"testing"
+)
+
+const TEST_RANGES_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <properties>
+  <property name="speed" type="float" value="50"/>
+ </properties>
+ <objectgroup name="actors">
+  <object name="slow" x="0" y="0">
+   <properties>
+    <property name="speed" type="int" value="10"/>
+    <property name="name" value="1000"/>
+   </properties>
+  </object>
+  <object name="typo" x="0" y="0">
+   <properties>
+    <property name="stats" type="class" propertytype="Stats">
+     <properties>
+      <property name="speed" type="int" value="1000"/>
+     </properties>
+    </property>
+   </properties>
+  </object>
+ </objectgroup>
+</map>
+`
+
+func TestPropertyRanges(t *testing.T) {
+	var (
+		m    *Map
+		errs []error
+		err  error
+	)
+	if m, err = ParseMapString(TEST_RANGES_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Project = &Project{}
+	m.Project.SetPropertyRange("speed", 0, 100)
+	if errs = m.ValidateProperties(); len(errs) != 1 {
+		t.Fatalf("Wrong number of problems: %v", errs)
+	}
+	if e, ok := errs[0].(*ValidationError); !ok || e.Element != "objectgroup actors object 1" {
+		t.Errorf("Wrong problem reported: %v", errs[0])
+	}
+	var stats = NumericPropertyStats(m, m)
+	if len(stats) != 1 {
+		t.Fatalf("Wrong stats: %v", stats)
+	}
+	if s := stats[0]; s.Name != "speed" || s.Count != 6 || s.OutOfRange != 2 || s.Min != 10 || s.Max != 1000 || math.Abs(s.Mean-1060.0/3) > 1e-9 {
+		t.Errorf("Wrong stats: %+v", s)
+	}
+	m.Project = nil
+	if errs = m.ValidateProperties(); len(errs) != 0 {
+		t.Errorf("Range checked without a project: %v", errs)
+	}
+}
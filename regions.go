@@ -0,0 +1,141 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+)
+
+// A connected area of similar tiles found by Layer.Regions.
+type Region struct {
+	// The label of the region's tiles.
+	Id int
+
+	// The tile the region was started from.
+	Tile DataTileGridTile
+
+	// The number of tiles in the region.
+	Size int
+
+	// The smallest rectangle of tiles containing the region, with Y
+	// growing down as in TMX files.
+	Bounds image.Rectangle
+}
+
+// Labels the connected areas of the layer, where two tiles sharing an
+// edge belong to the same area if equal returns true for them. If equal
+// is nil, tiles must have the same id and flip flags. Empty tiles are
+// labelled like any other, so they form regions too.
+//
+// Returns the label of every tile, indexed by x and y like the tiles of
+// a DataTileGrid, and the regions in order of their labels.
+func (l *Layer) Regions(equal func(a, b DataTileGridTile) bool) (labels [][]int, regions []Region, err error) {
+	var grid DataTileGrid
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	if equal == nil {
+		equal = func(a, b DataTileGridTile) bool { return a == b }
+	}
+	labels = make([][]int, grid.Width)
+	for x := 0; x < grid.Width; x++ {
+		labels[x] = make([]int, grid.Height)
+		for y := 0; y < grid.Height; y++ {
+			labels[x][y] = -1
+		}
+	}
+	for x := 0; x < grid.Width; x++ {
+		for y := 0; y < grid.Height; y++ {
+			if labels[x][y] != -1 {
+				continue
+			}
+			var (
+				region = Region{
+					Id:     len(regions),
+					Tile:   grid.Tiles[x][y],
+					Bounds: image.Rect(x, y, x+1, y+1),
+				}
+				stack = []image.Point{{x, y}}
+			)
+			labels[x][y] = region.Id
+			for len(stack) > 0 {
+				var p = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				region.Size++
+				region.Bounds = region.Bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+				for _, n := range [4]image.Point{{p.X - 1, p.Y}, {p.X + 1, p.Y}, {p.X, p.Y - 1}, {p.X, p.Y + 1}} {
+					if n.X < 0 || n.Y < 0 || n.X >= grid.Width || n.Y >= grid.Height || labels[n.X][n.Y] != -1 {
+						continue
+					}
+					if equal(grid.Tiles[p.X][p.Y], grid.Tiles[n.X][n.Y]) {
+						labels[n.X][n.Y] = region.Id
+						stack = append(stack, n)
+					}
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+	return
+}
+
+// A horizontal run of identical tiles within a layer row.
+type Span struct {
+	// The column of the first tile of the run.
+	X int
+
+	// The number of tiles in the run.
+	Length int
+
+	// The gid shared by the tiles, including flip flags.
+	Gid uint32
+}
+
+// Calls fn with every run of identical, non empty gids in row y of the
+// layer, from left to right, so horizontally repeated tiles can be drawn
+// or collided as a single rectangle. Iteration stops at the first error
+// fn returns, which is passed on to the caller.
+//
+// The layer data is decoded on every call, so to visit many rows decode
+// it once with GetGrid instead.
+func (l *Layer) RowSpans(y int, fn func(s Span) error) (err error) {
+	var tiles []DataTile
+	if y < 0 || y >= int(l.Height) {
+		return fmt.Errorf("Row %v out of range", y)
+	}
+	if tiles, err = l.Data.Tiles(); err != nil {
+		return
+	}
+	if len(tiles) != int(l.Width*l.Height) {
+		return fmt.Errorf("Tile length %v didn't match width x height (%v,%v)",
+			len(tiles), l.Width, l.Height)
+	}
+	var row = tiles[y*int(l.Width) : (y+1)*int(l.Width)]
+	for x := 0; x < len(row); {
+		var span = Span{X: x, Gid: row[x].Gid}
+		for x < len(row) && row[x].Gid == span.Gid {
+			x++
+		}
+		if span.Gid == 0 {
+			continue
+		}
+		span.Length = x - span.X
+		if err = fn(span); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestLayerRegions(t *testing.T) {
+	var (
+		grid    = NewDataTileGrid(4, 3)
+		layer   *Layer
+		labels  [][]int
+		regions []Region
+		err     error
+	)
+	// 1 1 0 2
+	// 0 1 0 2
+	// 0 0 0 1
+	grid.Tiles[0][0].Id = 1
+	grid.Tiles[1][0].Id = 1
+	grid.Tiles[1][1].Id = 1
+	grid.Tiles[3][0].Id = 2
+	grid.Tiles[3][1].Id = 2
+	grid.Tiles[3][2].Id = 1
+	grid.Tiles[3][2].FlipX = true
+	if layer, err = NewLayer("art", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	if labels, regions, err = layer.Regions(nil); err != nil {
+		t.Fatalf("Could not find regions: %v", err)
+	}
+	if len(regions) != 4 {
+		t.Fatalf("Invalid regions: %v", regions)
+	}
+	if r := regions[labels[1][1]]; r.Size != 3 || r.Tile.Id != 1 || r.Bounds != image.Rect(0, 0, 2, 2) {
+		t.Errorf("Invalid region: %v", r)
+	}
+	if r := regions[labels[2][2]]; r.Size != 6 || r.Tile.Id != 0 || r.Bounds != image.Rect(0, 0, 3, 3) {
+		t.Errorf("Invalid region: %v", r)
+	}
+	if labels[3][2] == labels[3][1] {
+		t.Errorf("Flipped tile joined different region")
+	}
+	if _, regions, err = layer.Regions(func(a, b DataTileGridTile) bool {
+		return (a.Id == 0) == (b.Id == 0)
+	}); err != nil {
+		t.Fatalf("Could not find regions: %v", err)
+	}
+	if len(regions) != 3 {
+		t.Errorf("Invalid regions: %v", regions)
+	}
+}
+
+func TestLayerRowSpans(t *testing.T) {
+	var (
+		grid  = NewDataTileGrid(6, 2)
+		layer *Layer
+		spans []Span
+		err   error
+	)
+	// 1 1 0 2 2 2
+	// 0 0 0 0 0 0
+	grid.Tiles[0][0].Id = 1
+	grid.Tiles[1][0].Id = 1
+	grid.Tiles[3][0].Id = 2
+	grid.Tiles[4][0].Id = 2
+	grid.Tiles[5][0].Id = 2
+	grid.Tiles[5][0].FlipY = true
+	if layer, err = NewLayer("art", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	var collect = func(s Span) error {
+		spans = append(spans, s)
+		return nil
+	}
+	if err = layer.RowSpans(0, collect); err != nil {
+		t.Fatalf("Could not get spans: %v", err)
+	}
+	var expected = []Span{
+		{X: 0, Length: 2, Gid: 1},
+		{X: 3, Length: 2, Gid: 2},
+		{X: 5, Length: 1, Gid: 2 | FLIPPED_V_FLAG},
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Invalid spans: %v", spans)
+	}
+	spans = nil
+	if err = layer.RowSpans(1, collect); err != nil || len(spans) != 0 {
+		t.Errorf("Expected no spans in empty row: %v %v", spans, err)
+	}
+	if err = layer.RowSpans(2, collect); err == nil {
+		t.Errorf("Expected error for row out of range")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"time"
+)
+
+// A map resolved for drawing: the tiles of every tile layer with their
+// positions and texture coordinates, grouped by the image they are drawn
+// from, and the decoded images. Built once after loading, so per-frame
+// code doesn't need to decode layer data or look up tilesets.
+type RenderModel struct {
+	// The tile layers of the map, in drawing order. Invisible layers are
+	// included, with Visible unset.
+	Layers []*RenderLayer
+
+	// The decoded tileset images, by the image element of the map they
+	// were loaded from.
+	Images map[*Image]image.Image
+
+	// The animations of the animated tiles drawn in the map, by the gid
+	// of the tile, including flip flags.
+	Animations map[uint32]*RenderAnimation
+}
+
+type RenderLayer struct {
+	Name    string
+	Opacity float32
+	Visible bool
+
+	// The offset of the layer in pixels, which is not applied to the
+	// bounds of its quads.
+	OffsetX, OffsetY float32
+
+	// Runs of quads drawn from the same image, in drawing order, which
+	// follows the render order of the map.
+	Batches []*RenderBatch
+}
+
+// Quads drawn from one image, which can be drawn with a single call.
+type RenderBatch struct {
+	Image   *Image
+	Texture image.Image
+	Quads   []RenderQuad
+}
+
+// A tile drawn on the map.
+type RenderQuad struct {
+	// The gid of the tile, including flip flags.
+	Gid uint32
+
+	// The bounds of the tile on the map, as in Tile.TileBounds.
+	Bounds Bounds
+
+	// The texture coordinates of the corners of the tile, normalized to
+	// the size of the decoded image, as returned by Tile.UV.
+	UV [4]Point
+
+	// The placement of the tile's image on the map, see Tile.Transform.
+	Transform Matrix
+
+	// The animation of the tile, or nil if the tile isn't animated.
+	Animation *RenderAnimation
+}
+
+// The frames of an animated tile.
+type RenderAnimation struct {
+	Frames []RenderFrame
+
+	// The sum of the durations of the frames.
+	Length time.Duration
+}
+
+// A frame of an animation, with the flip flags of the animated tile
+// applied to its texture coordinates.
+type RenderFrame struct {
+	Gid      uint32
+	Duration time.Duration
+	Image    *Image
+	UV       [4]Point
+}
+
+// Resolves the tile layers of the map into a RenderModel, decoding every
+// tileset image drawn from. Images are read through l, relative to
+// m.BaseDir, or through LoadImage if l is nil. Tiles from tilesets
+// without an image, including external tilesets which haven't been
+// embedded, are reported as errors.
+func (m *Map) BuildRenderModel(l *Loader) (model *RenderModel, err error) {
+	return m.BuildRenderModelContext(context.Background(), l)
+}
+
+// Like BuildRenderModel, but stops decoding the layer data and returns
+// ctx.Err() once ctx is done.
+func (m *Map) BuildRenderModelContext(ctx context.Context, l *Loader) (model *RenderModel, err error) {
+	model = &RenderModel{
+		Images:     map[*Image]image.Image{},
+		Animations: map[uint32]*RenderAnimation{},
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			layer = m.Layers[i]
+			rl    = &RenderLayer{
+				Name:    layer.Name,
+				Opacity: layer.Opacity,
+				Visible: layer.Visible,
+				OffsetX: layer.OffsetX,
+				OffsetY: layer.OffsetY,
+			}
+			batch *RenderBatch
+		)
+		err = m.TilesInRenderOrderContext(ctx, layer, func(x, y int, t *Tile) (err error) {
+			var (
+				img  = t.Tileset.imageFor(t.Index)
+				gid  = EncodeGID(t.Tileset.FirstGid+t.Index, t.FlipHorz, t.FlipVert, t.FlipDiag, false)
+				quad = RenderQuad{Gid: gid, Bounds: t.TileBounds, Transform: t.Transform()}
+			)
+			if img == nil {
+				return m.layerError(layer, fmt.Errorf("No image for tile %v of tileset %v", t.Index, t.Tileset.Name))
+			}
+			if batch == nil || batch.Image != img {
+				batch = &RenderBatch{Image: img}
+				if batch.Texture, err = model.texture(m, l, img); err != nil {
+					return m.layerError(layer, err)
+				}
+				rl.Batches = append(rl.Batches, batch)
+			}
+			quad.UV = normalizedUV(t, batch.Texture)
+			if quad.Animation, err = model.animation(m, l, t, gid); err != nil {
+				return m.layerError(layer, err)
+			}
+			batch.Quads = append(batch.Quads, quad)
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+		model.Layers = append(model.Layers, rl)
+	}
+	return
+}
+
+// Returns the decoded image of img, loading it on first use.
+func (model *RenderModel) texture(m *Map, l *Loader, img *Image) (decoded image.Image, err error) {
+	var ok bool
+	if decoded, ok = model.Images[img]; ok {
+		return
+	}
+	if l == nil {
+		decoded, err = m.LoadImage(img)
+	} else {
+		decoded, err = l.loadImage(m, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not load image %v: %v", img.Source, err)
+	}
+	model.Images[img] = decoded
+	return
+}
+
+// Decodes the file referenced by img from l.FS, relative to m.BaseDir.
+func (l *Loader) loadImage(m *Map, img *Image) (decoded image.Image, err error) {
+	var (
+		r    io.ReadCloser
+		name = img.Source
+	)
+	if img.Source == "" {
+		err = fmt.Errorf("Embedded images are not supported")
+		return
+	}
+	if !path.IsAbs(name) {
+		name = path.Join(m.BaseDir, name)
+	}
+	if r, err = l.FS.Open(name); err != nil {
+		return
+	}
+	defer r.Close()
+	decoded, _, err = image.Decode(r)
+	return
+}
+
+// Returns the animation of tile t drawn with gid, or nil if the tile
+// isn't animated. Animations are shared by all quads with the same gid.
+func (model *RenderModel) animation(m *Map, l *Loader, t *Tile, gid uint32) (a *RenderAnimation, err error) {
+	var (
+		ts     = t.Tileset
+		frames []Frame
+		ok     bool
+	)
+	if a, ok = model.Animations[gid]; ok {
+		return
+	}
+	for i := 0; i < len(ts.TilesetTile); i++ {
+		if ts.TilesetTile[i].Id == t.Index && ts.TilesetTile[i].Animation != nil {
+			frames = ts.TilesetTile[i].Animation.Frames
+		}
+	}
+	if len(frames) == 0 {
+		return
+	}
+	a = &RenderAnimation{}
+	for i := 0; i < len(frames); i++ {
+		var (
+			frame = *t
+			rf    = RenderFrame{
+				Gid:      ts.FirstGid + frames[i].TileId,
+				Duration: time.Duration(frames[i].Duration) * time.Millisecond,
+				Image:    ts.imageFor(frames[i].TileId),
+			}
+			texture image.Image
+		)
+		if rf.Image == nil {
+			return nil, fmt.Errorf("No image for tile %v of tileset %v", frames[i].TileId, ts.Name)
+		}
+		if texture, err = model.texture(m, l, rf.Image); err != nil {
+			return nil, err
+		}
+		frame.Index = frames[i].TileId
+		frame.TextureBounds = ts.TextureBoundsFrom(frame.Index, frame.Origin)
+		rf.UV = normalizedUV(&frame, texture)
+		a.Frames = append(a.Frames, rf)
+		a.Length += rf.Duration
+	}
+	model.Animations[gid] = a
+	return
+}
+
+// Returns the texture coordinates of t normalized to the size of the
+// decoded image rather than the size given in the map, which may be
+// missing.
+func normalizedUV(t *Tile, texture image.Image) (uv [4]Point) {
+	var (
+		size = texture.Bounds().Size()
+		w, h = float32(size.X), float32(size.Y)
+	)
+	uv = t.UV(false)
+	for i := 0; i < len(uv); i++ {
+		if w > 0 && h > 0 {
+			uv[i].X /= w
+			uv[i].Y /= h
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBuildRenderModel(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"maps/level.tmx":  &fstest.MapFile{Data: []byte(TEST_ANIMATION_MAP)},
+			"maps/strip.png":  &fstest.MapFile{Data: testStripPNG(t, 4)},
+			"other/strip.png": &fstest.MapFile{Data: testStripPNG(t, 2)},
+		})
+		m     *Map
+		model *RenderModel
+		empty *Layer
+		err   error
+	)
+	if m, err = loader.ParseMapFile("maps/level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if model, err = m.BuildRenderModel(nil); err != nil {
+		t.Fatalf("Could not build render model: %v", err)
+	}
+	if len(model.Layers) != 1 || len(model.Layers[0].Batches) != 1 || len(model.Layers[0].Batches[0].Quads) != 1 {
+		t.Fatalf("Wrong layers: %v", model.Layers)
+	}
+	var (
+		batch = model.Layers[0].Batches[0]
+		quad  = batch.Quads[0]
+	)
+	if batch.Image != m.Tilesets[0].Image || batch.Texture.Bounds().Dx() != 64 || len(model.Images) != 1 {
+		t.Errorf("Wrong texture: %v", batch.Texture.Bounds())
+	}
+	if quad.Gid != 1 || quad.Bounds != (Bounds{0, 0, 16, 16}) {
+		t.Errorf("Wrong quad: %v", quad)
+	}
+	if quad.UV != [4]Point{{0, 1}, {0.25, 1}, {0.25, 0}, {0, 0}} {
+		t.Errorf("Wrong texture coordinates: %v", quad.UV)
+	}
+	if quad.Animation == nil || quad.Animation != model.Animations[1] {
+		t.Fatalf("Animation not indexed: %v", model.Animations)
+	}
+	if a := quad.Animation; len(a.Frames) != 2 || a.Length != 350*time.Millisecond {
+		t.Fatalf("Wrong animation: %v", a)
+	}
+	if f := quad.Animation.Frames[0]; f.Gid != 3 || f.Duration != 100*time.Millisecond || f.UV[1] != (Point{0.75, 1}) {
+		t.Errorf("Wrong first frame: %v", f)
+	}
+	if empty, err = NewLayer("empty", NewDataTileGrid(1, 1)); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	m.Layers = append(m.Layers, empty)
+	if model, err = m.BuildRenderModel(nil); err != nil {
+		t.Fatalf("Could not build render model with empty layer: %v", err)
+	}
+	if len(model.Layers) != 2 || len(model.Layers[1].Batches) != 0 {
+		t.Errorf("Wrong empty layer: %v", model.Layers)
+	}
+	m.BaseDir = "other"
+	if model, err = m.BuildRenderModel(loader); err != nil {
+		t.Fatalf("Could not build render model through loader: %v", err)
+	}
+	if uv := model.Layers[0].Batches[0].Quads[0].UV; uv[1] != (Point{0.5, 1}) {
+		t.Errorf("Coordinates not normalized to image read through loader: %v", uv)
+	}
+	m.Tilesets[0].Image = nil
+	if _, err = m.BuildRenderModel(loader); err == nil {
+		t.Errorf("Expected error for tileset without image")
+	}
+}
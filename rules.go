@@ -0,0 +1,259 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// A set of rules replacing tiles based on their 3x3 neighborhood, for
+// simple decoration passes such as adding edges or shadows. Rules are
+// usually read from a JSON file such as:
+//
+//	{
+//	  "symbols": {
+//	    "#": {"property": "solid", "value": "true"},
+//	    ".": {"empty": true}
+//	  },
+//	  "rules": [
+//	    {"name": "shadow", "pattern": ["?#?", "?.?", "???"],
+//	     "replace": {"tileset": "decor", "id": 4}}
+//	  ]
+//	}
+type TileRules struct {
+	// The conditions the single character symbols of patterns stand for.
+	// The symbol "?" is reserved and matches any tile.
+	Symbols map[string]*TileCondition `json:"symbols"`
+
+	// The rules, in order of priority.
+	Rules []*TileRule `json:"rules"`
+}
+
+// Replaces the center of every 3x3 neighborhood matching Pattern.
+type TileRule struct {
+	Name string `json:"name"`
+
+	// Three rows of three symbols, from the top left.
+	Pattern [3]string `json:"pattern"`
+
+	Replace TileRef `json:"replace"`
+}
+
+// Refers to a tile by its local id in the tileset called Tileset, or by
+// its gid if Tileset is empty. A gid of 0 is the empty tile.
+type TileRef struct {
+	Tileset string `json:"tileset,omitempty"`
+	Id      uint32 `json:"id"`
+}
+
+// A test on a tile. All conditions given must hold, and Not inverts the
+// result. Flip flags are ignored. Cells outside the layer are empty.
+type TileCondition struct {
+	// The tile must be empty.
+	Empty bool `json:"empty,omitempty"`
+
+	// The tile must be the one Tileset and Id refer to as in TileRef,
+	// or if Id is not set, come from the tileset called Tileset.
+	Tileset string  `json:"tileset,omitempty"`
+	Id      *uint32 `json:"id,omitempty"`
+
+	// The tileset tile must have a property of this name, with the
+	// given value if Value is set.
+	Property string  `json:"property,omitempty"`
+	Value    *string `json:"value,omitempty"`
+
+	Not bool `json:"not,omitempty"`
+}
+
+// Reads tile rules in the JSON format shown for TileRules. Symbols and
+// patterns are only checked once the rules are applied to a map.
+func ParseTileRules(r io.Reader) (rules *TileRules, err error) {
+	rules = &TileRules{}
+	if err = json.NewDecoder(r).Decode(rules); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Reads tile rules from the JSON file at filename, as ParseTileRules.
+func ParseTileRulesFile(filename string) (rules *TileRules, err error) {
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	return ParseTileRules(f)
+}
+
+// Returns the gid r refers to in m.
+func (m *Map) tileRefGid(r TileRef) (gid uint32, err error) {
+	if r.Tileset == "" {
+		return r.Id, nil
+	}
+	var ts *Tileset
+	if ts, err = m.TilesetByName(r.Tileset); err != nil {
+		return
+	}
+	return ts.FirstGid + r.Id, nil
+}
+
+// Turns c into a test on gids of m.
+func (m *Map) compileCondition(c *TileCondition) (test func(gid uint32) bool, err error) {
+	var (
+		ts  *Tileset
+		gid uint32
+	)
+	if c == nil {
+		return nil, fmt.Errorf("Missing condition")
+	}
+	if c.Id != nil {
+		if gid, err = m.tileRefGid(TileRef{c.Tileset, *c.Id}); err != nil {
+			return
+		}
+	} else if c.Tileset != "" {
+		if ts, err = m.TilesetByName(c.Tileset); err != nil {
+			return
+		}
+	}
+	test = func(g uint32) bool {
+		var match = true
+		g &^= CLEAR_FLIP
+		if c.Empty && g != 0 {
+			match = false
+		}
+		if c.Id != nil && g != gid {
+			match = false
+		}
+		if ts != nil {
+			if found, err := m.TilesetForGid(g); err != nil || found != ts {
+				match = false
+			}
+		}
+		if c.Property != "" && !m.tileHasProperty(g, c.Property, c.Value) {
+			match = false
+		}
+		return match != c.Not
+	}
+	return
+}
+
+func (m *Map) tileHasProperty(gid uint32, name string, value *string) bool {
+	if gid == 0 {
+		return false
+	}
+	var tile, _, err = m.TilesetTileForGid(gid)
+	if err != nil || tile == nil {
+		return false
+	}
+	for i := 0; i < len(tile.Properties); i++ {
+		var p = tile.Properties[i]
+		if p.Name == name && (value == nil || p.Value == *value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies the rules to the tiles of src, writing replacements to the
+// same cells of dst, which may be src and must be the same size. Every
+// cell is matched against the tiles of src as they were before any
+// replacement, and only the first matching rule is applied. Returns the
+// number of cells replaced.
+func (m *Map) ApplyTileRules(rules *TileRules, src, dst *Layer) (replaced int, err error) {
+	var (
+		tests    = make([][9]func(gid uint32) bool, len(rules.Rules))
+		gids     = make([]uint32, len(rules.Rules))
+		symbols  = map[rune]func(gid uint32) bool{'?': nil}
+		from, to DataTileGrid
+	)
+	for s, c := range rules.Symbols {
+		var r, size = utf8.DecodeRuneInString(s)
+		if size != len(s) || r == '?' {
+			return 0, fmt.Errorf("Invalid symbol %q", s)
+		}
+		if symbols[r], err = m.compileCondition(c); err != nil {
+			return 0, fmt.Errorf("Symbol %v: %v", s, err)
+		}
+	}
+	for i := 0; i < len(rules.Rules); i++ {
+		var rule = rules.Rules[i]
+		if rule == nil {
+			return 0, fmt.Errorf("Rule %v: missing", i)
+		}
+		for y := 0; y < 3; y++ {
+			var row = []rune(rule.Pattern[y])
+			if len(row) != 3 {
+				return 0, fmt.Errorf("Rule %v: pattern row %q is not 3 symbols", rule.Name, rule.Pattern[y])
+			}
+			for x := 0; x < 3; x++ {
+				var test, ok = symbols[row[x]]
+				if !ok {
+					return 0, fmt.Errorf("Rule %v: undefined symbol %q", rule.Name, row[x])
+				}
+				tests[i][y*3+x] = test
+			}
+		}
+		if gids[i], err = m.tileRefGid(rule.Replace); err != nil {
+			return 0, fmt.Errorf("Rule %v: %v", rule.Name, err)
+		}
+	}
+	if from, err = src.GetGrid(); err != nil {
+		return 0, m.layerError(src, err)
+	}
+	if to, err = dst.GetGrid(); err != nil {
+		return 0, m.layerError(dst, err)
+	}
+	if to.Width != from.Width || to.Height != from.Height {
+		return 0, m.layerError(dst, fmt.Errorf("Size %vx%v does not match %vx%v of %v",
+			to.Width, to.Height, from.Width, from.Height, src.Name))
+	}
+	if dst == src {
+		to = NewDataTileGrid(from.Width, from.Height)
+		for x := 0; x < from.Width; x++ {
+			copy(to.Tiles[x], from.Tiles[x])
+		}
+	}
+	var at = func(x, y int) uint32 {
+		if x < 0 || y < 0 || x >= from.Width || y >= from.Height {
+			return 0
+		}
+		return uint32(from.Tiles[x][y].GID())
+	}
+	for x := 0; x < from.Width; x++ {
+		for y := 0; y < from.Height; y++ {
+			for i := 0; i < len(tests); i++ {
+				var match = true
+				for j := 0; j < 9 && match; j++ {
+					if tests[i][j] != nil {
+						match = tests[i][j](at(x+j%3-1, y+j/3-1))
+					}
+				}
+				if match {
+					to.Tiles[x][y] = gridTile(gids[i])
+					replaced++
+					break
+				}
+			}
+		}
+	}
+	if err = dst.SetGrid(to); err != nil {
+		return 0, m.layerError(dst, err)
+	}
+	return
+}
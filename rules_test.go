@@ -0,0 +1,105 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+)
+
+const TEST_RULES_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="3" height="3" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="ground" tilewidth="16" tileheight="16" tilecount="2">
+  <tile id="0">
+   <properties>
+    <property name="solid" value="true"/>
+   </properties>
+  </tile>
+ </tileset>
+ <tileset firstgid="3" name="decor" tilewidth="16" tileheight="16" tilecount="2"/>
+ <layer name="ground" width="3" height="3">
+  <data encoding="csv">1,1,1,
+0,0,2,
+0,0,0</data>
+ </layer>
+ <layer name="shadows" width="3" height="3">
+  <data encoding="csv">0,0,0,
+0,0,0,
+0,0,0</data>
+ </layer>
+</map>
+`
+
+const TEST_RULES = `{
+  "symbols": {
+    "#": {"property": "solid", "value": "true"},
+    ".": {"empty": true},
+    "d": {"tileset": "decor", "not": true}
+  },
+  "rules": [
+    {"name": "shadow", "pattern": ["?#?", "?.?", "???"], "replace": {"tileset": "decor", "id": 0}},
+    {"name": "edge", "pattern": ["???", "?.d", "???"], "replace": {"tileset": "decor", "id": 1}}
+  ]
+}`
+
+func TestApplyTileRules(t *testing.T) {
+	var (
+		m        *Map
+		rules    *TileRules
+		grid     DataTileGrid
+		replaced int
+		err      error
+	)
+	if m, err = ParseMapString(TEST_RULES_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if rules, err = ParseTileRules(strings.NewReader(TEST_RULES)); err != nil {
+		t.Fatalf("Could not parse rules: %v", err)
+	}
+	if replaced, err = m.ApplyTileRules(rules, m.Layers[0], m.Layers[1]); err != nil {
+		t.Fatalf("Could not apply rules: %v", err)
+	}
+	if grid, err = m.Layers[1].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	// The shadow rule takes priority over the edge rule at 1,1, and
+	// cells outside the layer are empty, so 2,2 is an edge too.
+	var expected = [3][3]uint32{{0, 0, 0}, {3, 3, 0}, {4, 4, 4}}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			if gid := uint32(grid.Tiles[x][y].GID()); gid != expected[y][x] {
+				t.Errorf("Tile %v,%v was %v, expected %v", x, y, gid, expected[y][x])
+			}
+		}
+	}
+	if replaced != 5 {
+		t.Errorf("Replaced %v tiles, expected 5", replaced)
+	}
+	rules.Rules[0].Pattern[0] = "?x?"
+	if _, err = m.ApplyTileRules(rules, m.Layers[0], m.Layers[0]); err == nil {
+		t.Errorf("Expected error for undefined symbol")
+	}
+	if rules, err = ParseTileRules(strings.NewReader(`{"symbols": {"#": null}, "rules": [null]}`)); err != nil {
+		t.Fatalf("Could not parse rules: %v", err)
+	}
+	if _, err = m.ApplyTileRules(rules, m.Layers[0], m.Layers[0]); err == nil {
+		t.Errorf("Expected error for null symbol")
+	}
+	delete(rules.Symbols, "#")
+	if _, err = m.ApplyTileRules(rules, m.Layers[0], m.Layers[0]); err == nil {
+		t.Errorf("Expected error for null rule")
+	}
+}
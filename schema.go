@@ -0,0 +1,182 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The number of distinct values listed per property by SurveyObjects.
+// Properties with more values only report whether they were exceeded.
+const OBJECT_SURVEY_MAX_VALUES = 8
+
+// What a set of maps uses objects of one type for.
+type ObjectClass struct {
+	// The type of the objects, empty for objects without one.
+	Type string
+
+	// The number of objects of the type.
+	Count int
+
+	// The properties set on objects of the type, sorted by name.
+	Properties []*PropertySurvey
+}
+
+// The values one property takes on the objects of a class.
+type PropertySurvey struct {
+	Name string
+
+	// The property type, "string" where none is given, or "mixed" if
+	// objects disagree on the type.
+	Type string
+
+	// The number of objects setting the property.
+	Count int
+
+	// The distinct values seen, sorted, up to OBJECT_SURVEY_MAX_VALUES.
+	// More is set if there were further values.
+	Values []string
+	More   bool
+
+	// For int and float properties, the smallest and largest value seen.
+	Min, Max float64
+
+	seen   map[string]bool
+	ranged bool
+}
+
+// Collects every object type used in the maps along with the properties
+// objects of the type set and the values they take, documenting the
+// implicit conventions level designers follow. Only the properties of
+// the objects themselves are considered, not those of the tiles shown
+// by tile objects. Classes are sorted by type.
+func SurveyObjects(maps ...*Map) (classes []*ObjectClass) {
+	var (
+		byType  = map[string]*ObjectClass{}
+		surveys = map[*ObjectClass]map[string]*PropertySurvey{}
+	)
+	for i := 0; i < len(maps); i++ {
+		maps[i].EachObject(func(g *ObjectGroup, o *Object) error {
+			var c = byType[o.Type]
+			if c == nil {
+				c = &ObjectClass{Type: o.Type}
+				byType[o.Type] = c
+				surveys[c] = map[string]*PropertySurvey{}
+				classes = append(classes, c)
+			}
+			c.Count++
+			for j := 0; j < len(o.Properties); j++ {
+				var (
+					prop = &o.Properties[j]
+					s    = surveys[c][prop.Name]
+				)
+				if s == nil {
+					s = &PropertySurvey{Name: prop.Name, seen: map[string]bool{}}
+					surveys[c][prop.Name] = s
+					c.Properties = append(c.Properties, s)
+				}
+				s.add(prop)
+			}
+			return nil
+		})
+	}
+	sort.Slice(classes, func(a, b int) bool { return classes[a].Type < classes[b].Type })
+	for i := 0; i < len(classes); i++ {
+		var props = classes[i].Properties
+		sort.Slice(props, func(a, b int) bool { return props[a].Name < props[b].Name })
+		for j := 0; j < len(props); j++ {
+			sort.Strings(props[j].Values)
+			props[j].seen = nil
+		}
+	}
+	return
+}
+
+func (s *PropertySurvey) add(prop *Property) {
+	var typ = prop.Type
+	if typ == "" {
+		typ = "string"
+	}
+	switch {
+	case s.Count == 0:
+		s.Type = typ
+	case s.Type != typ:
+		s.Type = "mixed"
+	}
+	if s.Type == "int" || s.Type == "float" {
+		if v, err := strconv.ParseFloat(prop.Value, 64); err == nil {
+			if !s.ranged || v < s.Min {
+				s.Min = v
+			}
+			if !s.ranged || v > s.Max {
+				s.Max = v
+			}
+			s.ranged = true
+		}
+	}
+	s.Count++
+	if typ == "class" || s.seen[prop.Value] {
+		return
+	}
+	s.seen[prop.Value] = true
+	if len(s.Values) < OBJECT_SURVEY_MAX_VALUES {
+		s.Values = append(s.Values, prop.Value)
+	} else {
+		s.More = true
+	}
+}
+
+// Writes a plain text report of classes, one block per class such as:
+//
+//	enemy (12 objects)
+//	  health int, set on 12 objects, 10 to 50
+//	  patrol bool, set on 4 objects: false, true
+func WriteObjectReport(w io.Writer, classes []*ObjectClass) (err error) {
+	for i := 0; i < len(classes); i++ {
+		var (
+			c    = classes[i]
+			name = c.Type
+		)
+		if name == "" {
+			name = "(no type)"
+		}
+		if _, err = fmt.Fprintf(w, "%v (%v objects)\n", name, c.Count); err != nil {
+			return
+		}
+		for j := 0; j < len(c.Properties); j++ {
+			var (
+				s    = c.Properties[j]
+				line = fmt.Sprintf("  %v %v, set on %v objects", s.Name, s.Type, s.Count)
+			)
+			switch {
+			case s.Type == "int" || s.Type == "float":
+				line += fmt.Sprintf(", %v to %v", s.Min, s.Max)
+			case len(s.Values) > 0:
+				line += ": " + strings.Join(s.Values, ", ")
+				if s.More {
+					line += ", ..."
+				}
+			}
+			if _, err = fmt.Fprintln(w, line); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"bytes"
+	"testing"
+)
+
+const TEST_SCHEMA_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <objectgroup name="actors">
+  <object name="a" type="enemy" x="0" y="0">
+   <properties>
+    <property name="health" type="int" value="50"/>
+    <property name="patrol" type="bool" value="true"/>
+   </properties>
+  </object>
+  <object name="b" type="enemy" x="0" y="0">
+   <properties>
+    <property name="health" type="int" value="10"/>
+   </properties>
+  </object>
+  <object name="c" x="0" y="0"/>
+ </objectgroup>
+</map>
+`
+
+func TestSurveyObjects(t *testing.T) {
+	var (
+		m       *Map
+		classes []*ObjectClass
+		report  bytes.Buffer
+		err     error
+	)
+	if m, err = ParseMapString(TEST_SCHEMA_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	classes = SurveyObjects(m, m)
+	if len(classes) != 2 || classes[0].Type != "" || classes[1].Type != "enemy" || classes[1].Count != 4 {
+		t.Fatalf("Invalid classes: %v", classes)
+	}
+	var props = classes[1].Properties
+	if len(props) != 2 || props[0].Name != "health" || props[0].Count != 4 || props[0].Min != 10 || props[0].Max != 50 {
+		t.Errorf("Invalid health survey: %+v", props[0])
+	}
+	if err = WriteObjectReport(&report, classes); err != nil {
+		t.Fatalf("Could not write report: %v", err)
+	}
+	var expected = "(no type) (2 objects)\n" +
+		"enemy (4 objects)\n" +
+		"  health int, set on 4 objects, 10 to 50\n" +
+		"  patrol bool, set on 2 objects: true\n"
+	if report.String() != expected {
+		t.Errorf("Invalid report:\n%v", report.String())
+	}
+}
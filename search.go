@@ -0,0 +1,133 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"context"
+)
+
+// A tile found on a layer of a map.
+type TileMatch struct {
+	Layer *Layer
+
+	// The position of the tile in the layer, with Y growing down as in
+	// TMX files.
+	X, Y int32
+
+	Tile *Tile
+}
+
+// Returns the tile with local id in the tileset, or nil if the tileset
+// defines no metadata for it.
+func (t *Tileset) TileById(id uint32) *TilesetTile {
+	for i := 0; i < len(t.TilesetTile); i++ {
+		if t.TilesetTile[i].Id == id {
+			return &t.TilesetTile[i]
+		}
+	}
+	return nil
+}
+
+// Maps gids to the tiles with metadata of the map's tilesets, along with
+// what it was built from so changes to the tilesets can be detected.
+type tileIndex struct {
+	tiles    map[uint32]*TilesetTile
+	tilesets []*Tileset
+	firsts   []uint32
+	counts   []int
+}
+
+// Returns whether the index was built from tilesets as they are now.
+func (x *tileIndex) current(tilesets []*Tileset) bool {
+	if x == nil || len(x.tilesets) != len(tilesets) {
+		return false
+	}
+	for i := 0; i < len(tilesets); i++ {
+		if x.tilesets[i] != tilesets[i] || x.firsts[i] != tilesets[i].FirstGid || x.counts[i] != len(tilesets[i].TilesetTile) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the metadata of the tile with the given gid, such as its
+// properties, animation and terrain, along with the tileset containing
+// it. Flip flags are ignored. The tile is nil if the tileset defines no
+// metadata for it. An index of the tiles is built on first use and
+// rebuilt when tilesets are added, removed or gain tiles, so calls are
+// not safe to make concurrently.
+func (m *Map) TilesetTileForGid(gid uint32) (tile *TilesetTile, ts *Tileset, err error) {
+	if ts, err = m.TilesetForGid(gid); err != nil {
+		return
+	}
+	if !m.tileIndex.current(m.Tilesets) {
+		m.buildTileIndex()
+	}
+	tile = m.tileIndex.tiles[gid&^CLEAR_FLIP]
+	return
+}
+
+func (m *Map) buildTileIndex() {
+	var x = &tileIndex{
+		tiles:    map[uint32]*TilesetTile{},
+		tilesets: append([]*Tileset{}, m.Tilesets...),
+		firsts:   make([]uint32, len(m.Tilesets)),
+		counts:   make([]int, len(m.Tilesets)),
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		var ts = m.Tilesets[i]
+		x.firsts[i] = ts.FirstGid
+		x.counts[i] = len(ts.TilesetTile)
+		for j := 0; j < len(ts.TilesetTile); j++ {
+			x.tiles[ts.FirstGid+ts.TilesetTile[j].Id] = &ts.TilesetTile[j]
+		}
+	}
+	m.tileIndex = x
+}
+
+// Returns every tile of every layer whose tileset tile has a property
+// named property with the given value, in layer order and then row by row.
+func (m *Map) FindTiles(property, value string) (matches []TileMatch, err error) {
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			layer = m.Layers[i]
+			tiles []*Tile
+		)
+		if tiles, err = m.tilesFromLayer(context.Background(), layer); err != nil {
+			return
+		}
+		for j := 0; j < len(tiles); j++ {
+			if tiles[j] == nil {
+				continue
+			}
+			var tt = tiles[j].Tileset.TileById(tiles[j].Index)
+			if tt == nil {
+				continue
+			}
+			for k := 0; k < len(tt.Properties); k++ {
+				if tt.Properties[k].Name == property && tt.Properties[k].Value == value {
+					matches = append(matches, TileMatch{
+						Layer: layer,
+						X:     int32(j) % layer.Width,
+						Y:     int32(j) / layer.Width,
+						Tile:  tiles[j],
+					})
+					break
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+)
+
+func TestFindTiles(t *testing.T) {
+	var (
+		m       *Map
+		matches []TileMatch
+		err     error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if matches, err = m.FindTiles("kind", "door"); err != nil {
+		t.Fatalf("Could not search: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("Invalid matches: %v", matches)
+	}
+	if matches[0].Layer.Name != "ground" || matches[0].X != 0 || matches[0].Y != 0 || matches[0].Tile.Index != 1 {
+		t.Errorf("Invalid match: %v", matches[0])
+	}
+	if matches, err = m.FindTiles("kind", "chest"); err != nil || len(matches) != 0 {
+		t.Errorf("Unexpected matches: %v %v", matches, err)
+	}
+}
+
+func TestTilesetTileForGid(t *testing.T) {
+	var (
+		m    *Map
+		tile *TilesetTile
+		ts   *Tileset
+		err  error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if tile, ts, err = m.TilesetTileForGid(2 | FLIPPED_H_FLAG); err != nil {
+		t.Fatalf("Could not look up tile: %v", err)
+	}
+	if tile == nil || tile.Properties.ToMap()["kind"] != "door" || ts.Name != "a" {
+		t.Errorf("Invalid tile: %v %v", tile, ts)
+	}
+	if tile, ts, err = m.TilesetTileForGid(10); err != nil || tile != nil || ts.Name != "c" {
+		t.Errorf("Expected tileset without tile metadata: %v %v %v", tile, ts, err)
+	}
+	m.Tilesets[2].TilesetTile = append(m.Tilesets[2].TilesetTile, TilesetTile{Id: 1})
+	if tile, _, err = m.TilesetTileForGid(10); err != nil || tile == nil || tile.Id != 1 {
+		t.Errorf("Index not rebuilt: %v %v", tile, err)
+	}
+	if _, _, err = m.TilesetTileForGid(13); err == nil {
+		t.Errorf("Expected error for gid outside of tilesets")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The map properties reserved for the export stamp. Tools reading
+// stamped maps should ignore properties starting with STAMP_PREFIX.
+const (
+	STAMP_PREFIX       = "tmxgo:"
+	STAMP_VERSION      = STAMP_PREFIX + "stampversion"
+	STAMP_TOOL_VERSION = STAMP_PREFIX + "toolversion"
+	STAMP_SOURCE_HASH  = STAMP_PREFIX + "sourcehash"
+	STAMP_BUILD_TIME   = STAMP_PREFIX + "buildtime"
+	STAMP_SIGNATURE    = STAMP_PREFIX + "signature"
+)
+
+// The version of the stamp format written by Stamp. Stamps of a later
+// version are rejected by ReadStamp.
+const STAMP_FORMAT_VERSION = 1
+
+// Pipeline metadata recorded in an exported map, so a shipped map can be
+// traced back to the revision of the source map it was built from.
+type ExportStamp struct {
+	// The version of the tool that exported the map.
+	ToolVersion string
+
+	// The hex encoded SHA-256 hash of the source map file, see
+	// SourceHash.
+	SourceHash string
+
+	// When the map was exported. Stored in UTC with second precision.
+	BuildTime time.Time
+
+	// Whether the stamp carried a signature which was verified.
+	Signed bool
+}
+
+// Returns the hex encoded SHA-256 hash of the source map file data, as
+// stored in ExportStamp.SourceHash.
+func SourceHash(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Records s in the reserved properties of the map, replacing any stamp
+// the map had before. If key is set, the stamp is signed with an
+// HMAC-SHA256 of its fields, so ReadStamp can tell whether it was
+// written by someone holding the key. The signature covers the stamp
+// only, not the contents of the map.
+func (m *Map) Stamp(s ExportStamp, key []byte) {
+	var values = map[string]string{
+		STAMP_VERSION:      strconv.Itoa(STAMP_FORMAT_VERSION),
+		STAMP_TOOL_VERSION: s.ToolVersion,
+		STAMP_SOURCE_HASH:  s.SourceHash,
+		STAMP_BUILD_TIME:   s.BuildTime.UTC().Format(time.RFC3339),
+	}
+	m.Properties = withoutStamp(m.Properties)
+	if key != nil {
+		values[STAMP_SIGNATURE] = stampSignature(values, key)
+	}
+	var stamp Properties
+	stamp.FromMap(values)
+	m.Properties = append(m.Properties, stamp...)
+}
+
+// Reads the stamp recorded by Stamp. Returns ok false if the map has no
+// stamp. Returns an error if the stamp is malformed, of a later format
+// version, or, if key is set, not signed with key.
+func (m *Map) ReadStamp(key []byte) (s ExportStamp, ok bool, err error) {
+	var (
+		values  = map[string]string{}
+		version int
+	)
+	for i := 0; i < len(m.Properties); i++ {
+		if strings.HasPrefix(m.Properties[i].Name, STAMP_PREFIX) {
+			values[m.Properties[i].Name] = m.Properties[i].Value
+		}
+	}
+	if _, ok = values[STAMP_VERSION]; !ok {
+		return
+	}
+	if version, err = strconv.Atoi(values[STAMP_VERSION]); err != nil {
+		err = fmt.Errorf("Invalid stamp version %v", values[STAMP_VERSION])
+		return
+	}
+	if version > STAMP_FORMAT_VERSION {
+		err = fmt.Errorf("Unsupported stamp version %v", version)
+		return
+	}
+	if s.BuildTime, err = time.Parse(time.RFC3339, values[STAMP_BUILD_TIME]); err != nil {
+		err = fmt.Errorf("Invalid stamp build time %v", values[STAMP_BUILD_TIME])
+		return
+	}
+	s.ToolVersion = values[STAMP_TOOL_VERSION]
+	s.SourceHash = values[STAMP_SOURCE_HASH]
+	if key != nil {
+		var (
+			signature = values[STAMP_SIGNATURE]
+			expected  = stampSignature(values, key)
+		)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			err = fmt.Errorf("Stamp signature does not match")
+			return
+		}
+		s.Signed = true
+	}
+	return
+}
+
+// Checks that the map carries a stamp, signed with key if set, for the
+// source map file data.
+func (m *Map) VerifyStamp(source []byte, key []byte) (err error) {
+	var (
+		s  ExportStamp
+		ok bool
+	)
+	if s, ok, err = m.ReadStamp(key); err != nil {
+		return
+	}
+	if !ok {
+		return fmt.Errorf("Map has no stamp")
+	}
+	if hash := SourceHash(source); s.SourceHash != hash {
+		return fmt.Errorf("Stamp source hash %v does not match source %v", s.SourceHash, hash)
+	}
+	return
+}
+
+// Returns the properties without the reserved stamp properties.
+func withoutStamp(props Properties) (out Properties) {
+	for i := 0; i < len(props); i++ {
+		if !strings.HasPrefix(props[i].Name, STAMP_PREFIX) {
+			out = append(out, props[i])
+		}
+	}
+	return
+}
+
+// Returns the hex encoded HMAC-SHA256 of the stamp properties in values,
+// other than the signature itself, keyed by key. Each value is prefixed
+// with its length, so that no value can pass for several.
+func stampSignature(values map[string]string, key []byte) string {
+	var (
+		mac   = hmac.New(sha256.New, key)
+		names = []string{STAMP_VERSION, STAMP_TOOL_VERSION, STAMP_SOURCE_HASH, STAMP_BUILD_TIME}
+	)
+	for i := 0; i < len(names); i++ {
+		var value = values[names[i]]
+		fmt.Fprintf(mac, "%v=%v:%v\n", names[i], len(value), value)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
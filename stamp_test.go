@@ -0,0 +1,81 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportStamp(t *testing.T) {
+	var (
+		source     = []byte(TEST_MAP)
+		key        = []byte("secret")
+		built      = time.Date(2014, 6, 1, 12, 30, 0, 0, time.UTC)
+		m          *Map
+		s          ExportStamp
+		ok         bool
+		serialized string
+		err        error
+	)
+	if m, err = ParseMapString(TEST_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, ok, err = m.ReadStamp(nil); ok || err != nil {
+		t.Errorf("Unstamped map read as stamped: %v, %v", ok, err)
+	}
+	m.Stamp(ExportStamp{ToolVersion: "1.0", SourceHash: "stale", BuildTime: built}, nil)
+	m.Stamp(ExportStamp{ToolVersion: "1.2", SourceHash: SourceHash(source), BuildTime: built}, key)
+	if serialized, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if strings.Count(serialized, STAMP_TOOL_VERSION) != 1 {
+		t.Errorf("Stamp not replaced: %v", serialized)
+	}
+	if m, err = ParseMapString(serialized); err != nil {
+		t.Fatalf("Could not parse stamped map: %v", err)
+	}
+	if s, ok, err = m.ReadStamp(key); err != nil || !ok {
+		t.Fatalf("Could not read stamp: %v, %v", ok, err)
+	}
+	if s.ToolVersion != "1.2" || !s.BuildTime.Equal(built) || !s.Signed {
+		t.Errorf("Wrong stamp: %+v", s)
+	}
+	if err = m.VerifyStamp(source, key); err != nil {
+		t.Errorf("Could not verify stamp: %v", err)
+	}
+	if err = m.VerifyStamp([]byte("changed"), key); err == nil {
+		t.Errorf("Expected error for changed source")
+	}
+	if _, _, err = m.ReadStamp([]byte("other")); err == nil {
+		t.Errorf("Expected error for wrong key")
+	}
+	for i := 0; i < len(m.Properties); i++ {
+		if m.Properties[i].Name == STAMP_VERSION {
+			m.Properties[i].Value = "2"
+		}
+	}
+	if _, _, err = m.ReadStamp(nil); err == nil {
+		t.Errorf("Expected error for later stamp version")
+	}
+	var (
+		a = map[string]string{STAMP_TOOL_VERSION: "1\n" + STAMP_SOURCE_HASH + "=x"}
+		b = map[string]string{STAMP_TOOL_VERSION: "1", STAMP_SOURCE_HASH: "x\n" + STAMP_SOURCE_HASH + "="}
+	)
+	if stampSignature(a, key) == stampSignature(b, key) {
+		t.Errorf("Values moved between stamp fields share a signature")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Colors given to the Wang colors created from terrains, in order.
+var terrainColors = []string{
+	"#ff0000", "#00ff00", "#0000ff", "#ff7700",
+	"#00e9ff", "#ff00d8", "#ffff00", "#a000ff",
+}
+
+// Rewrites the terrain types of the tileset and the terrain information
+// of its tiles into an equivalent corner Wang set named "Terrains",
+// since Tiled 1.5 and later no longer edit terrains. Each terrain type
+// becomes a Wang color, in order. The terrain types and the terrain
+// attributes of the tiles are removed. Tilesets without terrain types
+// are left unchanged.
+func ConvertTerrainsToWangSets(t *Tileset) (err error) {
+	var (
+		set = &WangSet{
+			Name: "Terrains",
+			Type: "corner",
+			Tile: -1,
+		}
+		// Positions in WangTile.WangId of the top-left, top-right,
+		// bottom-left and bottom-right corners, the order terrains use.
+		corners = [4]int{WANG_TOP_LEFT, WANG_TOP_RIGHT, WANG_BOTTOM_LEFT, WANG_BOTTOM_RIGHT}
+	)
+	if len(t.TerrainTypes) == 0 {
+		return
+	}
+	if len(t.TerrainTypes) > 254 {
+		err = fmt.Errorf("Too many terrain types: %v", len(t.TerrainTypes))
+		return
+	}
+	for i := 0; i < len(t.TerrainTypes); i++ {
+		var terrain = t.TerrainTypes[i]
+		set.Colors = append(set.Colors, &WangColor{
+			Name:        terrain.Name,
+			Color:       terrainColors[i%len(terrainColors)],
+			Tile:        terrain.Tile,
+			Probability: 1,
+			Properties:  terrain.Properties,
+		})
+	}
+	for i := 0; i < len(t.TilesetTile); i++ {
+		var (
+			tile  = &t.TilesetTile[i]
+			parts = strings.Split(tile.Terrain, ",")
+			wang  = &WangTile{TileId: tile.Id}
+			index uint64
+		)
+		if tile.Terrain == "" {
+			continue
+		}
+		if len(parts) != len(corners) {
+			err = fmt.Errorf("Invalid terrain %v for tile %v", tile.Terrain, tile.Id)
+			return
+		}
+		for j := 0; j < len(parts); j++ {
+			if parts[j] == "" {
+				continue
+			}
+			if index, err = strconv.ParseUint(parts[j], 10, 8); err != nil || index >= uint64(len(t.TerrainTypes)) {
+				err = fmt.Errorf("Invalid terrain %v for tile %v", tile.Terrain, tile.Id)
+				return
+			}
+			wang.WangId[corners[j]] = uint8(index + 1)
+		}
+		set.Tiles = append(set.Tiles, wang)
+	}
+	for i := 0; i < len(t.TilesetTile); i++ {
+		t.TilesetTile[i].Terrain = ""
+	}
+	t.TerrainTypes = nil
+	t.WangSets = append(t.WangSets, set)
+	return
+}
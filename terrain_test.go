@@ -0,0 +1,75 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"strings"
+	"testing"
+)
+
+const TEST_TERRAIN_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="ground" tilewidth="16" tileheight="16">
+  <image source="ground.png" width="64" height="16"/>
+  <terraintypes>
+   <terrain name="grass" tile="0"/>
+   <terrain name="water" tile="3">
+    <properties>
+     <property name="swim" value="true"/>
+    </properties>
+   </terrain>
+  </terraintypes>
+  <tile id="1" terrain="0,0,,1"/>
+  <tile id="2" terrain="1,1,1,1" probability="0.5"/>
+ </tileset>
+</map>
+`
+
+func TestConvertTerrainsToWangSets(t *testing.T) {
+	var (
+		m   *Map
+		out string
+		err error
+	)
+	if m, err = ParseMapString(TEST_TERRAIN_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var ts = m.Tilesets[0]
+	if len(ts.TerrainTypes) != 2 || ts.TerrainTypes[1].Name != "water" {
+		t.Fatalf("Terrain types not parsed: %v", ts.TerrainTypes)
+	}
+	if err = ConvertTerrainsToWangSets(ts); err != nil {
+		t.Fatalf("Could not convert: %v", err)
+	}
+	if len(ts.TerrainTypes) != 0 || ts.TilesetTile[0].Terrain != "" {
+		t.Errorf("Terrains not removed")
+	}
+	if len(ts.WangSets) != 1 || ts.WangSets[0].Type != "corner" || len(ts.WangSets[0].Colors) != 2 {
+		t.Fatalf("Invalid wang sets: %v", ts.WangSets)
+	}
+	if c := ts.WangSets[0].Colors[1]; c.Name != "water" || c.Tile != 3 || len(c.Properties) != 1 {
+		t.Errorf("Invalid color: %v", c)
+	}
+	if w := ts.WangSets[0].Tiles[0]; w.TileId != 1 || w.WangId != [8]uint8{0, 1, 0, 2, 0, 0, 0, 1} {
+		t.Errorf("Invalid wang tile: %v", w)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if strings.Contains(out, "terrain") || !strings.Contains(out, `wangid="0,2,0,2,0,2,0,2"`) {
+		t.Errorf("Invalid output: %v", out)
+	}
+}
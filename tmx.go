@@ -15,15 +15,18 @@
 package tmxgo
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
-	"compress/zlib"
-	"encoding/base64"
+	"context"
 	"encoding/binary"
 	"encoding/xml"
 	"fmt"
+	"image"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -33,15 +36,20 @@ import (
 // size of the map. The individual tiles may have different sizes.
 // Larger tiles will extend at the top and right (anchored to the bottom left).
 type Map struct {
-	XMLName xml.Name `xml:map`
+	XMLName xml.Name `xml:"map"`
 
 	// The TMX format version, generally 1.0.
 	Version string `xml:"version,attr"`
 
-	// Map orientation. Tiled supports "orthogonal", "isometric"
-	// and "staggered" (since 0.9.0) at the moment.
+	// Map orientation. Tiled supports "orthogonal", "isometric",
+	// "staggered" (since 0.9.0) and "hexagonal" (since 0.11) at the moment.
 	Orientation string `xml:"orientation,attr"`
 
+	// The order in which tiles on tile layers are rendered. Valid values
+	// are "right-down" (the default), "right-up", "left-down" and
+	// "left-up". (since 0.10)
+	RenderOrder string `xml:"renderorder,attr,omitempty"`
+
 	// The map width in tiles.
 	Width int32 `xml:"width,attr"`
 
@@ -54,11 +62,51 @@ type Map struct {
 	// The height of a tile.
 	TileHeight int32 `xml:"tileheight,attr"`
 
+	// Only for hexagonal maps. Determines the width or height (depending
+	// on the staggered axis) of the tile's edge, in pixels.
+	HexSideLength int32 `xml:"hexsidelength,attr,omitempty"`
+
+	// For staggered and hexagonal maps, determines which axis ("x" or "y")
+	// is staggered. (since 0.11)
+	StaggerAxis string `xml:"staggeraxis,attr,omitempty"`
+
+	// For staggered and hexagonal maps, determines whether the "even" or
+	// "odd" indexes along the staggered axis are shifted. (since 0.11)
+	StaggerIndex string `xml:"staggerindex,attr,omitempty"`
+
 	// The background color of the map. (since 0.9.0).
 	BackgroundColor string `xml:"backgroundcolor,attr,omitempty"`
 
+	// The camera position, in pixels, at which layers appear at their
+	// regular position whatever their parallax factors. Defaults to 0.
+	// (since 1.8)
+	ParallaxOriginX float32 `xml:"parallaxoriginx,attr,omitempty"`
+	ParallaxOriginY float32 `xml:"parallaxoriginy,attr,omitempty"`
+
+	// Stores the next available id for new layers, so that ids of
+	// removed layers are not reused. (since 1.2)
+	NextLayerId int32 `xml:"nextlayerid,attr,omitempty"`
+
+	// Stores the next available id for new objects, so that ids of
+	// removed objects are not reused. (since 0.11)
+	NextObjectId int32 `xml:"nextobjectid,attr,omitempty"`
+
+	// Whether this map is infinite. An infinite map has no fixed size
+	// and can grow in all directions. Its layer data is stored in
+	// chunks. (since 1.2)
+	RawInfinite string `xml:"infinite,attr,omitempty"`
+	Infinite    bool   `xml:"-"`
+
+	// The compression level to use for compressed tile layer data, from
+	// 0 to 9 for zlib and gzip. Nil, like -1, means the codec's default.
+	// (since 1.3)
+	CompressionLevel *int32 `xml:"compressionlevel,attr"`
+
+	// Can contain editorsettings (since 1.3).
+	EditorSettings *EditorSettings `xml:"editorsettings"`
+
 	// Can contain properties.
-	Properties []*Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain tileset.
 	Tilesets []*Tileset `xml:"tileset"`
@@ -71,8 +119,80 @@ type Map struct {
 
 	// Can contain imagelayer.
 	ImageLayers []*ImageLayer `xml:"imagelayer"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+
+	// The directory the map was read from, used to resolve relative
+	// file references. Empty for maps parsed from strings.
+	BaseDir string `xml:"-"`
+
+	// The loader the map was read through, if any.
+	Loader *Loader `xml:"-"`
+
+	// The custom property types of the map, if known. Enum properties
+	// are checked against them on Serialize.
+	Project *Project `xml:"-"`
+
+	// The origin of the coordinates returned for tiles and objects.
+	// Defaults to ORIGIN_BOTTOM_LEFT.
+	Origin Origin `xml:"-"`
+
+	// Overrides the geometry of the map. If nil, the orientation
+	// registered under the name in Orientation is used, falling back to
+	// orthogonal for unknown names.
+	Layout Orientation `xml:"-"`
+
+	// The SHA-256 of the file the map was read from, if read by a
+	// Loader with DecodeCache set, and the data of its layers as read.
+	contentHash []byte
+	contentData []*Data
+
+	// Built by TilesetTileForGid.
+	tileIndex *tileIndex
+}
+
+// This element contains various editor-specific settings, which are
+// generally not relevant when reading a map.
+type EditorSettings struct {
+	// Can contain chunksize.
+	ChunkSize *ChunkSize `xml:"chunksize"`
+
+	// Can contain export.
+	Export *Export `xml:"export"`
+}
+
+// The chunk size used when saving infinite maps.
+type ChunkSize struct {
+	// The width of chunks used for infinite maps (default to 16).
+	Width int32 `xml:"width,attr,omitempty"`
+
+	// The height of chunks used for infinite maps (default to 16).
+	Height int32 `xml:"height,attr,omitempty"`
 }
 
+// The last file this map was exported to.
+type Export struct {
+	// The last file this map was exported to.
+	Target string `xml:"target,attr,omitempty"`
+
+	// The short name of the last format this map was exported as.
+	Format string `xml:"format,attr,omitempty"`
+}
+
+// The corner of the map or tileset image that coordinates are relative to.
+type Origin int
+
+const (
+	// X grows to the right and Y grows up, as in OpenGL.
+	ORIGIN_BOTTOM_LEFT Origin = iota
+
+	// X grows to the right and Y grows down, as in TMX files and most
+	// 2D libraries.
+	ORIGIN_TOP_LEFT
+)
+
 func (m *Map) LayerByName(name string) (l *Layer, err error) {
 	for i := 0; i < len(m.Layers); i++ {
 		if m.Layers[i].Name == name {
@@ -84,8 +204,19 @@ func (m *Map) LayerByName(name string) (l *Layer, err error) {
 	return
 }
 
+func (m *Map) TilesetByName(name string) (t *Tileset, err error) {
+	for i := 0; i < len(m.Tilesets); i++ {
+		if m.Tilesets[i].Name == name {
+			t = m.Tilesets[i]
+			return
+		}
+	}
+	err = fmt.Errorf("No tileset with name %v", name)
+	return
+}
+
 func (m *Map) LayerByIndex(index int32) (l *Layer, err error) {
-	if index < 0 || index > int32(len(m.Layers)) {
+	if index < 0 || index >= int32(len(m.Layers)) {
 		err = fmt.Errorf("Index %v out of bounds", index)
 		return
 	}
@@ -93,12 +224,120 @@ func (m *Map) LayerByIndex(index int32) (l *Layer, err error) {
 	return
 }
 
+func (m *Map) ObjectGroupByName(name string) (g *ObjectGroup, err error) {
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		if m.ObjectGroups[i].Name == name {
+			g = m.ObjectGroups[i]
+			return
+		}
+	}
+	err = fmt.Errorf("No object group with name %v", name)
+	return
+}
+
+func (m *Map) ObjectGroupByIndex(index int32) (g *ObjectGroup, err error) {
+	if index < 0 || index >= int32(len(m.ObjectGroups)) {
+		err = fmt.Errorf("Index %v out of bounds", index)
+		return
+	}
+	g = m.ObjectGroups[index]
+	return
+}
+
+func (m *Map) ImageLayerByName(name string) (l *ImageLayer, err error) {
+	for i := 0; i < len(m.ImageLayers); i++ {
+		if m.ImageLayers[i].Name == name {
+			l = m.ImageLayers[i]
+			return
+		}
+	}
+	err = fmt.Errorf("No image layer with name %v", name)
+	return
+}
+
+func (m *Map) ImageLayerByIndex(index int32) (l *ImageLayer, err error) {
+	if index < 0 || index >= int32(len(m.ImageLayers)) {
+		err = fmt.Errorf("Index %v out of bounds", index)
+		return
+	}
+	l = m.ImageLayers[index]
+	return
+}
+
+// A layer of any kind: a *Layer, *ObjectGroup or *ImageLayer.
+type AnyLayer interface {
+	layerName() string
+	layerParallax() (offsetX, offsetY, parallaxX, parallaxY float32)
+}
+
+func (l *Layer) layerName() string       { return l.Name }
+func (g *ObjectGroup) layerName() string { return g.Name }
+func (l *ImageLayer) layerName() string  { return l.Name }
+
+func (l *Layer) layerParallax() (offsetX, offsetY, parallaxX, parallaxY float32) {
+	return l.OffsetX, l.OffsetY, l.ParallaxX, l.ParallaxY
+}
+
+func (g *ObjectGroup) layerParallax() (offsetX, offsetY, parallaxX, parallaxY float32) {
+	return g.OffsetX, g.OffsetY, g.ParallaxX, g.ParallaxY
+}
+
+func (l *ImageLayer) layerParallax() (offsetX, offsetY, parallaxX, parallaxY float32) {
+	return l.OffsetX, l.OffsetY, l.ParallaxX, l.ParallaxY
+}
+
+// Returns the offset in pixels to draw layer l at when the camera is at
+// cameraX, cameraY on the map, which Tiled takes to be the center of the
+// view. This is the layer's offset plus the part of the camera movement
+// away from the map's parallax origin that the layer's parallax factors
+// hold it back by: a layer with a factor of 1 scrolls with the map, one
+// with a factor of 0 stays fixed in the view.
+func (m *Map) ParallaxOffset(l AnyLayer, cameraX, cameraY float32) (x, y float32) {
+	var offsetX, offsetY, parallaxX, parallaxY = l.layerParallax()
+	x = offsetX + (cameraX-m.ParallaxOriginX)*(1-parallaxX)
+	y = offsetY + (cameraY-m.ParallaxOriginY)*(1-parallaxY)
+	return
+}
+
+// Returns the tile layer, object group or image layer with the given
+// name, searched in that order.
+func (m *Map) AnyLayerByName(name string) (l AnyLayer, err error) {
+	var candidates []AnyLayer
+	for i := 0; i < len(m.Layers); i++ {
+		candidates = append(candidates, m.Layers[i])
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		candidates = append(candidates, m.ObjectGroups[i])
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		candidates = append(candidates, m.ImageLayers[i])
+	}
+	for i := 0; i < len(candidates); i++ {
+		if candidates[i].layerName() == name {
+			l = candidates[i]
+			return
+		}
+	}
+	err = fmt.Errorf("No layer with name %v", name)
+	return
+}
+
 func (m *Map) TilesFromLayerName(name string) (t []*Tile, err error) {
 	var layer *Layer
 	if layer, err = m.LayerByName(name); err != nil {
 		return
 	}
-	return m.tilesFromLayer(layer)
+	return m.tilesFromLayer(context.Background(), layer)
+}
+
+// Like TilesFromLayerName, but stops decoding the layer data and returns
+// ctx.Err() once ctx is done.
+func (m *Map) TilesFromLayerNameContext(ctx context.Context, name string) (t []*Tile, err error) {
+	var layer *Layer
+	if layer, err = m.LayerByName(name); err != nil {
+		return
+	}
+	return m.tilesFromLayer(ctx, layer)
 }
 
 func (m *Map) TilesFromLayerIndex(index int32) (t []*Tile, err error) {
@@ -106,35 +345,52 @@ func (m *Map) TilesFromLayerIndex(index int32) (t []*Tile, err error) {
 	if layer, err = m.LayerByIndex(index); err != nil {
 		return
 	}
-	return m.tilesFromLayer(layer)
+	return m.tilesFromLayer(context.Background(), layer)
 }
 
-func (m *Map) tilesFromLayer(layer *Layer) (t []*Tile, err error) {
+func (m *Map) tilesFromLayer(ctx context.Context, layer *Layer) (t []*Tile, err error) {
 	var (
-		datatiles []DataTile
-		j         int
+		gids   []uint32
+		j      int
+		width  = layer.Width
+		origin image.Point
 	)
-	if datatiles, err = layer.Data.Tiles(); err != nil {
+	if layer.Data.chunked() {
+		// Tiles of infinite maps cover the chunk bounds, which may lie
+		// anywhere relative to the map's origin.
+		var grid DataTileGrid
+		if grid, err = layer.Data.chunkGrid(ctx); err != nil {
+			err = m.layerError(layer, err)
+			return
+		}
+		width, origin = int32(grid.Width), layer.Data.ChunkBounds().Min
+		gids = make([]uint32, grid.Width*grid.Height)
+		for y := 0; y < grid.Height; y++ {
+			for x := 0; x < grid.Width; x++ {
+				gids[grid.Width*y+x] = uint32(grid.Tiles[x][y].GID())
+			}
+		}
+	} else if gids, err = layer.Data.GidsContext(ctx); err != nil {
+		err = m.layerError(layer, err)
 		return
 	}
 	sort.Sort(byFirstGid(m.Tilesets)) // Should be sorted but just in case.
-	t = make([]*Tile, len(datatiles))
+	t = make([]*Tile, len(gids))
 	j = 0
-	for i := 0; i < len(datatiles); i++ {
+	for i := 0; i < len(gids); i++ {
 		var (
-			tilebounds = Bounds{
-				Y: float32(m.TileHeight) * float32(layer.Height-1-(int32(i)/layer.Width)),
-				X: float32(m.TileWidth) * float32((int32(i) % layer.Width)),
-				W: float32(m.TileWidth),
-				H: float32(m.TileHeight),
-			}
-			gid = datatiles[i].Gid
+			tilebounds = m.CellBounds(int32(origin.X)+int32(i)%width, int32(origin.Y)+int32(i)/width)
+			gid        = gids[i]
 		)
 
 		if gid == 0 {
 			t[j] = nil
-		} else if t[j], err = newTile(gid, m.Tilesets, tilebounds); err != nil {
+		} else if t[j], err = newTile(gid, m.Tilesets, tilebounds, m.Origin); err != nil {
+			err = m.layerError(layer, err)
 			return
+		} else if m.Orientation == "isometric" {
+			// Isometric tiles are centered on their cell.
+			t[j].TileBounds.X = tilebounds.X + (tilebounds.W-t[j].TileBounds.W)/2
 		}
 		j++
 	}
@@ -142,20 +398,64 @@ func (m *Map) tilesFromLayer(layer *Layer) (t []*Tile, err error) {
 }
 
 func (m *Map) afterDeserialize() (err error) {
+	if strings.TrimSpace(m.RawInfinite) != "" {
+		var i int64
+		if i, err = strconv.ParseInt(m.RawInfinite, 10, 32); err != nil {
+			return
+		}
+		m.Infinite = i > 0
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		if err = m.Tilesets[i].afterDeserialize(); err != nil {
+			return m.tilesetError(m.Tilesets[i], err)
+		}
+	}
 	for i := 0; i < len(m.Layers); i++ {
 		if err = m.Layers[i].afterDeserialize(); err != nil {
-			return
+			return m.layerError(m.Layers[i], err)
+		}
+		m.Layers[i].Data.infinite = m.Infinite
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		if err = m.ObjectGroups[i].afterDeserialize(); err != nil {
+			return fmt.Errorf("Object group %v: %v", m.ObjectGroups[i].Name, err)
+		}
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		if err = m.ImageLayers[i].afterDeserialize(); err != nil {
+			return fmt.Errorf("Image layer %v: %v", m.ImageLayers[i].Name, err)
 		}
 	}
 	return
 }
 
 func (m *Map) beforeSerialize() (err error) {
+	for i := 0; i < len(m.Tilesets); i++ {
+		if err = m.Tilesets[i].beforeSerialize(); err != nil {
+			return m.tilesetError(m.Tilesets[i], err)
+		}
+	}
+	if m.Infinite {
+		m.RawInfinite = "1"
+	} else {
+		m.RawInfinite = "" // Defaults to 0, so omit from output.
+	}
+	if err = m.chunkLayers(); err != nil {
+		return
+	}
+	m.assignLayerIds()
 	for i := 0; i < len(m.Layers); i++ {
+		m.Layers[i].Data.level = m.CompressionLevel
 		if err = m.Layers[i].beforeSerialize(); err != nil {
-			return
+			return m.layerError(m.Layers[i], err)
 		}
 	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		m.ObjectGroups[i].beforeSerialize()
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		m.ImageLayers[i].beforeSerialize()
+	}
 	return
 }
 
@@ -175,32 +475,160 @@ type Tile struct {
 	FlipDiag      bool
 	TileBounds    Bounds
 	TextureBounds Bounds
+	Origin        Origin
 }
 
 func (t *Tile) ScaledBounds(ratio float32) (x, y, w, h float32) {
 	return t.TileBounds.GetScaled(ratio, ratio)
 }
 
+// Returns the pixel rectangle of the tile within its tileset image,
+// with the origin at the top left of the image as used by image/draw.
+// Unlike TextureBounds, the tileset's margin and spacing are honored.
+func (t *Tile) SourceRect() image.Rectangle {
+	if t.Tileset == nil {
+		return image.Rectangle{}
+	}
+	return t.Tileset.tileRect(t.Index)
+}
+
 func (t *Tile) ScaledTextureBounds(texw, texh float32) (x, y, w, h float32) {
 	return t.TextureBounds.GetScaled(texw, texh)
 }
 
+// Returns the texture coordinates of the corners of the tile as drawn,
+// in the order top-left, top-right, bottom-right, bottom-left, with the
+// tile's flips applied. Coordinates are in pixels of the tileset image
+// relative to the tile's Origin, like TextureBounds, or in the range
+// 0 to 1 if normalized is set.
+//
+// Tiled applies the diagonal flip (a swap of the x and y axes) before the
+// horizontal and vertical flips, so a diagonally flipped tile appears
+// rotated 90 degrees and mirrored.
+func (t *Tile) UV(normalized bool) (uv [4]Point) {
+	var (
+		b      = t.TextureBounds
+		sx, sy = float32(1), float32(1)
+		// Corners as (right, bottom) pairs, in drawing order.
+		corners = [4][2]bool{{false, false}, {true, false}, {true, true}, {false, true}}
+	)
+	if normalized && t.Tileset != nil {
+		if img := t.Tileset.imageFor(t.Index); img != nil && img.Width > 0 && img.Height > 0 {
+			sx, sy = float32(img.Width), float32(img.Height)
+		}
+	}
+	for i := 0; i < len(corners); i++ {
+		var right, bottom = corners[i][0], corners[i][1]
+		if t.FlipVert {
+			bottom = !bottom
+		}
+		if t.FlipHorz {
+			right = !right
+		}
+		if t.FlipDiag {
+			right, bottom = bottom, right
+		}
+		uv[i] = Point{X: b.X, Y: b.Y}
+		if right {
+			uv[i].X += b.W
+		}
+		if bottom == (t.Origin == ORIGIN_TOP_LEFT) {
+			uv[i].Y += b.H
+		}
+		uv[i].X /= sx
+		uv[i].Y /= sy
+	}
+	return
+}
+
+// A 3x3 affine transformation matrix, indexed by row and column, which
+// maps the point x, y to the first two rows of M * (x, y, 1).
+type Matrix [3][3]float32
+
+// Returns the point p transformed by the matrix.
+func (m Matrix) Apply(p Point) Point {
+	return Point{
+		X: m[0][0]*p.X + m[0][1]*p.Y + m[0][2],
+		Y: m[1][0]*p.X + m[1][1]*p.Y + m[1][2],
+	}
+}
+
+// Returns the matrix placing the tile's image on the map. It maps points
+// of the image, given in the range 0 to 1 with the origin at the top left
+// of the image, onto TileBounds, with the tile's flips applied. Like
+// TileBounds, the result is relative to the tile's Origin.
+//
+// Renderers drawing a unit quad textured with the tile can use the matrix
+// as is, without deriving the rotation implied by the diagonal flip.
+func (t *Tile) Transform() (m Matrix) {
+	var (
+		b    = t.TileBounds
+		dest = func(u, v float32) Point {
+			// Tiled applies the diagonal flip before the others.
+			if t.FlipDiag {
+				u, v = v, u
+			}
+			if t.FlipHorz {
+				u = 1 - u
+			}
+			if t.FlipVert {
+				v = 1 - v
+			}
+			if t.Origin == ORIGIN_BOTTOM_LEFT {
+				v = 1 - v
+			}
+			return Point{b.X + u*b.W, b.Y + v*b.H}
+		}
+		o = dest(0, 0)
+		x = dest(1, 0)
+		y = dest(0, 1)
+	)
+	return Matrix{
+		{x.X - o.X, y.X - o.X, o.X},
+		{x.Y - o.Y, y.Y - o.Y, o.Y},
+		{0, 0, 1},
+	}
+}
+
 const (
 	FLIPPED_H_FLAG uint32 = 0x80000000
 	FLIPPED_V_FLAG uint32 = 0x40000000
 	FLIPPED_D_FLAG uint32 = 0x20000000
-	CLEAR_FLIP     uint32 = (FLIPPED_H_FLAG | FLIPPED_V_FLAG | FLIPPED_D_FLAG)
+
+	// Set on tiles of hexagonal maps rotated by 120 degrees. (since 1.10)
+	ROTATED_HEX_120_FLAG uint32 = 0x10000000
+
+	CLEAR_FLIP uint32 = (FLIPPED_H_FLAG | FLIPPED_V_FLAG | FLIPPED_D_FLAG | ROTATED_HEX_120_FLAG)
 )
 
-func parseGid(gid uint32) (id uint32, fliph, flipv, flipd bool) {
+// A global tile id as stored in layer data and tile objects, with the
+// flip flags in its highest bits.
+type GID uint32
+
+// Returns the global tile id without flip flags.
+func (g GID) TileID() uint32 {
+	return uint32(g) &^ CLEAR_FLIP
+}
+
+// Returns whether the tile is flipped horizontally, vertically and
+// diagonally, and whether it is rotated by 120 degrees on hexagonal maps.
+func (g GID) Flips() (fliph, flipv, flipd, rothex bool) {
+	_, fliph, flipv, flipd, rothex = ParseGID(uint32(g))
+	return
+}
+
+// Splits a gid into the global tile id and its flip flags.
+func ParseGID(gid uint32) (id uint32, fliph, flipv, flipd, rothex bool) {
 	fliph = (gid & FLIPPED_H_FLAG) > 0
 	flipv = (gid & FLIPPED_V_FLAG) > 0
 	flipd = (gid & FLIPPED_D_FLAG) > 0
-	id = gid & ^CLEAR_FLIP
+	rothex = (gid & ROTATED_HEX_120_FLAG) > 0
+	id = gid &^ CLEAR_FLIP
 	return
 }
 
-func encodeGid(id uint32, fliph, flipv, flipd bool) (gid uint32) {
+// Combines a global tile id and flip flags into a gid.
+func EncodeGID(id uint32, fliph, flipv, flipd, rothex bool) (gid uint32) {
 	gid = id
 	if fliph {
 		gid |= FLIPPED_H_FLAG
@@ -211,11 +639,20 @@ func encodeGid(id uint32, fliph, flipv, flipd bool) (gid uint32) {
 	if flipd {
 		gid |= FLIPPED_D_FLAG
 	}
+	if rothex {
+		gid |= ROTATED_HEX_120_FLAG
+	}
+	return
+}
+
+func gridTile(gid uint32) (t DataTileGridTile) {
+	t.Id, t.FlipX, t.FlipY, t.FlipD, t.RotateHex = ParseGID(gid)
 	return
 }
 
-// The tilesets argument must first be sorted by firstgid.
-func newTile(gid uint32, tilesets []*Tileset, tilebounds Bounds) (t *Tile, err error) {
+// The tilesets argument must first be sorted by firstgid. The tilebounds
+// argument gives the grid cell of the tile, relative to origin.
+func newTile(gid uint32, tilesets []*Tileset, tilebounds Bounds, origin Origin) (t *Tile, err error) {
 	var (
 		tileset *Tileset
 		count   = len(tilesets)
@@ -228,17 +665,21 @@ func newTile(gid uint32, tilesets []*Tileset, tilebounds Bounds) (t *Tile, err e
 		err = fmt.Errorf("No tilesets")
 		return
 	}
-	gid, fliph, flipv, flipd = parseGid(gid)
-	for i := 1; i < count; i++ {
-		if gid < tilesets[i].FirstGid {
-			tileset = tilesets[i-1]
-			break
+	gid, fliph, flipv, flipd, _ = ParseGID(gid)
+	tileset = tilesetForGid(tilesets, gid)
+	index = gid - tileset.FirstGid
+	// Tiles larger than the grid stay anchored to the bottom left
+	// of their cell and extend to the top and right.
+	if w, h, padX, padY := tileset.renderSize(index, tilebounds.W, tilebounds.H); w > 0 && h > 0 {
+		if origin == ORIGIN_TOP_LEFT {
+			tilebounds.Y += tilebounds.H - h - padY
+		} else {
+			tilebounds.Y += padY
 		}
+		tilebounds.X += padX
+		tilebounds.W = w
+		tilebounds.H = h
 	}
-	if tileset == nil {
-		tileset = tilesets[count-1]
-	}
-	index = gid - tileset.FirstGid
 	t = &Tile{
 		Index:         index,
 		Tileset:       tileset,
@@ -246,11 +687,53 @@ func newTile(gid uint32, tilesets []*Tileset, tilebounds Bounds) (t *Tile, err e
 		FlipHorz:      fliph,
 		FlipDiag:      flipd,
 		TileBounds:    tilebounds,
-		TextureBounds: tileset.TextureBounds(index),
+		TextureBounds: tileset.TextureBoundsFrom(index, origin),
+		Origin:        origin,
+	}
+	return
+}
+
+// Returns the tileset the tile with the given gid belongs to. Flip
+// flags in gid are ignored.
+func (m *Map) TilesetForGid(gid uint32) (t *Tileset, err error) {
+	var sorted = append([]*Tileset{}, m.Tilesets...)
+	gid &^= CLEAR_FLIP
+	if gid == 0 {
+		err = fmt.Errorf("Gid 0 denotes an empty tile")
+		return
+	}
+	if len(sorted) == 0 {
+		err = fmt.Errorf("No tilesets")
+		return
+	}
+	sort.Sort(byFirstGid(sorted))
+	if t = tilesetForGid(sorted, gid); !t.ContainsGid(gid) {
+		t = nil
+		err = fmt.Errorf("No tileset contains gid %v", gid)
 	}
 	return
 }
 
+// Returns whether the tile with the given gid belongs to the tileset.
+// Flip flags in gid are ignored. If the number of tiles in the tileset
+// is not known, all gids from its first gid on are considered part of it.
+func (t *Tileset) ContainsGid(gid uint32) bool {
+	var count = t.numTiles()
+	gid &^= CLEAR_FLIP
+	return gid >= t.FirstGid && (count == 0 || gid < t.FirstGid+count)
+}
+
+// Returns the tileset of tilesets, which must be sorted by first gid,
+// the given gid would belong to.
+func tilesetForGid(tilesets []*Tileset, gid uint32) *Tileset {
+	for i := 1; i < len(tilesets); i++ {
+		if gid < tilesets[i].FirstGid {
+			return tilesets[i-1]
+		}
+	}
+	return tilesets[len(tilesets)-1]
+}
+
 func GetTexturePath(tiles []*Tile) (path string, err error) {
 	for i := 0; i < len(tiles); i++ {
 		if tiles[i] == nil {
@@ -306,54 +789,301 @@ type Tileset struct {
 	// (applies to the tileset image).
 	Margin int32 `xml:"margin,attr,omitempty"`
 
+	// The number of tiles in this tileset (since 0.13).
+	TileCount int32 `xml:"tilecount,attr,omitempty"`
+
+	// The number of tile columns in the tileset. For image collection
+	// tilesets it is editable and is used when displaying the tileset.
+	// (since 0.15)
+	Columns int32 `xml:"columns,attr,omitempty"`
+
+	// Controls the alignment for tile objects. Valid values are
+	// "unspecified", "topleft", "top", "topright", "left", "center",
+	// "right", "bottomleft", "bottom" and "bottomright". The default value
+	// is "unspecified", for compatibility reasons. When unspecified, tile
+	// objects use "bottomleft" in orthogonal mode and "bottom" in
+	// isometric mode. (since 1.4)
+	ObjectAlignment string `xml:"objectalignment,attr,omitempty"`
+
+	// The size to use when rendering tiles from this tileset on a tile
+	// layer. Valid values are "tile" (the size of the tile) and "grid"
+	// (the tile grid size of the map). Defaults to "tile". (since 1.9)
+	TileRenderSize string `xml:"tilerendersize,attr,omitempty"`
+
+	// The fill mode to use when rendering tiles from this tileset at a
+	// size other than their own. Valid values are "stretch" and
+	// "preserve-aspect-fit". Defaults to "stretch". Only relevant when
+	// tilerendersize is "grid". (since 1.9)
+	FillMode string `xml:"fillmode,attr,omitempty"`
+
 	// Can contain tileoffset (since 0.8.0).
 	TileOffset *TileOffset `xml:"tileoffset"`
 
 	// Can contain properties (since 0.8.0).
-	Properties []Property `xml:"properties,omitempty>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain image.
 	Image *Image `xml:"image"`
 
 	// Can contain terraintypes (since 0.9.0).
-	TerrainTypes []Terrain `xml:"terraintypes,omitempty>terrain"`
+	RawTerrainTypes *TerrainList `xml:"terraintypes"`
+	TerrainTypes    []Terrain    `xml:"-"`
 
 	// Can contain tile.
 	TilesetTile []TilesetTile `xml:"tile,omitempty"`
+
+	// Can contain wangsets (since 1.1).
+	RawWangSets *WangSetList `xml:"wangsets"`
+	WangSets    []*WangSet   `xml:"-"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+}
+
+// Wraps the wang sets of a tileset so the wangsets element can be
+// omitted entirely when there are none.
+type WangSetList struct {
+	WangSets []*WangSet `xml:"wangset"`
+}
+
+func (t *Tileset) afterDeserialize() (err error) {
+	if t.RawTerrainTypes != nil {
+		t.TerrainTypes = t.RawTerrainTypes.Terrains
+	}
+	if t.RawWangSets != nil {
+		t.WangSets = t.RawWangSets.WangSets
+	}
+	for i := 0; i < len(t.WangSets); i++ {
+		if err = t.WangSets[i].afterDeserialize(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (t *Tileset) beforeSerialize() (err error) {
+	for i := 0; i < len(t.WangSets); i++ {
+		t.WangSets[i].beforeSerialize()
+	}
+	if len(t.WangSets) > 0 {
+		t.RawWangSets = &WangSetList{WangSets: t.WangSets}
+	} else {
+		t.RawWangSets = nil
+	}
+	if len(t.TerrainTypes) > 0 {
+		t.RawTerrainTypes = &TerrainList{Terrains: t.TerrainTypes}
+	} else {
+		t.RawTerrainTypes = nil
+	}
+	return
+}
+
+// Returns the number of tiles in the tileset, computed from the
+// tileset image or from the tile elements of image collections.
+func (t *Tileset) numTiles() (count uint32) {
+	if t.TileCount > 0 {
+		return uint32(t.TileCount)
+	}
+	if t.Image != nil {
+		var (
+			cols    = t.columns()
+			_, rows = t.gridSize(t.Image.Width, t.Image.Height)
+		)
+		if cols > 0 && rows > 0 {
+			return uint32(cols * rows)
+		}
+		return 0
+	}
+	for i := 0; i < len(t.TilesetTile); i++ {
+		if t.TilesetTile[i].Id >= count {
+			count = t.TilesetTile[i].Id + 1
+		}
+	}
+	return
+}
+
+// Returns the number of tile columns in the tileset image.
+func (t *Tileset) columns() int32 {
+	if t.Columns > 0 {
+		return t.Columns
+	}
+	if t.Image == nil {
+		return 0
+	}
+	var cols, _ = t.gridSize(t.Image.Width, t.Image.Height)
+	return cols
+}
+
+// Returns how many whole tiles of the tileset fit across and down an
+// image of imgW x imgH pixels.
+func (t *Tileset) gridSize(imgW, imgH int32) (cols, rows int32) {
+	if t.TileWidth <= 0 || t.TileHeight <= 0 || t.Spacing < 0 {
+		return
+	}
+	cols = (imgW - 2*t.Margin + t.Spacing) / (t.TileWidth + t.Spacing)
+	rows = (imgH - 2*t.Margin + t.Spacing) / (t.TileHeight + t.Spacing)
+	if cols < 0 || rows < 0 {
+		return 0, 0
+	}
+	return
+}
+
+// Returns the pixel rectangle of the tile at index within the tileset
+// image, with the origin at the top left of the image.
+func (t *Tileset) tileRect(index uint32) image.Rectangle {
+	var cols = t.columns()
+	if cols <= 0 {
+		return image.Rectangle{}
+	}
+	var (
+		x = t.Margin + (int32(index)%cols)*(t.TileWidth+t.Spacing)
+		y = t.Margin + (int32(index)/cols)*(t.TileHeight+t.Spacing)
+	)
+	return image.Rect(int(x), int(y), int(x+t.TileWidth), int(y+t.TileHeight))
+}
+
+// Returns the index of the tile covering the pixel px, py of the tileset
+// image, with the origin at the top left of the image as used by
+// image/draw. Returns false if the pixel lies outside the image, in the
+// margin or spacing between tiles, or past the last tile.
+func (t *Tileset) TileIndexAt(px, py int32) (index uint32, ok bool) {
+	var cols = t.columns()
+	if cols <= 0 || t.Image == nil || px < t.Margin || py < t.Margin ||
+		px >= t.Image.Width || py >= t.Image.Height {
+		return
+	}
+	var (
+		col = (px - t.Margin) / (t.TileWidth + t.Spacing)
+		row = (py - t.Margin) / (t.TileHeight + t.Spacing)
+	)
+	if col >= cols || (px-t.Margin)%(t.TileWidth+t.Spacing) >= t.TileWidth ||
+		(py-t.Margin)%(t.TileHeight+t.Spacing) >= t.TileHeight {
+		return
+	}
+	index = uint32(row*cols + col)
+	if count := t.numTiles(); count > 0 && index >= count {
+		return 0, false
+	}
+	return index, true
 }
 
+// Returns the bounds of the tile at index within the tileset image,
+// with the origin at the bottom left of the image.
 func (t *Tileset) TextureBounds(index uint32) Bounds {
+	return t.TextureBoundsFrom(index, ORIGIN_BOTTOM_LEFT)
+}
+
+// Returns the bounds of the tile at index within the tileset image,
+// relative to origin.
+// Tiles of image collection tilesets cover their whole image.
+func (t *Tileset) TextureBoundsFrom(index uint32, origin Origin) Bounds {
 	if t.Image == nil {
+		if img := t.imageFor(index); img != nil {
+			return Bounds{0, 0, float32(img.Width), float32(img.Height)}
+		}
 		return Bounds{0, 0, 0, 0}
 	}
 	var (
 		tileswide = t.Image.Width / t.TileWidth
 		tileshigh = t.Image.Height / t.TileHeight
+		row       = int32(index) / tileswide
 	)
+	if origin == ORIGIN_BOTTOM_LEFT {
+		row = tileshigh - 1 - row
+	}
 	return Bounds{
-		Y: float32((tileshigh - 1 - int32(index)/tileswide) * t.TileHeight),
-		X: float32((int32(index) % tileshigh) * t.TileWidth),
+		Y: float32(row * t.TileHeight),
+		X: float32((int32(index) % tileswide) * t.TileWidth),
 		W: float32(t.TileWidth),
 		H: float32(t.TileHeight),
 	}
 }
 
-// This element is used to specify an offset in pixels,
-// to be applied when drawing a tile from the related tileset.
-// When not present, no offset is applied.
-type TileOffset struct {
-	// Horizontal offset in pixels.
-	X int32 `xml:"x,attr"`
-
-	// Vertical offset in pixels (positive is down).
-	Y int32 `xml:"y,attr"`
+// Returns the image the tile at index is taken from, which is the
+// tileset image or, for image collection tilesets, the tile's own image.
+func (t *Tileset) imageFor(index uint32) *Image {
+	if t.Image != nil {
+		return t.Image
+	}
+	if tile := t.TileById(index); tile != nil {
+		return tile.Image
+	}
+	return nil
 }
 
-// As of the current version of Tiled Qt, each tileset hass a single image
-// associated with it, which is cut into smaller tiles based on the
-// attributes defined on the tileset element. Later versions may
-// add support for adding multiple images to a single tileset,
-// as is possible in Tiled Java.
+// Returns the size the tile at index is drawn at in a map cell of
+// cellW x cellH pixels, following the tileset's tilerendersize and
+// fillmode, along with the horizontal and vertical padding centering it
+// in the cell when its aspect ratio is preserved.
+func (t *Tileset) renderSize(index uint32, cellW, cellH float32) (w, h, padX, padY float32) {
+	w, h = float32(t.TileWidth), float32(t.TileHeight)
+	if t.Image == nil {
+		if img := t.imageFor(index); img != nil && img.Width > 0 && img.Height > 0 {
+			w, h = float32(img.Width), float32(img.Height)
+		}
+	}
+	if t.TileRenderSize != "grid" || w <= 0 || h <= 0 || cellW <= 0 || cellH <= 0 {
+		return
+	}
+	if t.FillMode != "preserve-aspect-fit" {
+		return cellW, cellH, 0, 0
+	}
+	var scale = cellW / w
+	if cellH/h < scale {
+		scale = cellH / h
+	}
+	w, h = w*scale, h*scale
+	return w, h, (cellW - w) / 2, (cellH - h) / 2
+}
+
+// Creates a tileset cutting an image of imgW x imgH pixels into tiles of
+// tileW x tileH pixels, with spacing pixels between tiles and margin pixels
+// around them, and fills in the resulting tile count and columns.
+// The tileset starts at gid 1, the image source must be set by the caller.
+func NewTilesetFromImage(name string, imgW, imgH, tileW, tileH, spacing, margin int32) (t *Tileset, err error) {
+	if tileW <= 0 || tileH <= 0 || spacing < 0 || margin < 0 {
+		err = fmt.Errorf("Invalid tile size %vx%v, spacing %v or margin %v",
+			tileW, tileH, spacing, margin)
+		return
+	}
+	t = &Tileset{
+		FirstGid:   1,
+		Name:       name,
+		TileWidth:  tileW,
+		TileHeight: tileH,
+		Spacing:    spacing,
+		Margin:     margin,
+		Image: &Image{
+			Width:  imgW,
+			Height: imgH,
+		},
+	}
+	t.Columns = t.columns()
+	t.TileCount = int32(t.numTiles())
+	if t.Columns <= 0 || t.TileCount <= 0 {
+		err = fmt.Errorf("Image of %vx%v holds no %vx%v tiles", imgW, imgH, tileW, tileH)
+		return
+	}
+	return
+}
+
+// This element is used to specify an offset in pixels,
+// to be applied when drawing a tile from the related tileset.
+// When not present, no offset is applied.
+type TileOffset struct {
+	// Horizontal offset in pixels.
+	X int32 `xml:"x,attr"`
+
+	// Vertical offset in pixels (positive is down).
+	Y int32 `xml:"y,attr"`
+}
+
+// As of the current version of Tiled Qt, each tileset hass a single image
+// associated with it, which is cut into smaller tiles based on the
+// attributes defined on the tileset element. Later versions may
+// add support for adding multiple images to a single tileset,
+// as is possible in Tiled Java.
 type Image struct {
 	// Used for embedded images, in combination with a data child element.
 	// (since 0.9.0)
@@ -382,6 +1112,10 @@ type Image struct {
 	Data *Data `xml:"data"`
 }
 
+type TerrainList struct {
+	Terrains []Terrain `xml:"terrain"`
+}
+
 type Terrain struct {
 	// The name of the terrain type.
 	Name string `xml:"name,attr"`
@@ -390,7 +1124,147 @@ type Terrain struct {
 	Tile int32 `xml:"tile,attr"`
 
 	// Can contain properties.
-	Properties []Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
+}
+
+// Defines a list of colors and any number of Wang tiles using these colors.
+type WangSet struct {
+	// The name of the Wang set.
+	Name string `xml:"name,attr"`
+
+	// The type of the Wang set, "corner", "edge" or "mixed". (since 1.5)
+	Type string `xml:"type,attr,omitempty"`
+
+	// The tile ID of the tile representing this Wang set.
+	Tile int32 `xml:"tile,attr"`
+
+	// Can contain properties.
+	Properties Properties `xml:"properties,omitempty"`
+
+	// Can contain up to 254 wangcolor (since 1.5).
+	Colors []*WangColor `xml:"wangcolor"`
+
+	// Can contain any number of wangtile.
+	Tiles []*WangTile `xml:"wangtile"`
+}
+
+func (w *WangSet) afterDeserialize() (err error) {
+	var f float64
+	for i := 0; i < len(w.Colors); i++ {
+		var c = w.Colors[i]
+		if strings.TrimSpace(c.RawProbability) == "" {
+			c.Probability = 1.0
+		} else if f, err = strconv.ParseFloat(c.RawProbability, 32); err != nil {
+			return
+		} else {
+			c.Probability = float32(f)
+		}
+	}
+	for i := 0; i < len(w.Tiles); i++ {
+		if err = w.Tiles[i].afterDeserialize(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (w *WangSet) beforeSerialize() {
+	for i := 0; i < len(w.Colors); i++ {
+		var c = w.Colors[i]
+		if c.Probability == 1.0 {
+			c.RawProbability = "" // Defaults to 1.0, so omit from output.
+		} else {
+			c.RawProbability = strconv.FormatFloat(float64(c.Probability), 'f', -1, 32)
+		}
+	}
+	for i := 0; i < len(w.Tiles); i++ {
+		w.Tiles[i].beforeSerialize()
+	}
+}
+
+// A color that can be used to define the corner and/or edge of a Wang tile.
+type WangColor struct {
+	// The name of this color.
+	Name string `xml:"name,attr"`
+
+	// The color in #RRGGBB format (example: #c17d11).
+	Color string `xml:"color,attr"`
+
+	// The tile ID of the tile representing this color.
+	Tile int32 `xml:"tile,attr"`
+
+	// The relative probability that this color is chosen over others in
+	// case of multiple options. Defaults to 1.
+	RawProbability string  `xml:"probability,attr,omitempty"`
+	Probability    float32 `xml:"-"`
+
+	// Can contain properties.
+	Properties Properties `xml:"properties,omitempty"`
+}
+
+// Returns the relative probability of a tile with the given Wang ID
+// being chosen, which is the product of the probabilities of its colors.
+func (w *WangSet) WangIdProbability(id [8]uint8) (p float64) {
+	p = 1
+	for i := 0; i < len(id); i++ {
+		if id[i] > 0 && int(id[i]) <= len(w.Colors) {
+			p *= float64(w.Colors[id[i]-1].Probability)
+		}
+	}
+	return
+}
+
+// Indexes into WangTile.WangId, in the order used by Tiled.
+const (
+	WANG_TOP = iota
+	WANG_TOP_RIGHT
+	WANG_RIGHT
+	WANG_BOTTOM_RIGHT
+	WANG_BOTTOM
+	WANG_BOTTOM_LEFT
+	WANG_LEFT
+	WANG_TOP_LEFT
+)
+
+// Defines a Wang tile, by referring to a tile in the tileset and
+// associating it with a certain Wang ID.
+type WangTile struct {
+	// The tile ID.
+	TileId uint32 `xml:"tileid,attr"`
+
+	// The Wang ID, given by a comma-separated list of indexes (0-254)
+	// referring to the Wang colors in the Wang set in the order: top,
+	// top-right, right, bottom-right, bottom, bottom-left, left,
+	// top-left. Index 0 means unset and index 1 refers to the
+	// first Wang color. (since 1.5)
+	RawWangId string   `xml:"wangid,attr"`
+	WangId    [8]uint8 `xml:"-"`
+}
+
+func (w *WangTile) afterDeserialize() (err error) {
+	var (
+		parts = strings.Split(w.RawWangId, ",")
+		i     uint64
+	)
+	if len(parts) != len(w.WangId) {
+		err = fmt.Errorf("Invalid wangid %v", w.RawWangId)
+		return
+	}
+	for j := 0; j < len(parts); j++ {
+		if i, err = strconv.ParseUint(strings.TrimSpace(parts[j]), 10, 8); err != nil {
+			return
+		}
+		w.WangId[j] = uint8(i)
+	}
+	return
+}
+
+func (w *WangTile) beforeSerialize() {
+	var parts = make([]string, len(w.WangId))
+	for j := 0; j < len(w.WangId); j++ {
+		parts[j] = strconv.Itoa(int(w.WangId[j]))
+	}
+	w.RawWangId = strings.Join(parts, ",")
 }
 
 type TilesetTile struct {
@@ -402,7 +1276,7 @@ type TilesetTile struct {
 	// in the order top-left, top-right, bottom-left, bottom-right.
 	// Leaving out a value means that corner has no terrain.
 	// (optional) (since 0.9.0)
-	Terrain string `xml:"terrain,attr"`
+	Terrain string `xml:"terrain,attr,omitempty"`
 
 	// A percentage indicating the probability that this tile is
 	// chosen when it competes with others while editing with
@@ -410,15 +1284,41 @@ type TilesetTile struct {
 	Probability float32 `xml:"probability,attr"`
 
 	// Can contain properties.
-	Properties []Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain image (since 0.9.0).
 	Image *Image `xml:"image"`
+
+	// Can contain animation (since 0.10).
+	Animation *Animation `xml:"animation"`
+}
+
+// Contains a list of animation frames. Each tile can have exactly one
+// animation associated with it. In the future, there could be support
+// for multiple named animations on a tile.
+type Animation struct {
+	// Can contain frame.
+	Frames []Frame `xml:"frame"`
+}
+
+// A single frame of an animation.
+type Frame struct {
+	// The local ID of a tile within the parent tileset.
+	TileId uint32 `xml:"tileid,attr"`
+
+	// How long (in milliseconds) this frame should be displayed before
+	// advancing to the next frame.
+	Duration uint32 `xml:"duration,attr"`
 }
 
 // All <tileset> tags shall occur before the first <layer> tag so that
 // parsers may rely on having the tilesets before needing to resolve tiles.
 type Layer struct {
+	// Unique ID of the layer. Each layer added to a map gets a unique
+	// id, and no layer ever gets the id of a layer that was removed.
+	// (since 1.2)
+	Id int32 `xml:"id,attr,omitempty"`
+
 	// The name of the layer.
 	Name string `xml:"name,attr"`
 
@@ -446,11 +1346,44 @@ type Layer struct {
 	RawVisible string `xml:"visible,attr,omitempty"`
 	Visible    bool   `xml:"-"`
 
+	// Rendering offset for this layer in pixels. Defaults to 0.
+	// (since 0.14)
+	OffsetX float32 `xml:"offsetx,attr,omitempty"`
+	OffsetY float32 `xml:"offsety,attr,omitempty"`
+
+	// Parallax factors of the layer. Defaults to 1. (since 1.5)
+	RawParallaxX string  `xml:"parallaxx,attr,omitempty"`
+	ParallaxX    float32 `xml:"-"`
+	RawParallaxY string  `xml:"parallaxy,attr,omitempty"`
+	ParallaxY    float32 `xml:"-"`
+
 	// Can contain properties.
-	Properties []Property `xml:"properties,omitempty>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain data.
 	Data *Data `xml:"data"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+
+	occupancy *layerOccupancy
+}
+
+// Creates a visible, fully opaque layer holding the tiles of grid.
+func NewLayer(name string, grid DataTileGrid) (l *Layer, err error) {
+	l = &Layer{
+		Name:      name,
+		Width:     int32(grid.Width),
+		Height:    int32(grid.Height),
+		Opacity:   1.0,
+		Visible:   true,
+		ParallaxX: 1.0,
+		ParallaxY: 1.0,
+		Data:      &Data{Encoding: "base64", Compression: "zlib"},
+	}
+	err = l.SetGrid(grid)
+	return
 }
 
 func (l *Layer) afterDeserialize() (err error) {
@@ -458,6 +1391,12 @@ func (l *Layer) afterDeserialize() (err error) {
 		f float64
 		i int64
 	)
+	if l.ParallaxX, err = parseParallax(l.RawParallaxX); err != nil {
+		return
+	}
+	if l.ParallaxY, err = parseParallax(l.RawParallaxY); err != nil {
+		return
+	}
 	if strings.TrimSpace(l.RawOpacity) != "" {
 		if f, err = strconv.ParseFloat(l.RawOpacity, 32); err != nil {
 			return
@@ -474,6 +1413,13 @@ func (l *Layer) afterDeserialize() (err error) {
 	} else {
 		l.Visible = true
 	}
+	if l.Data != nil {
+		for j := 0; j < len(l.Data.Chunks); j++ {
+			if err = l.Data.Chunks[j].validate(); err != nil {
+				return l.Data.wrapError(err)
+			}
+		}
+	}
 	return
 }
 
@@ -491,6 +1437,8 @@ func (l *Layer) beforeSerialize() (err error) {
 	} else {
 		l.RawOpacity = strconv.FormatFloat(float64(l.Opacity), 'f', -1, 32)
 	}
+	l.RawParallaxX = formatParallax(l.ParallaxX)
+	l.RawParallaxY = formatParallax(l.ParallaxY)
 	if grid, err = l.GetGrid(); err != nil {
 		return
 	}
@@ -498,14 +1446,138 @@ func (l *Layer) beforeSerialize() (err error) {
 	return
 }
 
+// Decodes the tiles of the layer. The grid of a layer of an infinite map
+// covers the ChunkBounds of its data instead of the layer's size.
 func (l *Layer) GetGrid() (DataTileGrid, error) {
-	return l.Data.GetTileGrid(int(l.Width), int(l.Height))
+	return l.GetGridContext(context.Background())
+}
+
+// Like GetGrid, but stops decoding and returns ctx.Err() once ctx is done.
+func (l *Layer) GetGridContext(ctx context.Context) (DataTileGrid, error) {
+	if l.Data.chunked() {
+		return l.Data.chunkGrid(ctx)
+	}
+	return l.Data.GetTileGridContext(ctx, int(l.Width), int(l.Height))
+}
+
+// Calls fn with every tile of the layer, row by row, decoding the tiles
+// as they are needed. Unlike GetGrid no grid of the whole layer is
+// created, so very large layers can be read in little memory. Iteration
+// stops at the first error fn returns, which is passed on to the caller.
+// The size of the data is only checked against the size of the layer as
+// the tiles are read, so fn may have been called for some tiles before
+// an error is returned for a mismatch.
+func (l *Layer) EachTile(fn func(x, y int, t DataTileGridTile) error) (err error) {
+	var (
+		width  = int(l.Width)
+		count  = width * int(l.Height)
+		called int
+	)
+	if l.Data.chunked() {
+		return l.eachChunkTile(fn)
+	}
+	err = l.Data.streamGids(context.Background(), func(i int, gid uint32) error {
+		if i >= count {
+			return l.Data.wrapError(fmt.Errorf(
+				"More tiles than width x height (%v,%v)", l.Width, l.Height))
+		}
+		called++
+		return fn(i%width, i/width, gridTile(gid))
+	})
+	if err == nil && called != count {
+		err = l.Data.wrapError(fmt.Errorf(
+			"Tile length %v didn't match width x height (%v,%v)",
+			called, l.Width, l.Height))
+	}
+	return
+}
+
+// Like EachTile for layers of infinite maps, calling fn chunk by chunk
+// with positions relative to the top left of the data's ChunkBounds.
+func (l *Layer) eachChunkTile(fn func(x, y int, t DataTileGridTile) error) (err error) {
+	var bounds = l.Data.ChunkBounds()
+	for i := 0; i < len(l.Data.Chunks); i++ {
+		var (
+			c      = l.Data.Chunks[i]
+			data   = l.Data.chunkData(c)
+			width  = int(c.Width)
+			count  = width * int(c.Height)
+			called int
+		)
+		err = data.streamGids(context.Background(), func(j int, gid uint32) error {
+			if j >= count {
+				return data.wrapError(fmt.Errorf(
+					"Chunk %v,%v: More tiles than width x height (%v,%v)", c.X, c.Y, c.Width, c.Height))
+			}
+			called++
+			return fn(int(c.X)-bounds.Min.X+j%width, int(c.Y)-bounds.Min.Y+j/width, gridTile(gid))
+		})
+		if err == nil && called != count {
+			err = data.wrapError(fmt.Errorf(
+				"Chunk %v,%v: Tile length %v didn't match width x height (%v,%v)",
+				c.X, c.Y, called, c.Width, c.Height))
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
 }
 
+// Stores the grid in the layer data, keeping its encoding. Data without
+// an encoding or compression is written as XML tile elements and CSV
+// data stays CSV. All other data is written with its encoding if
+// registered and base64 otherwise, keeping its compression if registered
+// and using zlib otherwise. Encoded data without a compression is
+// written uncompressed. The data of infinite maps is split into chunks
+// of the size of its first chunk, with the grid placed at the top left
+// of its ChunkBounds as returned by GetGrid. Chunks without tiles are
+// left out.
 func (l *Layer) SetGrid(grid DataTileGrid) error {
+	l.occupancy = nil
 	return l.Data.SetTileGrid(grid)
 }
 
+// Re-encodes the layer data. An empty encoding stores the tiles as XML
+// tile elements, as needed by some XML tools, and "csv" as comma
+// separated values. Neither takes a compression.
+// The "base64" encoding, like encodings registered with RegisterEncoding,
+// takes a compression registered with RegisterCompression, or no
+// compression to write the data uncompressed for tools that can't
+// inflate it.
+func (l *Layer) SetEncoding(encoding, compression string) (err error) {
+	var grid DataTileGrid
+	switch {
+	case (encoding == "" || encoding == "csv") && compression != "":
+		return fmt.Errorf("Compression %v requires base64 encoding", compression)
+	case encoding != "" && encoding != "csv" && !hasEncoding(encoding):
+		return fmt.Errorf("Unsupported encoding %v", encoding)
+	}
+	if _, ok := compressions[compression]; compression != "" && !ok {
+		return fmt.Errorf("Unsupported compression %v", compression)
+	}
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	l.Data.Encoding = encoding
+	l.Data.Compression = compression
+	return l.SetGrid(grid)
+}
+
+// Re-encodes the data of every tile layer of the map as by
+// Layer.SetEncoding, so the map is serialized with the given encoding
+// and compression, such as "gzip" for tools that don't read zlib. The
+// map's CompressionLevel is applied.
+func (m *Map) SetEncoding(encoding, compression string) (err error) {
+	for i := 0; i < len(m.Layers); i++ {
+		m.Layers[i].Data.level = m.CompressionLevel
+		if err = m.Layers[i].SetEncoding(encoding, compression); err != nil {
+			return m.layerError(m.Layers[i], err)
+		}
+	}
+	return
+}
+
 // When no encoding or compression is given, the tiles are stored as
 // individual XML tile elements. Next to that, the easiest format
 // to parse is the "csv" (comma separated values) format.
@@ -525,112 +1597,302 @@ func (l *Layer) SetGrid(grid DataTileGrid) error {
 type Data struct {
 	// The encoding used to encode the tile layer data.
 	// When used, it can be "base64" and "csv" at the moment.
-	Encoding string `xml:"encoding,attr"`
+	Encoding string `xml:"encoding,attr,omitempty"`
 
 	// The compression used to compress the tile layer data.
 	// Tiled Qt supports "gzip" and "zlib".
-	Compression string `xml:"compression,attr"`
+	Compression string `xml:"compression,attr,omitempty"`
 
 	// Can contain tile.
 	RawTiles []DataTile `xml:"tile"`
 
 	RawContents string `xml:",chardata"`
+
+	// Can contain chunk, for the layers of infinite maps. The grid
+	// methods of layers decode and encode chunks, while Tiles, Gids and
+	// the like only see the tiles outside chunks. (since 1.2)
+	Chunks []*Chunk `xml:"chunk"`
+
+	// Whether the data belongs to an infinite map, and so is chunked
+	// even if it has no chunks.
+	infinite bool
+
+	// The gids read from a decode cache or by DecodeAllLayers, used
+	// instead of decoding the contents until the grid is set.
+	cached []uint32
+
+	// The compression level of the map the data belongs to, applied
+	// when the data is written.
+	level *int32
+
+	// The limits of the Loader the map was read through, if any.
+	limits Limits
+
+	// Whether the tiles were replaced after the data was read, so no
+	// decode cache is written for it.
+	modified bool
 }
 
 func (d *Data) Contents() string {
 	return strings.TrimSpace(d.RawContents)
 }
 
-func (d *Data) base64Tiles() (tiles []DataTile, err error) {
-	var (
-		data  []byte
-		buf   *bytes.Reader
-		r     io.ReadCloser
-		count int32
-		gids  []uint32
-	)
-	if data, err = base64.StdEncoding.DecodeString(d.Contents()); err != nil {
+// How many gids are converted between checks for cancellation.
+const DECODE_CHECK_INTERVAL = 1 << 16
+
+// Fails reads with ctx.Err() once ctx is done, so that long running
+// decoders reading from it can be aborted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (n int, err error) {
+	if err = c.ctx.Err(); err != nil {
 		return
 	}
-	switch d.Compression {
-	case "gzip":
-		buf = bytes.NewReader(data)
-		if r, err = gzip.NewReader(buf); err != nil {
-			return
+	return c.r.Read(p)
+}
+
+// Returns whether encoding is base64 or registered with RegisterEncoding.
+func hasEncoding(encoding string) bool {
+	var _, ok = encodings[encoding]
+	return ok
+}
+
+// Returns gids as four little endian bytes each. Unlike binary.Write
+// this does not go through reflection, which is slow on large layers.
+func gidBytes(gids []uint32) (data []byte) {
+	data = make([]byte, len(gids)*4)
+	for i := 0; i < len(gids); i++ {
+		binary.LittleEndian.PutUint32(data[i*4:], gids[i])
+	}
+	return
+}
+
+// Returns a reader of the decoded and decompressed contents of base64
+// data, or data of another registered encoding, holding one little
+// endian gid every four bytes. The reader must be closed once read.
+func (d *Data) encodedReader(ctx context.Context) (src io.ReadCloser, err error) {
+	var r io.ReadCloser
+	var e, ok = encodings[d.Encoding]
+	if !ok {
+		err = fmt.Errorf("Unsupported encoding %v", d.Encoding)
+		return
+	}
+	src = ioutil.NopCloser(&contextReader{ctx, e.reader(strings.NewReader(d.Contents()))})
+	if d.Compression != "" {
+		var c, ok = compressions[d.Compression]
+		if !ok {
+			err = fmt.Errorf("Unsupported compression %v", d.Compression)
+			return nil, err
 		}
-		defer r.Close()
-		if data, err = ioutil.ReadAll(r); err != nil {
-			return
+		if r, err = c.reader(src); err != nil {
+			return nil, err
 		}
-	case "zlib":
-		buf = bytes.NewReader(data)
-		if r, err = zlib.NewReader(buf); err != nil {
-			return
+		src = struct {
+			io.Reader
+			io.Closer
+		}{&contextReader{ctx, r}, r}
+	}
+	return
+}
+
+// Parses the value of tile i of CSV layer data. Gids are unsigned 32 bit
+// values, as the flip flags take up the highest bits, so negative values
+// and values beyond 32 bits are reported instead of being truncated.
+func parseCsvGid(field string, i int) (gid uint32, err error) {
+	var v uint64
+	field = strings.TrimSpace(field)
+	if v, err = strconv.ParseUint(field, 10, 32); err == nil {
+		return uint32(v), nil
+	}
+	if _, e := strconv.ParseInt(field, 10, 64); e == nil && strings.HasPrefix(field, "-") {
+		return 0, fmt.Errorf("Negative gid %v for tile %v", field, i)
+	}
+	if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+		return 0, fmt.Errorf("Gid %v for tile %v exceeds 32 bits", field, i)
+	}
+	return 0, fmt.Errorf("Invalid gid %q for tile %v", field, i)
+}
+
+// Formats gids as CSV the way Tiled does, with each row of the grid on
+// a line of its own.
+func csvContents(gids []uint32, width int) string {
+	var buf bytes.Buffer
+	buf.WriteString("\n")
+	for i := 0; i < len(gids); i++ {
+		buf.WriteString(strconv.FormatUint(uint64(gids[i]), 10))
+		if i < len(gids)-1 {
+			buf.WriteString(",")
 		}
-		defer r.Close()
-		if data, err = ioutil.ReadAll(r); err != nil {
-			return
+		if (i+1)%width == 0 || i == len(gids)-1 {
+			buf.WriteString("\n")
 		}
 	}
-	buf = bytes.NewReader(data)
-	count = int32(len(data) / binary.Size(count))
-	gids = make([]uint32, count)
-	if err = binary.Read(buf, binary.LittleEndian, &gids); err != nil {
+	return buf.String()
+}
+
+func (d *Data) Tiles() (tiles []DataTile, err error) {
+	return d.TilesContext(context.Background())
+}
+
+// Like Tiles, but stops decoding and returns ctx.Err() once ctx is done.
+// The returned error wraps ctx.Err(), so use errors.Is to test for it.
+func (d *Data) TilesContext(ctx context.Context) (tiles []DataTile, err error) {
+	if d.cached != nil {
+		tiles = make([]DataTile, len(d.cached))
+		for i := 0; i < len(d.cached); i++ {
+			tiles[i].Gid = d.cached[i]
+		}
 		return
 	}
-	tiles = make([]DataTile, count)
-	for i := 0; i < len(tiles); i++ {
-		tiles[i].Gid = gids[i]
+	if d.Encoding == "" {
+		if max := d.limits.MaxTiles; max > 0 && int64(len(d.RawTiles)) > max {
+			err = d.wrapError(&LimitError{Limit: "tiles", Value: int64(len(d.RawTiles)), Max: max})
+			return
+		}
+		return d.RawTiles, nil
+	}
+	err = d.streamGids(ctx, func(i int, gid uint32) error {
+		tiles = append(tiles, DataTile{Gid: gid})
+		return nil
+	})
+	if err != nil {
+		tiles = nil
+	} else if tiles == nil {
+		tiles = []DataTile{}
 	}
 	return
 }
 
-func (d *Data) csvTiles() (tiles []DataTile, err error) {
-	err = fmt.Errorf("Not implemented")
-	return
+// Returns the gids of the data in row major order, including flip
+// flags. Unlike Tiles this does not allocate a DataTile per cell, which
+// halves the memory needed to decode large layers.
+func (d *Data) Gids() (gids []uint32, err error) {
+	return d.GidsContext(context.Background())
 }
 
-func (d *Data) Tiles() (tiles []DataTile, err error) {
-	switch d.Encoding {
-	case "base64":
-		tiles, err = d.base64Tiles()
-	case "csv":
-		tiles, err = d.csvTiles()
-	default:
-		tiles = d.RawTiles
+// Like Gids, but stops decoding and returns ctx.Err() once ctx is done.
+func (d *Data) GidsContext(ctx context.Context) (gids []uint32, err error) {
+	gids = []uint32{}
+	if err = d.streamGids(ctx, func(i int, gid uint32) error {
+		gids = append(gids, gid)
+		return nil
+	}); err != nil {
+		gids = nil
 	}
 	return
 }
 
 func (d *Data) GetTileGrid(width, height int) (grid DataTileGrid, err error) {
-	var (
-		tiles []DataTile
-	)
-	if tiles, err = d.Tiles(); err != nil {
+	return d.GetTileGridContext(context.Background(), width, height)
+}
+
+// Like GetTileGrid, but stops decoding and returns ctx.Err() once ctx
+// is done.
+func (d *Data) GetTileGridContext(ctx context.Context, width, height int) (grid DataTileGrid, err error) {
+	var gids []uint32
+	if d.chunked() {
+		if bounds := d.ChunkBounds(); bounds.Dx() != width || bounds.Dy() != height {
+			err = d.wrapError(fmt.Errorf(
+				"Chunk bounds %v didn't match width x height (%v,%v)",
+				bounds, width, height))
+			return
+		}
+		return d.chunkGrid(ctx)
+	}
+	// The gids are decoded before the grid is made, so that a size not
+	// matching the data is reported without allocating the grid.
+	if gids, err = d.GidsContext(ctx); err != nil {
 		return
 	}
-	if len(tiles) != width*height {
-		err = fmt.Errorf(
+	if len(gids) != width*height {
+		err = d.wrapError(fmt.Errorf(
 			"Tile length %v didn't match width x height (%v,%v)",
-			len(tiles), width, height)
+			len(gids), width, height))
 		return
 	}
-	grid = DataTileGrid{
-		Width:  width,
-		Height: height,
-		Tiles:  make([][]DataTileGridTile, width),
+	grid = NewDataTileGrid(width, height)
+	for i := 0; i < len(gids); i++ {
+		grid.Tiles[i%width][i/width] = gridTile(gids[i])
+	}
+	return
+}
+
+// Calls fn with the index and gid of every tile of the data in turn,
+// decoding the tiles as they are needed instead of all at once. This is
+// the one decoder of tile data, which the other accessors build on.
+// Iteration stops at the first error fn returns, which is passed on to
+// the caller, and once ctx is done or the limits of the data are
+// exceeded, which is reported wrapped as a DataError.
+func (d *Data) streamGids(ctx context.Context, fn func(i int, gid uint32) error) (err error) {
+	var each = func(i int, gid uint32) error {
+		if i%DECODE_CHECK_INTERVAL == 0 {
+			if err := ctx.Err(); err != nil {
+				return d.wrapError(err)
+			}
+		}
+		if max := d.limits.MaxTiles; max > 0 && int64(i) >= max {
+			return d.wrapError(&LimitError{Limit: "tiles", Value: int64(i) + 1, Max: max})
+		}
+		return fn(i, gid)
 	}
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			if y == 0 {
-				grid.Tiles[x] = make([]DataTileGridTile, height)
+	switch {
+	case d.cached != nil:
+		for i := 0; i < len(d.cached); i++ {
+			if err = each(i, d.cached[i]); err != nil {
+				return
 			}
-			var id, flipX, flipY, flipD = parseGid(tiles[width*y+x].Gid)
-			grid.Tiles[x][y] = DataTileGridTile{
-				Id:    id,
-				FlipX: flipX,
-				FlipY: flipY,
-				FlipD: flipD,
+		}
+	case d.Encoding == "":
+		for i := 0; i < len(d.RawTiles); i++ {
+			if err = each(i, d.RawTiles[i].Gid); err != nil {
+				return
+			}
+		}
+	case d.Encoding == "csv":
+		var (
+			contents = d.Contents()
+			gid      uint32
+		)
+		for i, start := 0, 0; contents != ""; i++ {
+			var (
+				end   = strings.IndexByte(contents[start:], ',')
+				field = contents[start:]
+			)
+			if end >= 0 {
+				field = contents[start : start+end]
+			}
+			if gid, err = parseCsvGid(field, i); err != nil {
+				return d.wrapError(err)
+			}
+			if err = each(i, gid); err != nil || end < 0 {
+				return
+			}
+			start += end + 1
+		}
+	default:
+		var (
+			src io.ReadCloser
+			r   *bufio.Reader
+			buf [4]byte
+		)
+		if src, err = d.encodedReader(ctx); err != nil {
+			return d.wrapError(err)
+		}
+		defer src.Close()
+		r = bufio.NewReader(&limitedReader{r: src, limit: "layer bytes", max: d.limits.MaxLayerBytes})
+		for i := 0; ; i++ {
+			if _, err = io.ReadFull(r, buf[:]); err != nil {
+				// Trailing bytes short of a gid are ignored.
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					err = nil
+				}
+				return d.wrapError(err)
+			}
+			if err = each(i, binary.LittleEndian.Uint32(buf[:])); err != nil {
+				return
 			}
 		}
 	}
@@ -638,34 +1900,93 @@ func (d *Data) GetTileGrid(width, height int) (grid DataTileGrid, err error) {
 }
 
 func (d *Data) SetTileGrid(grid DataTileGrid) (err error) {
+	if d.chunked() {
+		return d.setChunkGrid(grid)
+	}
+	var gids = make([]uint32, grid.Width*grid.Height)
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			gids[grid.Width*y+x] = uint32(grid.Tiles[x][y].GID())
+		}
+	}
+	return d.SetGids(grid.Width, grid.Height, gids)
+}
+
+// Stores gids, including flip flags, in row major order as the tiles of
+// a grid of width by height, encoded as by SetTileGrid. This is the
+// counterpart of Gids, for callers that keep tiles as a flat array.
+func (d *Data) SetGids(width, height int, gids []uint32) (err error) {
 	var (
 		buf        bytes.Buffer
-		b64Encoder io.WriteCloser
-		zlibWriter *zlib.Writer
-		gids       []uint32
-		gridTile   DataTileGridTile
+		encoder    io.WriteCloser
+		compressor io.WriteCloser
+		c          codec
+		e          textEncoding
+		ok         bool
 	)
-	d.Encoding = "base64"
-	d.Compression = "zlib"
+	if len(gids) != width*height {
+		return d.wrapError(fmt.Errorf(
+			"Tile length %v didn't match width x height (%v,%v)",
+			len(gids), width, height))
+	}
+	if d.chunked() {
+		var grid = NewDataTileGrid(width, height)
+		for i := 0; i < len(gids); i++ {
+			grid.Tiles[i%width][i/width] = gridTile(gids[i])
+		}
+		return d.setChunkGrid(grid)
+	}
+	d.cached = nil
+	d.modified = true
+	if d.Encoding == "csv" && d.Compression == "" {
+		d.RawTiles = []DataTile{}
+		d.RawContents = csvContents(gids, width)
+		return
+	}
+	// Data without an encoding or compression is kept as XML tile elements.
+	if d.Encoding == "" && d.Compression == "" {
+		d.RawContents = ""
+		d.RawTiles = make([]DataTile, len(gids))
+		for i := 0; i < len(gids); i++ {
+			d.RawTiles[i].Gid = gids[i]
+		}
+		return
+	}
+	// Keep the encoding and compression of the data if possible,
+	// defaulting to base64 and zlib. Encoded data without a compression
+	// stays uncompressed.
+	if e, ok = encodings[d.Encoding]; ok && d.Compression == "" {
+		c = codec{writer: func(w io.Writer) io.WriteCloser { return nopCloser{w} }}
+	} else if c, ok = compressions[d.Compression]; !ok {
+		d.Compression = "zlib"
+		c = compressions[d.Compression]
+	}
+	if e, ok = encodings[d.Encoding]; !ok {
+		d.Encoding = "base64"
+		e = encodings[d.Encoding]
+	}
 	d.RawTiles = []DataTile{}
-	gids = make([]uint32, grid.Width*grid.Height)
-	for y := 0; y < grid.Height; y++ {
-		for x := 0; x < grid.Width; x++ {
-			gridTile = grid.Tiles[x][y]
-			gids[grid.Width*y+x] = encodeGid(
-				gridTile.Id,
-				gridTile.FlipX,
-				gridTile.FlipY,
-				gridTile.FlipD)
+	encoder = e.writer(&buf)
+	if d.level != nil && c.leveled != nil {
+		if compressor, err = c.leveled(encoder, int(*d.level)); err != nil {
+			err = d.wrapError(err)
+			return
 		}
+	} else {
+		compressor = c.writer(encoder)
+	}
+	if _, err = compressor.Write(gidBytes(gids)); err != nil {
+		err = d.wrapError(err)
+		return
 	}
-	b64Encoder = base64.NewEncoder(base64.StdEncoding, &buf)
-	zlibWriter = zlib.NewWriter(b64Encoder)
-	if err = binary.Write(zlibWriter, binary.LittleEndian, gids); err != nil {
+	if err = compressor.Close(); err != nil {
+		err = d.wrapError(err)
+		return
+	}
+	if err = encoder.Close(); err != nil {
+		err = d.wrapError(err)
 		return
 	}
-	zlibWriter.Close()
-	b64Encoder.Close()
 	d.RawContents = buf.String()
 	return
 }
@@ -685,16 +2006,42 @@ type DataTileGrid struct {
 	Tiles  [][]DataTileGridTile
 }
 
+// Creates an empty grid of the given dimensions.
+func NewDataTileGrid(width, height int) (grid DataTileGrid) {
+	grid = DataTileGrid{
+		Width:  width,
+		Height: height,
+		Tiles:  make([][]DataTileGridTile, width),
+	}
+	// Columns share a single backing array.
+	var backing = make([]DataTileGridTile, width*height)
+	for x := 0; x < width; x++ {
+		grid.Tiles[x] = backing[x*height : (x+1)*height : (x+1)*height]
+	}
+	return
+}
+
 type DataTileGridTile struct {
-	Id    uint32
-	FlipX bool
-	FlipY bool
-	FlipD bool
+	Id        uint32
+	FlipX     bool
+	FlipY     bool
+	FlipD     bool
+	RotateHex bool
+}
+
+// Returns the gid of the tile, including flip flags.
+func (t DataTileGridTile) GID() GID {
+	return GID(EncodeGID(t.Id, t.FlipX, t.FlipY, t.FlipD, t.RotateHex))
 }
 
 // The object group is in fact a map layer,
 // and is hence called "object layer" in Tiled Qt.
 type ObjectGroup struct {
+	// Unique ID of the layer. Each layer added to a map gets a unique
+	// id, and no layer ever gets the id of a layer that was removed.
+	// (since 1.2)
+	Id int32 `xml:"id,attr,omitempty"`
+
 	// The name of the object group.
 	Name string `xml:"name,attr"`
 
@@ -721,11 +2068,70 @@ type ObjectGroup struct {
 	// Whether the layer is shown (1) or hidden (0). Defaults to 1.
 	Visible bool `xml:"visible,attr"`
 
+	// Rendering offset for this object group in pixels. Defaults to 0.
+	// (since 0.14)
+	OffsetX float32 `xml:"offsetx,attr,omitempty"`
+	OffsetY float32 `xml:"offsety,attr,omitempty"`
+
+	// Parallax factors of the object group. Defaults to 1. (since 1.5)
+	RawParallaxX string  `xml:"parallaxx,attr,omitempty"`
+	ParallaxX    float32 `xml:"-"`
+	RawParallaxY string  `xml:"parallaxy,attr,omitempty"`
+	ParallaxY    float32 `xml:"-"`
+
 	// Can contain properties.
-	Properties []Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain object.
 	Objects []Object `xml:"object"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+}
+
+// Creates a visible, fully opaque object group without objects. A zero
+// ObjectGroup has parallax factors of 0, which are written out as such.
+func NewObjectGroup(name string) *ObjectGroup {
+	return &ObjectGroup{
+		Name:      name,
+		Opacity:   1.0,
+		Visible:   true,
+		ParallaxX: 1.0,
+		ParallaxY: 1.0,
+	}
+}
+
+func (g *ObjectGroup) afterDeserialize() (err error) {
+	if g.ParallaxX, err = parseParallax(g.RawParallaxX); err != nil {
+		return
+	}
+	g.ParallaxY, err = parseParallax(g.RawParallaxY)
+	return
+}
+
+func (g *ObjectGroup) beforeSerialize() {
+	g.RawParallaxX = formatParallax(g.ParallaxX)
+	g.RawParallaxY = formatParallax(g.ParallaxY)
+}
+
+// Parses a parallax factor, which defaults to 1.
+func parseParallax(raw string) (f float32, err error) {
+	var f64 float64
+	if strings.TrimSpace(raw) == "" {
+		return 1.0, nil
+	}
+	if f64, err = strconv.ParseFloat(raw, 32); err != nil {
+		return
+	}
+	return float32(f64), nil
+}
+
+func formatParallax(f float32) string {
+	if f == 1.0 {
+		return "" // Defaults to 1.0, so omit from output.
+	}
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
 }
 
 // While tile layers are very suitable for anything repetitive
@@ -744,6 +2150,10 @@ type ObjectGroup struct {
 // it's aligned to the bottom-left while in isometric it's aligned
 // to the bottom-center.
 type Object struct {
+	// Unique ID of the object. Each object placed on a map gets a unique
+	// id, even if an object was deleted. (since 0.11)
+	Id int32 `xml:"id,attr,omitempty"`
+
 	// name: The name of the object. An arbitrary string.
 	Name string `xml:"name,attr"`
 
@@ -774,7 +2184,7 @@ type Object struct {
 	Visible bool `xml:"visible,attr"`
 
 	// Can contain properties.
-	Properties []Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain ellipse (since 0.9.0).
 	Ellipse *Ellipse `xml:"ellipse"`
@@ -787,6 +2197,36 @@ type Object struct {
 
 	// Can contain image.
 	Image *Image `xml:"image"`
+
+	// Can contain text (since 1.0).
+	Text *Text `xml:"text"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+}
+
+// Returns the pixel bounds of the object relative to the map's Origin.
+// Tile objects are positioned by their bottom left corner in TMX files,
+// all other objects by their top left corner. On isometric maps the
+// bounds are in screen pixels and enclose the projected object.
+func (m *Map) ObjectBounds(o *Object) (b Bounds) {
+	if m.Orientation == "isometric" {
+		return m.isometricObjectBounds(o)
+	}
+	b = Bounds{
+		X: float32(o.X),
+		Y: float32(o.Y),
+		W: float32(o.Width),
+		H: float32(o.Height),
+	}
+	if o.Gid != nil {
+		b.Y -= b.H
+	}
+	if m.Origin == ORIGIN_BOTTOM_LEFT {
+		b.Y = float32(m.Height*m.TileHeight) - b.Y - b.H
+	}
+	return
 }
 
 // Used to mark an object as an ellipse.
@@ -802,13 +2242,112 @@ type Polygon struct {
 	RawPoints string `xml:"points,attr"`
 }
 
+func (p *Polygon) Points() ([]Point, error) {
+	return parsePoints(p.RawPoints)
+}
+
+func (p *Polygon) SetPoints(points []Point) {
+	p.RawPoints = formatPoints(points)
+}
+
 // A polyline follows the same placement definition as a polygon object.
 type Polyline struct {
 	RawPoints string `xml:"points,attr"`
 }
 
+func (p *Polyline) Points() ([]Point, error) {
+	return parsePoints(p.RawPoints)
+}
+
+func (p *Polyline) SetPoints(points []Point) {
+	p.RawPoints = formatPoints(points)
+}
+
+type Point struct {
+	X, Y float32
+}
+
+func parsePoints(raw string) (points []Point, err error) {
+	var (
+		pairs = strings.Fields(raw)
+		f     float64
+	)
+	points = make([]Point, len(pairs))
+	for i := 0; i < len(pairs); i++ {
+		var coords = strings.Split(pairs[i], ",")
+		if len(coords) != 2 {
+			err = fmt.Errorf("Invalid point %v", pairs[i])
+			return
+		}
+		if f, err = strconv.ParseFloat(coords[0], 32); err != nil {
+			return
+		}
+		points[i].X = float32(f)
+		if f, err = strconv.ParseFloat(coords[1], 32); err != nil {
+			return
+		}
+		points[i].Y = float32(f)
+	}
+	return
+}
+
+func formatPoints(points []Point) string {
+	var pairs = make([]string, len(points))
+	for i := 0; i < len(points); i++ {
+		pairs[i] = strconv.FormatFloat(float64(points[i].X), 'f', -1, 32) + "," +
+			strconv.FormatFloat(float64(points[i].Y), 'f', -1, 32)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Used to mark an object as a text object. Contains the actual text
+// as character data.
+type Text struct {
+	// The font family used (defaults to "sans-serif").
+	FontFamily string `xml:"fontfamily,attr,omitempty"`
+
+	// The size of the font in pixels (defaults to 16).
+	PixelSize int32 `xml:"pixelsize,attr,omitempty"`
+
+	// Whether word wrapping is enabled (1) or disabled (0). Defaults to 0.
+	Wrap int32 `xml:"wrap,attr,omitempty"`
+
+	// Color of the text in #AARRGGBB or #RRGGBB format (defaults to #000000).
+	Color string `xml:"color,attr,omitempty"`
+
+	// Whether the font is bold (1) or not (0). Defaults to 0.
+	Bold int32 `xml:"bold,attr,omitempty"`
+
+	// Whether the font is italic (1) or not (0). Defaults to 0.
+	Italic int32 `xml:"italic,attr,omitempty"`
+
+	// Whether a line should be drawn below the text (1) or not (0).
+	// Defaults to 0.
+	Underline int32 `xml:"underline,attr,omitempty"`
+
+	// Whether a line should be drawn through the text (1) or not (0).
+	// Defaults to 0.
+	Strikeout int32 `xml:"strikeout,attr,omitempty"`
+
+	// Horizontal alignment of the text within the object
+	// ("left" (default), "center", "right" or "justify").
+	HAlign string `xml:"halign,attr,omitempty"`
+
+	// Vertical alignment of the text within the object
+	// ("top" (default), "center" or "bottom").
+	VAlign string `xml:"valign,attr,omitempty"`
+
+	// The text itself.
+	Contents string `xml:",chardata"`
+}
+
 // A layer consisting of a single image.
 type ImageLayer struct {
+	// Unique ID of the layer. Each layer added to a map gets a unique
+	// id, and no layer ever gets the id of a layer that was removed.
+	// (since 1.2)
+	Id int32 `xml:"id,attr,omitempty"`
+
 	// The name of the image layer.
 	Name string `xml:"name,attr"`
 
@@ -825,11 +2364,80 @@ type ImageLayer struct {
 	// Whether the layer is shown (1) or hidden (0). Defaults to 1.
 	Visible bool `xml:"visible,attr"`
 
+	// The position of the image layer in pixels. Deprecated since 0.15
+	// in favor of offsetx and offsety, but still found in older maps.
+	X int32 `xml:"x,attr,omitempty"`
+	Y int32 `xml:"y,attr,omitempty"`
+
+	// Rendering offset of the image in pixels. Defaults to 0.
+	// (since 0.15)
+	OffsetX float32 `xml:"offsetx,attr,omitempty"`
+	OffsetY float32 `xml:"offsety,attr,omitempty"`
+
+	// Parallax factors of the image layer. Defaults to 1. (since 1.5)
+	RawParallaxX string  `xml:"parallaxx,attr,omitempty"`
+	ParallaxX    float32 `xml:"-"`
+	RawParallaxY string  `xml:"parallaxy,attr,omitempty"`
+	ParallaxY    float32 `xml:"-"`
+
 	// Can contain properties.
-	Properties []Property `xml:"properties>property"`
+	Properties Properties `xml:"properties,omitempty"`
 
 	// Can contain image.
 	Image *Image `xml:"image"`
+
+	// Unrecognized child elements, kept if the map was read by a Loader
+	// with PreserveUnknown set.
+	Unknown []*Node `xml:",any"`
+}
+
+// Creates a visible, fully opaque image layer showing img. A zero
+// ImageLayer has parallax factors of 0, which are written out as such.
+func NewImageLayer(name string, img *Image) *ImageLayer {
+	return &ImageLayer{
+		Name:      name,
+		Opacity:   1.0,
+		Visible:   true,
+		ParallaxX: 1.0,
+		ParallaxY: 1.0,
+		Image:     img,
+	}
+}
+
+func (l *ImageLayer) afterDeserialize() (err error) {
+	if l.ParallaxX, err = parseParallax(l.RawParallaxX); err != nil {
+		return
+	}
+	l.ParallaxY, err = parseParallax(l.RawParallaxY)
+	return
+}
+
+func (l *ImageLayer) beforeSerialize() {
+	l.RawParallaxX = formatParallax(l.ParallaxX)
+	l.RawParallaxY = formatParallax(l.ParallaxY)
+}
+
+// Returns the rectangle covered by the image of the layer in pixels,
+// with Y growing down as in TMX files. The legacy x and y attributes
+// are added to the offset. The image size is taken from its width and
+// height attributes if set, and read from the image file through m
+// otherwise, since the layer's own width and height are meaningless.
+func (l *ImageLayer) PixelBounds(m *Map) (b Bounds, err error) {
+	var config image.Config
+	if l.Image == nil {
+		err = fmt.Errorf("Image layer %v has no image", l.Name)
+		return
+	}
+	b = Bounds{X: float32(l.X) + l.OffsetX, Y: float32(l.Y) + l.OffsetY}
+	if l.Image.Width > 0 && l.Image.Height > 0 {
+		b.W, b.H = float32(l.Image.Width), float32(l.Image.Height)
+		return
+	}
+	if config, err = m.imageConfig(l.Image); err != nil {
+		return
+	}
+	b.W, b.H = float32(config.Width), float32(config.Height)
+	return
 }
 
 // When the property spans contains newlines, the current versions
@@ -847,16 +2455,180 @@ type Property struct {
 
 	// The value of the property.
 	Value string `xml:"value,attr"`
+
+	// The type of the property. Can be "string" (default), "int",
+	// "float", "bool", "color", "file" (since 0.16) or "class"
+	// (since 1.8).
+	Type string `xml:"type,attr,omitempty"`
+
+	// The name of the custom property type, for properties of type
+	// "class" and enum properties. (since 1.8)
+	PropertyType string `xml:"propertytype,attr,omitempty"`
+
+	// For class properties, the members that differ from the defaults
+	// of the class. (since 1.8)
+	Members *PropertyList `xml:"properties"`
+
+	// Set for members filled in from the defaults of their class by
+	// Project.ResolveProperty, along with the default value, so that
+	// members left at their default are not written out.
+	fromClass    bool
+	defaultValue string
+}
+
+// Returns whether the property is written out, which members filled in
+// from class defaults are only once changed.
+func (p *Property) written() bool {
+	if !p.fromClass {
+		return true
+	}
+	if p.Members != nil {
+		return len(p.Members.written()) > 0
+	}
+	return p.Value != p.defaultValue
+}
+
+// The custom properties of an element.
+type Properties []Property
+
+// Returns the values of the properties keyed by name. Tiled does not
+// allow two properties of an element to share a name, but should a file
+// contain duplicates anyway, the last one wins. Class properties map to
+// their empty value, use their Members to reach the values inside.
+func (p Properties) ToMap() (values map[string]string) {
+	values = make(map[string]string, len(p))
+	for i := 0; i < len(p); i++ {
+		values[p[i].Name] = p[i].Value
+	}
+	return
+}
+
+// Properties are written as a properties element holding a property
+// element for each, with the properties element left out entirely when
+// there are none.
+func (p Properties) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(PropertyList{p}, start)
+}
+
+func (p *Properties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	var list PropertyList
+	if err = d.DecodeElement(&list, &start); err != nil {
+		return
+	}
+	*p = append(*p, list.Properties...)
+	return
+}
+
+// Replaces the properties by string properties holding values, sorted
+// by name so serialized maps don't change between runs.
+func (p *Properties) FromMap(values map[string]string) {
+	var names = make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	*p = make(Properties, len(names))
+	for i := 0; i < len(names); i++ {
+		(*p)[i] = Property{Name: names[i], Value: values[names[i]]}
+	}
+}
+
+// The members of a class property.
+type PropertyList struct {
+	Properties []Property `xml:"property"`
 }
 
+// Returns the properties that are written out.
+func (l PropertyList) written() (props []Property) {
+	for i := 0; i < len(l.Properties); i++ {
+		if l.Properties[i].written() {
+			props = append(props, l.Properties[i])
+		}
+	}
+	return
+}
+
+// Members filled in from the defaults of their class and left unchanged
+// are not written, as Tiled does, with the properties element left out
+// entirely when no members remain.
+func (l PropertyList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var props = l.written()
+	if len(props) == 0 && len(l.Properties) > 0 {
+		return nil
+	}
+	return e.EncodeElement(struct {
+		Properties []Property `xml:"property"`
+	}{props}, start)
+}
+
+// Parses a map without any Limits. Use Loader.ParseMapString for maps
+// from untrusted sources.
 func ParseMapString(data string) (m *Map, err error) {
+	return parseMap([]byte(data), nil)
+}
+
+// Like ParseMapString, see Loader.ParseMapReader for untrusted sources.
+func ParseMapReader(r io.Reader) (m *Map, err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	return parseMap(data, nil)
+}
+
+// Parses a map from data, which may be gzip compressed as is common
+// for .tmx.gz files. Options are taken from l, which may be nil.
+func parseMap(data []byte, l *Loader) (m *Map, err error) {
+	var (
+		decoder *xml.Decoder
+		limits  Limits
+	)
+	if l != nil {
+		limits = l.Limits
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+			return
+		}
+		defer r.Close()
+		if data, err = readLimited(r, "map bytes", limits.MaxMapBytes); err != nil {
+			return
+		}
+	}
+	if decoder, err = newMapDecoder(data); err != nil {
+		return
+	}
+	if l != nil && l.TiledJavaQuirks {
+		decoder = xml.NewTokenDecoder(&tiledJavaReader{r: decoder})
+	}
 	m = &Map{}
-	if err = xml.Unmarshal([]byte(data), m); err != nil {
+	if err = decoder.Decode(m); err != nil {
+		return
+	}
+	if err = m.checkLimits(limits); err != nil {
 		return
 	}
+	if l == nil || !l.PreserveUnknown {
+		m.dropUnknown()
+	}
 	if err = m.afterDeserialize(); err != nil {
 		return
 	}
+	m.setLimits(limits)
+	return
+}
+
+func ParseMapFile(filename string) (m *Map, err error) {
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	if m, err = ParseMapReader(f); err != nil {
+		return
+	}
+	m.BaseDir = filepath.Dir(filename)
 	return
 }
 
@@ -867,9 +2639,57 @@ func (m *Map) Serialize() (str string, err error) {
 	if err = m.beforeSerialize(); err != nil {
 		return
 	}
+	if errs := m.ValidateProperties(); len(errs) > 0 {
+		err = errs[0]
+		return
+	}
 	if bytes, err = xml.MarshalIndent(m, "", "  "); err != nil {
 		return
 	}
 	str = xml.Header + string(bytes)
 	return
 }
+
+// Returns pointers to the ids of all layers of the map: tile layers,
+// then object groups, then image layers.
+func (m *Map) layerIds() (ids []*int32) {
+	for i := 0; i < len(m.Layers); i++ {
+		ids = append(ids, &m.Layers[i].Id)
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		ids = append(ids, &m.ObjectGroups[i].Id)
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		ids = append(ids, &m.ImageLayers[i].Id)
+	}
+	return
+}
+
+// Gives layers without an id, or with the id of an earlier layer, such
+// as layers created with NewLayer or copied from other maps, the next
+// free id, and advances NextLayerId past all ids in use. Maps predating
+// layer ids, with neither NextLayerId nor any layer id set, are left
+// as they are.
+func (m *Map) assignLayerIds() {
+	var (
+		ids  = m.layerIds()
+		seen = map[int32]bool{}
+		used = m.NextLayerId != 0
+	)
+	for i := 0; i < len(ids); i++ {
+		used = used || *ids[i] != 0
+		if *ids[i] != 0 && *ids[i] >= m.NextLayerId {
+			m.NextLayerId = *ids[i] + 1
+		}
+	}
+	if !used {
+		return
+	}
+	for i := 0; i < len(ids); i++ {
+		if *ids[i] == 0 || seen[*ids[i]] {
+			*ids[i] = m.NextLayerId
+			m.NextLayerId++
+		}
+		seen[*ids[i]] = true
+	}
+}
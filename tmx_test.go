@@ -15,9 +15,16 @@
 package tmxgo
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 const TEST_MAP = `
@@ -110,6 +117,7 @@ func TestParseGid(t *testing.T) {
 		fh      bool
 		fv      bool
 		fd      bool
+		rh      bool
 		id      uint32
 		encoded string
 	)
@@ -119,26 +127,37 @@ func TestParseGid(t *testing.T) {
 		Fh    bool
 		Fv    bool
 		Fd    bool
+		Rh    bool
 	}
 	tests := []testcase{
-		testcase{"10000000000000000000000000000001", 1, true, false, false},
-		testcase{"01000000000000000000000000000011", 3, false, true, false},
-		testcase{"00100000000000000000000000000100", 4, false, false, true},
-		testcase{"10100000000000000000000000001110", 14, true, false, true},
+		testcase{"10000000000000000000000000000001", 1, true, false, false, false},
+		testcase{"01000000000000000000000000000011", 3, false, true, false, false},
+		testcase{"00100000000000000000000000000100", 4, false, false, true, false},
+		testcase{"10100000000000000000000000001110", 14, true, false, true, false},
+		testcase{"00010000000000000000000000000101", 5, false, false, false, true},
 	}
 	for i := 0; i < len(tests); i++ {
 		c := tests[i]
 		if _, err := fmt.Sscanf(c.Input, "%b", &val); err != nil {
 			t.Fatalf("Invalid Gid: %v", err)
 		}
-		id, fh, fv, fd = parseGid(val)
-		if id != c.Id || fh != c.Fh || fv != c.Fv || fd != c.Fd {
-			t.Errorf("Gid parsed wrong: %v %v %v %v %v", id, fh, fv, fd, c)
+		id, fh, fv, fd, rh = ParseGID(val)
+		if id != c.Id || fh != c.Fh || fv != c.Fv || fd != c.Fd || rh != c.Rh {
+			t.Errorf("Gid parsed wrong: %v %v %v %v %v %v", id, fh, fv, fd, rh, c)
 		}
-		encoded = fmt.Sprintf("%032b", encodeGid(id, fh, fv, fd))
+		encoded = fmt.Sprintf("%032b", EncodeGID(id, fh, fv, fd, rh))
 		if encoded != c.Input {
 			t.Errorf("Gid encoded wrong:\nGot    %v\nWanted %v", encoded, c.Input)
 		}
+		if gid := GID(val); gid.TileID() != c.Id {
+			t.Errorf("Wrong tile id: %v", gid.TileID())
+		}
+		if fh, fv, fd, rh = GID(val).Flips(); fh != c.Fh || fv != c.Fv || fd != c.Fd || rh != c.Rh {
+			t.Errorf("Wrong flips: %v %v %v %v %v", fh, fv, fd, rh, c)
+		}
+		if gid := gridTile(val).GID(); uint32(gid) != val {
+			t.Errorf("Grid tile did not round trip: %032b", gid)
+		}
 	}
 }
 
@@ -167,6 +186,48 @@ func TestLayer(t *testing.T) {
 	}
 }
 
+func TestLayerAccessors(t *testing.T) {
+	var (
+		m   *Map
+		l   AnyLayer
+		err error
+	)
+	if m, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.ImageLayers = []*ImageLayer{{Name: "sky"}}
+	if _, err = m.LayerByIndex(1); err == nil {
+		t.Errorf("Expected error for index out of bounds")
+	}
+	if g, err := m.ObjectGroupByName("spawns"); err != nil || g != m.ObjectGroups[0] {
+		t.Errorf("Object group not found: %v", err)
+	}
+	if g, err := m.ObjectGroupByIndex(0); err != nil || g != m.ObjectGroups[0] {
+		t.Errorf("Object group not found: %v", err)
+	}
+	if _, err = m.ObjectGroupByIndex(1); err == nil {
+		t.Errorf("Expected error for index out of bounds")
+	}
+	if il, err := m.ImageLayerByName("sky"); err != nil || il != m.ImageLayers[0] {
+		t.Errorf("Image layer not found: %v", err)
+	}
+	if il, err := m.ImageLayerByIndex(0); err != nil || il != m.ImageLayers[0] {
+		t.Errorf("Image layer not found: %v", err)
+	}
+	if l, err = m.AnyLayerByName("spawns"); err != nil {
+		t.Fatalf("Layer not found: %v", err)
+	}
+	if _, ok := l.(*ObjectGroup); !ok {
+		t.Errorf("Wrong layer kind: %T", l)
+	}
+	if l, err = m.AnyLayerByName("ground"); err != nil || l.(*Layer) != m.Layers[0] {
+		t.Errorf("Tile layer not found: %v", err)
+	}
+	if _, err = m.AnyLayerByName("missing"); err == nil {
+		t.Errorf("Expected error for missing layer")
+	}
+}
+
 func TestTilesFromLayer(t *testing.T) {
 	var (
 		m     *Map
@@ -411,3 +472,969 @@ func TestMapSerialize(t *testing.T) {
 		}
 	}
 }
+
+func TestNewTilesetFromImage(t *testing.T) {
+	var (
+		ts  *Tileset
+		err error
+	)
+	if ts, err = NewTilesetFromImage("sheet", 100, 50, 16, 16, 2, 1); err != nil {
+		t.Fatalf("Could not create tileset: %v", err)
+	}
+	if ts.Columns != 5 {
+		t.Errorf("Invalid columns: %v", ts.Columns)
+	}
+	if ts.TileCount != 10 {
+		t.Errorf("Invalid tilecount: %v", ts.TileCount)
+	}
+	if _, err = NewTilesetFromImage("tiny", 8, 8, 16, 16, 0, 0); err == nil {
+		t.Errorf("Expected error for image smaller than a tile")
+	}
+}
+
+func TestTileUV(t *testing.T) {
+	var (
+		ts   = &Tileset{TileWidth: 16, TileHeight: 16, Image: &Image{Width: 64, Height: 32}}
+		tile = &Tile{Tileset: ts, TextureBounds: ts.TextureBounds(5)}
+		uv   [4]Point
+	)
+	if tile.TextureBounds.X != 16 || tile.TextureBounds.Y != 0 {
+		t.Fatalf("Invalid texture bounds: %v", tile.TextureBounds)
+	}
+	uv = tile.UV(false)
+	if uv != [4]Point{{16, 16}, {32, 16}, {32, 0}, {16, 0}} {
+		t.Errorf("Invalid unflipped uv: %v", uv)
+	}
+	tile.FlipHorz = true
+	if uv = tile.UV(false); uv != [4]Point{{32, 16}, {16, 16}, {16, 0}, {32, 0}} {
+		t.Errorf("Invalid horizontally flipped uv: %v", uv)
+	}
+	tile.FlipHorz = false
+	tile.FlipDiag = true
+	if uv = tile.UV(false); uv != [4]Point{{16, 16}, {16, 0}, {32, 0}, {32, 16}} {
+		t.Errorf("Invalid diagonally flipped uv: %v", uv)
+	}
+	tile.FlipDiag = false
+	if uv = tile.UV(true); uv[1] != (Point{0.5, 0.5}) {
+		t.Errorf("Invalid normalized uv: %v", uv)
+	}
+}
+
+func TestOversizedTileBounds(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		err   error
+	)
+	if m, err = ParseMapString(TEST_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	for i := 0; i < len(tiles); i++ {
+		if tiles[i] == nil {
+			continue
+		}
+		var cell = Bounds{
+			X: float32(16 * (i % 71)),
+			Y: float32(16 * (39 - i/71)),
+		}
+		if tiles[i].TileBounds.X != cell.X || tiles[i].TileBounds.Y != cell.Y {
+			t.Errorf("Tile %v not anchored to its cell: %v", i, tiles[i].TileBounds)
+		}
+		var want = float32(tiles[i].Tileset.TileWidth)
+		if tiles[i].TileBounds.W != want || tiles[i].TileBounds.H != want {
+			t.Errorf("Tile %v has wrong size: %v", i, tiles[i].TileBounds)
+		}
+	}
+}
+
+func TestOriginTopLeft(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		err   error
+	)
+	if m, err = ParseMapString(TEST_TILES_FROM_LAYER_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.Origin = ORIGIN_TOP_LEFT
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if tiles[0].TileBounds != (Bounds{0, 0, 16, 16}) {
+		t.Errorf("Invalid top left tile bounds: %v", tiles[0].TileBounds)
+	}
+	if tiles[3].TileBounds != (Bounds{16, 16, 16, 16}) {
+		t.Errorf("Invalid top left tile bounds: %v", tiles[3].TileBounds)
+	}
+	if tiles[2].TextureBounds != (Bounds{16, 0, 16, 16}) {
+		t.Errorf("Invalid top left texture bounds: %v", tiles[2].TextureBounds)
+	}
+	if uv := tiles[2].UV(false); uv[0] != (Point{16, 0}) || uv[2] != (Point{32, 16}) {
+		t.Errorf("Invalid top left uv: %v", uv)
+	}
+	var o = &Object{X: 4, Y: 10, Width: 8, Height: 6}
+	if b := m.ObjectBounds(o); b != (Bounds{4, 10, 8, 6}) {
+		t.Errorf("Invalid top left object bounds: %v", b)
+	}
+	m.Origin = ORIGIN_BOTTOM_LEFT
+	if b := m.ObjectBounds(o); b != (Bounds{4, 16, 8, 6}) {
+		t.Errorf("Invalid bottom left object bounds: %v", b)
+	}
+}
+
+func TestTileSourceRect(t *testing.T) {
+	var (
+		ts   = &Tileset{TileWidth: 16, TileHeight: 16, Spacing: 2, Margin: 1, Image: &Image{Width: 70, Height: 52}}
+		tile = &Tile{Index: 5, Tileset: ts}
+	)
+	if r := tile.SourceRect(); r != image.Rect(37, 19, 53, 35) {
+		t.Errorf("Invalid source rect: %v", r)
+	}
+}
+
+func TestTilesContext(t *testing.T) {
+	var (
+		m           *Map
+		ctx, cancel = context.WithCancel(context.Background())
+		tiles       []*Tile
+		err         error
+	)
+	if m, err = ParseMapString(TEST_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if tiles, err = m.TilesFromLayerNameContext(ctx, "Stars"); err != nil {
+		t.Fatalf("Could not decode: %v", err)
+	}
+	if len(tiles) == 0 {
+		t.Errorf("No tiles decoded")
+	}
+	cancel()
+	if _, err = m.TilesFromLayerNameContext(ctx, "Stars"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+	if _, err = m.Layers[0].GetGridContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+}
+
+func TestParseGzipMap(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = gzip.NewWriter(&buf)
+		m   *Map
+		err error
+	)
+	w.Write([]byte(TEST_MAP))
+	w.Close()
+	if m, err = ParseMapReader(&buf); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.Width != 71 || len(m.Layers) != 2 {
+		t.Errorf("Invalid map: %v", m)
+	}
+}
+
+func TestTilesetForGid(t *testing.T) {
+	var (
+		m   *Map
+		ts  *Tileset
+		err error
+	)
+	if m, err = ParseMapString(TEST_TILES_FROM_LAYER_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if ts, err = m.TilesetByName("sprites2"); err != nil || ts != m.Tilesets[1] {
+		t.Errorf("Tileset not found by name: %v", err)
+	}
+	if ts, err = m.TilesetForGid(2147483654); err != nil || ts.Name != "sprites2" {
+		t.Errorf("Wrong tileset for flipped gid: %v %v", ts, err)
+	}
+	if ts, err = m.TilesetForGid(4); err != nil || ts.Name != "sprites1" {
+		t.Errorf("Wrong tileset: %v %v", ts, err)
+	}
+	for _, gid := range []uint32{0, 9} {
+		if _, err = m.TilesetForGid(gid); err == nil {
+			t.Errorf("Expected error for gid %v", gid)
+		}
+	}
+	if !m.Tilesets[1].ContainsGid(8) || m.Tilesets[1].ContainsGid(4) {
+		t.Errorf("Invalid gid range")
+	}
+}
+
+func TestGetTileGridBase64(t *testing.T) {
+	var (
+		m     *Map
+		grid  DataTileGrid
+		tiles []DataTile
+		err   error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var layer = m.Layers[1]
+	if grid, err = layer.GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if tiles, err = layer.Data.Tiles(); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	for i := 0; i < len(tiles); i++ {
+		var (
+			x, y = i % grid.Width, i / grid.Width
+			id   = tiles[i].Gid &^ CLEAR_FLIP
+		)
+		if grid.Tiles[x][y].Id != id {
+			t.Fatalf("Tile %v,%v was %v, expected %v", x, y, grid.Tiles[x][y].Id, id)
+		}
+	}
+	if _, err = layer.Data.GetTileGrid(10, 10); err == nil {
+		t.Errorf("Expected size mismatch error")
+	}
+}
+
+func BenchmarkGetTileGrid(b *testing.B) {
+	var (
+		m   *Map
+		err error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		b.Fatalf("Could not parse: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err = m.Layers[1].GetGrid(); err != nil {
+			b.Fatalf("Could not get grid: %v", err)
+		}
+	}
+}
+
+// Returns a base64 and zlib encoded layer of size by size tiles.
+func benchmarkLayer(b *testing.B, size int) (l *Layer) {
+	var (
+		grid = NewDataTileGrid(size, size)
+		err  error
+	)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			grid.Tiles[x][y] = gridTile(uint32(x*y%64 + 1))
+		}
+	}
+	if l, err = NewLayer("bench", grid); err != nil {
+		b.Fatalf("Could not create layer: %v", err)
+	}
+	if err = l.SetEncoding("base64", "zlib"); err != nil {
+		b.Fatalf("Could not set encoding: %v", err)
+	}
+	return
+}
+
+func BenchmarkDecodeLargeLayer(b *testing.B) {
+	var (
+		l   = benchmarkLayer(b, 1024)
+		err error
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = l.GetGrid(); err != nil {
+			b.Fatalf("Could not get grid: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncodeLargeLayer(b *testing.B) {
+	var (
+		l    = benchmarkLayer(b, 1024)
+		grid DataTileGrid
+		err  error
+	)
+	if grid, err = l.GetGrid(); err != nil {
+		b.Fatalf("Could not get grid: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = l.SetGrid(grid); err != nil {
+			b.Fatalf("Could not set grid: %v", err)
+		}
+	}
+}
+
+const TEST_TILE_RENDER_SIZE_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.9" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16">
+  <tileset firstgid="1" name="props" tilewidth="64" tileheight="64" tilecount="2" columns="0" tilerendersize="grid" fillmode="preserve-aspect-fit">
+    <tile id="0">
+      <image source="tall.png" width="32" height="64"></image>
+    </tile>
+    <tile id="1">
+      <image source="wide.png" width="64" height="32"></image>
+    </tile>
+  </tileset>
+  <layer name="Props" width="2" height="1">
+    <data>
+      <tile gid="1"></tile>
+      <tile gid="2"></tile>
+    </data>
+  </layer>
+</map>`
+
+func TestTileRenderSize(t *testing.T) {
+	var (
+		m     *Map
+		tiles []*Tile
+		out   string
+		err   error
+	)
+	if m, err = ParseMapString(TEST_TILE_RENDER_SIZE_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if b := tiles[0].TileBounds; b != (Bounds{4, 0, 8, 16}) {
+		t.Errorf("Wrong bounds for tall tile: %v", b)
+	}
+	if b := tiles[1].TileBounds; b != (Bounds{16, 4, 16, 8}) {
+		t.Errorf("Wrong bounds for wide tile: %v", b)
+	}
+	if b := tiles[1].TextureBounds; b != (Bounds{0, 0, 64, 32}) {
+		t.Errorf("Wrong texture bounds: %v", b)
+	}
+	if uv := tiles[1].UV(true); uv[2] != (Point{1, 0}) {
+		t.Errorf("Wrong normalized UV: %v", uv)
+	}
+	m.Tilesets[0].FillMode = "stretch"
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if b := tiles[0].TileBounds; b != (Bounds{0, 0, 16, 16}) {
+		t.Errorf("Wrong stretched bounds: %v", b)
+	}
+	m.Tilesets[0].TileRenderSize = "tile"
+	if tiles, err = m.TilesFromLayerIndex(0); err != nil {
+		t.Fatalf("Could not get tiles: %v", err)
+	}
+	if b := tiles[0].TileBounds; b != (Bounds{0, 0, 32, 64}) {
+		t.Errorf("Wrong tile sized bounds: %v", b)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `tilerendersize="tile" fillmode="stretch"`) {
+		t.Errorf("Attributes not serialized: %v", out)
+	}
+}
+
+const TEST_EDITOR_SETTINGS_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+  <editorsettings>
+    <chunksize width="32" height="8"></chunksize>
+    <export target="level1.json" format="json"></export>
+  </editorsettings>
+  <layer name="Ground" width="1" height="1">
+    <data>
+      <tile gid="0"></tile>
+    </data>
+  </layer>
+</map>`
+
+func TestEditorSettings(t *testing.T) {
+	var (
+		m   *Map
+		out string
+		err error
+	)
+	if m, err = ParseMapString(TEST_EDITOR_SETTINGS_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var settings = m.EditorSettings
+	if settings == nil || settings.ChunkSize == nil || settings.Export == nil {
+		t.Fatalf("Editor settings not parsed: %v", settings)
+	}
+	if settings.ChunkSize.Width != 32 || settings.ChunkSize.Height != 8 {
+		t.Errorf("Invalid chunk size: %v", settings.ChunkSize)
+	}
+	if settings.Export.Target != "level1.json" || settings.Export.Format != "json" {
+		t.Errorf("Invalid export: %v", settings.Export)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `<editorsettings>
+    <chunksize width="32" height="8"></chunksize>
+    <export target="level1.json" format="json"></export>
+  </editorsettings>`) {
+		t.Errorf("Editor settings not serialized: %v", out)
+	}
+}
+
+func TestPropertiesMap(t *testing.T) {
+	var (
+		props = Properties{
+			{Name: "speed", Value: "3", Type: "int"},
+			{Name: "name", Value: "first"},
+			{Name: "name", Value: "second"},
+		}
+		values = props.ToMap()
+	)
+	if !reflect.DeepEqual(values, map[string]string{"speed": "3", "name": "second"}) {
+		t.Errorf("Invalid map: %v", values)
+	}
+	props.FromMap(map[string]string{"b": "2", "a": "1"})
+	if !reflect.DeepEqual(props, Properties{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}) {
+		t.Errorf("Invalid properties: %v", props)
+	}
+}
+
+const TEST_LAYER_PROPERTIES_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+  <tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16">
+    <properties>
+      <property name="material" value="stone"></property>
+    </properties>
+  </tileset>
+  <layer name="Ground" width="1" height="1">
+    <properties>
+      <property name="collides" value="true" type="bool"></property>
+    </properties>
+    <data>
+      <tile gid="1"></tile>
+    </data>
+  </layer>
+</map>`
+
+func TestLayerProperties(t *testing.T) {
+	var (
+		m   *Map
+		out string
+		err error
+	)
+	if m, err = ParseMapString(TEST_LAYER_PROPERTIES_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if v := m.Tilesets[0].Properties.ToMap()["material"]; v != "stone" {
+		t.Errorf("Invalid tileset property: %v", m.Tilesets[0].Properties)
+	}
+	if v := m.Layers[0].Properties.ToMap()["collides"]; v != "true" {
+		t.Errorf("Invalid layer property: %v", m.Layers[0].Properties)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `<properties>
+      <property name="collides" value="true" type="bool"></property>
+    </properties>`) {
+		t.Errorf("Layer properties not serialized: %v", out)
+	}
+}
+
+func TestTileIndexAt(t *testing.T) {
+	var (
+		ts  *Tileset
+		err error
+	)
+	if ts, err = NewTilesetFromImage("tiles", 70, 36, 16, 16, 2, 1); err != nil {
+		t.Fatalf("Could not create tileset: %v", err)
+	}
+	for _, c := range []struct {
+		x, y  int32
+		index uint32
+		ok    bool
+	}{
+		{1, 1, 0, true},
+		{16, 16, 0, true},
+		{19, 19, 4, true},
+		{52, 34, 5, true},
+		{0, 5, 0, false},
+		{17, 5, 0, false},
+		{60, 5, 0, false},
+		{5, 70, 0, false},
+	} {
+		if index, ok := ts.TileIndexAt(c.x, c.y); index != c.index || ok != c.ok {
+			t.Errorf("Pixel %v,%v: got %v %v, expected %v %v", c.x, c.y, index, ok, c.index, c.ok)
+		}
+		if c.ok && !ts.tileRect(c.index).Bounds().Overlaps(image.Rect(int(c.x), int(c.y), int(c.x)+1, int(c.y)+1)) {
+			t.Errorf("Pixel %v,%v outside of tile %v", c.x, c.y, c.index)
+		}
+	}
+}
+
+func TestTileTransform(t *testing.T) {
+	var tile = &Tile{
+		TileBounds: Bounds{X: 32, Y: 16, W: 16, H: 8},
+		Origin:     ORIGIN_TOP_LEFT,
+	}
+	for _, c := range []struct {
+		fliph, flipv, flipd bool
+		origin              Origin
+		topLeft, topRight   Point
+	}{
+		{false, false, false, ORIGIN_TOP_LEFT, Point{32, 16}, Point{48, 16}},
+		{true, false, false, ORIGIN_TOP_LEFT, Point{48, 16}, Point{32, 16}},
+		{false, true, false, ORIGIN_TOP_LEFT, Point{32, 24}, Point{48, 24}},
+		{false, false, true, ORIGIN_TOP_LEFT, Point{32, 16}, Point{32, 24}},
+		// Rotated 90 degrees clockwise.
+		{true, false, true, ORIGIN_TOP_LEFT, Point{48, 16}, Point{48, 24}},
+		{false, false, false, ORIGIN_BOTTOM_LEFT, Point{32, 24}, Point{48, 24}},
+	} {
+		tile.FlipHorz, tile.FlipVert, tile.FlipDiag, tile.Origin = c.fliph, c.flipv, c.flipd, c.origin
+		var m = tile.Transform()
+		if p := m.Apply(Point{0, 0}); p != c.topLeft {
+			t.Errorf("Top left of %v at %v, expected %v", c, p, c.topLeft)
+		}
+		if p := m.Apply(Point{1, 0}); p != c.topRight {
+			t.Errorf("Top right of %v at %v, expected %v", c, p, c.topRight)
+		}
+	}
+}
+
+func TestLayerSetEncoding(t *testing.T) {
+	var (
+		m     *Map
+		out   string
+		tiles []DataTile
+		err   error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	var layer = m.Layers[1]
+	if tiles, err = layer.Data.Tiles(); err != nil {
+		t.Fatalf("Could not decode: %v", err)
+	}
+	if err = layer.SetEncoding("", "zlib"); err == nil {
+		t.Errorf("Expected error for compressed XML data")
+	}
+	if err = layer.SetEncoding("", ""); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, "<data>\n      <tile gid=\"0\"></tile>") {
+		t.Errorf("Layer data not written as XML: %v", out)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if m.Layers[1].Data.Encoding != "" || len(m.Layers[1].Data.RawTiles) != len(tiles) {
+		t.Fatalf("XML data not read back: %v", m.Layers[1].Data.Encoding)
+	}
+	var roundTrip []DataTile
+	if roundTrip, err = m.Layers[1].Data.Tiles(); err != nil || !reflect.DeepEqual(roundTrip, tiles) {
+		t.Errorf("Tiles changed in round trip: %v", err)
+	}
+	if err = m.Layers[1].SetEncoding("base64", "gzip"); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if roundTrip, err = m.Layers[1].Data.Tiles(); err != nil || !reflect.DeepEqual(roundTrip, tiles) {
+		t.Errorf("Tiles changed in gzip round trip: %v", err)
+	}
+	if err = m.Layers[1].SetEncoding("base64", ""); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if d := m.Layers[1].Data; d.Encoding != "base64" || d.Compression != "" || len(d.Contents()) != (4*len(tiles)+2)/3*4 {
+		t.Errorf("Layer data not written uncompressed: %v %v %v", d.Encoding, d.Compression, d.Contents())
+	}
+	if roundTrip, err = m.Layers[1].Data.Tiles(); err != nil || !reflect.DeepEqual(roundTrip, tiles) {
+		t.Errorf("Tiles changed in uncompressed round trip: %v", err)
+	}
+}
+
+func TestMapSetEncoding(t *testing.T) {
+	var (
+		m   *Map
+		out string
+		err error
+	)
+	if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.SetEncoding("base64", "lzma"); err == nil {
+		t.Errorf("Expected error for unsupported compression")
+	}
+	if err = m.SetEncoding("base64", "gzip"); err != nil {
+		t.Fatalf("Could not set encoding: %v", err)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if strings.Count(out, `compression="gzip"`) != len(m.Layers) || strings.Contains(out, "zlib") {
+		t.Errorf("Layers not written with gzip: %v", out)
+	}
+	if m, err = ParseMapString(out); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if _, err = m.Layers[0].GetGrid(); err != nil {
+		t.Errorf("Could not decode gzip data: %v", err)
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	var (
+		data = strings.Replace(TEST_MAP_ENCODED, `tileheight="16">`, `tileheight="16" compressionlevel="0">`, 1)
+		m    *Map
+		out  string
+		size int
+		bad  = int32(12)
+		err  error
+	)
+	if m, err = ParseMapString(data); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.CompressionLevel == nil || *m.CompressionLevel != 0 {
+		t.Fatalf("Compression level not read: %v", m.CompressionLevel)
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, `compressionlevel="0"`) {
+		t.Errorf("Compression level not written: %v", out)
+	}
+	size = len(m.Layers[0].Data.Contents())
+	m.CompressionLevel = nil
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if strings.Contains(out, "compressionlevel") || len(m.Layers[0].Data.Contents()) >= size {
+		t.Errorf("Default level not used: %v >= %v", len(m.Layers[0].Data.Contents()), size)
+	}
+	m.CompressionLevel = &bad
+	if _, err = m.Serialize(); err == nil {
+		t.Errorf("Expected error for invalid compression level")
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		encoding, compression string
+		attrs                 string
+	}{
+		{"", "", "<data>"},
+		{"csv", "", `<data encoding="csv">`},
+		{"base64", "", `<data encoding="base64">`},
+		{"base64", "gzip", `<data encoding="base64" compression="gzip">`},
+		{"base64", "zlib", `<data encoding="base64" compression="zlib">`},
+	} {
+		var (
+			m      *Map
+			out    string
+			tiles  []DataTile
+			parsed []DataTile
+			err    error
+		)
+		if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+			t.Fatalf("Could not parse: %v", err)
+		}
+		if tiles, err = m.Layers[0].Data.Tiles(); err != nil {
+			t.Fatalf("Could not decode: %v", err)
+		}
+		if err = m.SetEncoding(c.encoding, c.compression); err != nil {
+			t.Fatalf("Could not set encoding %v: %v", c.encoding, err)
+		}
+		if out, err = m.Serialize(); err != nil {
+			t.Fatalf("Could not serialize: %v", err)
+		}
+		// Parsing and serializing again must keep the encoding.
+		if m, err = ParseMapString(out); err != nil {
+			t.Fatalf("Could not parse serialized map: %v", err)
+		}
+		if out, err = m.Serialize(); err != nil {
+			t.Fatalf("Could not serialize: %v", err)
+		}
+		if strings.Count(out, c.attrs) != len(m.Layers) {
+			t.Errorf("Encoding %q/%q not kept: %v", c.encoding, c.compression, out)
+		}
+		if parsed, err = m.Layers[0].Data.Tiles(); err != nil || !reflect.DeepEqual(parsed, tiles) {
+			t.Errorf("Tiles changed in %q/%q round trip: %v", c.encoding, c.compression, err)
+		}
+	}
+}
+
+func TestDataGids(t *testing.T) {
+	for _, encoding := range [][2]string{{"", ""}, {"csv", ""}, {"base64", ""}, {"base64", "zlib"}} {
+		var (
+			m     *Map
+			tiles []DataTile
+			gids  []uint32
+			err   error
+		)
+		if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+			t.Fatalf("Could not parse: %v", err)
+		}
+		if err = m.SetEncoding(encoding[0], encoding[1]); err != nil {
+			t.Fatalf("Could not set encoding %v: %v", encoding, err)
+		}
+		var data = m.Layers[1].Data
+		if tiles, err = data.Tiles(); err != nil {
+			t.Fatalf("Could not decode tiles: %v", err)
+		}
+		if gids, err = data.Gids(); err != nil {
+			t.Fatalf("Could not decode gids: %v", err)
+		}
+		if len(gids) != len(tiles) {
+			t.Fatalf("Got %v gids for %v tiles with encoding %v", len(gids), len(tiles), encoding)
+		}
+		for i := 0; i < len(gids); i++ {
+			if gids[i] != tiles[i].Gid {
+				t.Fatalf("Gid %v was %v, expected %v with encoding %v", i, gids[i], tiles[i].Gid, encoding)
+			}
+		}
+	}
+}
+
+func TestDataSetGids(t *testing.T) {
+	var gids = []uint32{1, 2, 0, 3 | FLIPPED_H_FLAG, 0, 4}
+	for _, encoding := range [][2]string{{"", ""}, {"csv", ""}, {"base64", "gzip"}} {
+		var (
+			data   = &Data{Encoding: encoding[0], Compression: encoding[1]}
+			grid   DataTileGrid
+			parsed []uint32
+			err    error
+		)
+		if err = data.SetGids(3, 2, gids); err != nil {
+			t.Fatalf("Could not set gids with encoding %v: %v", encoding, err)
+		}
+		if parsed, err = data.Gids(); err != nil || !reflect.DeepEqual(parsed, gids) {
+			t.Errorf("Gids were %v with encoding %v, expected %v: %v", parsed, encoding, gids, err)
+		}
+		if grid, err = data.GetTileGrid(3, 2); err != nil || uint32(grid.Tiles[0][1].GID()) != gids[3] {
+			t.Errorf("Invalid grid with encoding %v: %v", encoding, err)
+		}
+		if err = data.SetGids(2, 2, gids); err == nil {
+			t.Errorf("Expected size mismatch error with encoding %v", encoding)
+		}
+	}
+}
+
+func TestLayerEachTile(t *testing.T) {
+	var stop = errors.New("stop")
+	for _, encoding := range [][2]string{{"", ""}, {"csv", ""}, {"base64", ""}, {"base64", "gzip"}} {
+		var (
+			m     *Map
+			grid  DataTileGrid
+			count int
+			err   error
+		)
+		if m, err = ParseMapString(TEST_MAP_ENCODED); err != nil {
+			t.Fatalf("Could not parse: %v", err)
+		}
+		if err = m.SetEncoding(encoding[0], encoding[1]); err != nil {
+			t.Fatalf("Could not set encoding %v: %v", encoding, err)
+		}
+		var layer = m.Layers[1]
+		if grid, err = layer.GetGrid(); err != nil {
+			t.Fatalf("Could not get grid: %v", err)
+		}
+		err = layer.EachTile(func(x, y int, tile DataTileGridTile) error {
+			if tile != grid.Tiles[x][y] {
+				return fmt.Errorf("Tile %v,%v was %v, expected %v", x, y, tile, grid.Tiles[x][y])
+			}
+			count++
+			return nil
+		})
+		if err != nil || count != grid.Width*grid.Height {
+			t.Errorf("Streamed %v tiles with encoding %v: %v", count, encoding, err)
+		}
+		if err = layer.EachTile(func(x, y int, tile DataTileGridTile) error { return stop }); err != stop {
+			t.Errorf("Expected iteration to stop with encoding %v, got %v", encoding, err)
+		}
+		layer.Height--
+		if err = layer.EachTile(func(x, y int, tile DataTileGridTile) error { return nil }); err == nil {
+			t.Errorf("Expected size mismatch error with encoding %v", encoding)
+		}
+		layer.Height += 2
+		if err = layer.EachTile(func(x, y int, tile DataTileGridTile) error { return nil }); err == nil {
+			t.Errorf("Expected size mismatch error with encoding %v", encoding)
+		}
+	}
+}
+
+const TEST_IMAGE_LAYER_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="4" height="4" tilewidth="16" tileheight="16">
+ <imagelayer name="old" x="8" y="4" width="4" height="4">
+  <image source="sky.png"/>
+ </imagelayer>
+ <imagelayer name="new" offsetx="2.5" offsety="-3">
+  <image source="sky.png" width="20" height="10"/>
+ </imagelayer>
+</map>
+`
+
+func TestImageLayerPixelBounds(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx": &fstest.MapFile{Data: []byte(TEST_IMAGE_LAYER_MAP)},
+			"sky.png":   &fstest.MapFile{Data: testStripPNG(t, 3)},
+		})
+		m   *Map
+		b   Bounds
+		err error
+	)
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = m.ImageLayers[0].PixelBounds(m); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{8, 4, 48, 16}) {
+		t.Errorf("Wrong bounds from image file: %v", b)
+	}
+	if b, err = m.ImageLayers[1].PixelBounds(m); err != nil {
+		t.Fatalf("Could not get bounds: %v", err)
+	}
+	if b != (Bounds{2.5, -3, 20, 10}) {
+		t.Errorf("Wrong bounds from attributes: %v", b)
+	}
+	m.ImageLayers[0].Image = nil
+	if _, err = m.ImageLayers[0].PixelBounds(m); err == nil {
+		t.Errorf("Expected error for image layer without image")
+	}
+}
+
+const TEST_LAYER_ID_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.2" orientation="orthogonal" width="2" height="1" tilewidth="16" tileheight="16" nextlayerid="5">
+ <layer id="4" name="ground" width="2" height="1">
+  <data encoding="csv">1,2</data>
+ </layer>
+ <objectgroup id="2" name="actors"/>
+</map>
+`
+
+func TestLayerIds(t *testing.T) {
+	var (
+		m          *Map
+		l          *Layer
+		dup        Layer
+		serialized string
+		err        error
+	)
+	if m, err = ParseMapString(TEST_LAYER_ID_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.NextLayerId != 5 || m.Layers[0].Id != 4 || m.ObjectGroups[0].Id != 2 {
+		t.Fatalf("Wrong ids: next %v, layer %v, group %v", m.NextLayerId, m.Layers[0].Id, m.ObjectGroups[0].Id)
+	}
+	if l, err = NewLayer("copy", NewDataTileGrid(2, 1)); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	dup = *m.Layers[0]
+	m.Layers = append(m.Layers, l, &dup)
+	m.ImageLayers = append(m.ImageLayers, &ImageLayer{Name: "sky"})
+	if serialized, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if m, err = ParseMapString(serialized); err != nil {
+		t.Fatalf("Could not parse serialized map: %v", err)
+	}
+	if m.Layers[0].Id != 4 || m.ObjectGroups[0].Id != 2 {
+		t.Errorf("Existing ids not preserved: layer %v, group %v", m.Layers[0].Id, m.ObjectGroups[0].Id)
+	}
+	if m.Layers[1].Id != 5 || m.Layers[2].Id != 6 || m.ImageLayers[0].Id != 7 {
+		t.Errorf("Wrong assigned ids: %v, %v, %v", m.Layers[1].Id, m.Layers[2].Id, m.ImageLayers[0].Id)
+	}
+	if m.NextLayerId != 8 {
+		t.Errorf("Wrong next layer id: %v", m.NextLayerId)
+	}
+	if m, err = ParseMapString(TEST_TILES_FROM_LAYER_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if serialized, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if strings.Contains(serialized, "nextlayerid") || strings.Contains(serialized, " id=") {
+		t.Errorf("Ids added to map without layer ids: %v", serialized)
+	}
+}
+
+func TestCsvGidRange(t *testing.T) {
+	var (
+		cases = map[string]string{
+			"1,-1":         "Negative gid -1 for tile 1",
+			"4294967296,1": "Gid 4294967296 for tile 0 exceeds 32 bits",
+			"1,x":          "Invalid gid \"x\" for tile 1",
+		}
+		gids []uint32
+		err  error
+	)
+	for contents, expected := range cases {
+		var d = &Data{Encoding: "csv", RawContents: contents}
+		if _, err = d.Gids(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Wrong error for %v: %v", contents, err)
+		}
+		if err = d.streamGids(context.Background(), func(i int, gid uint32) error { return nil }); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Wrong streaming error for %v: %v", contents, err)
+		}
+	}
+	var d = &Data{Encoding: "csv", RawContents: "4294967295,2147483649"}
+	if gids, err = d.Gids(); err != nil {
+		t.Fatalf("Could not parse flipped gids: %v", err)
+	}
+	if gids[0] != 4294967295 || gids[1] != 2147483649 {
+		t.Errorf("Wrong gids: %v", gids)
+	}
+}
+
+const TEST_PARALLAX_MAP = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.8" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16" parallaxoriginx="100" parallaxoriginy="50">
+ <layer name="far" width="1" height="1" offsetx="4" parallaxx="0.5" parallaxy="0">
+  <data encoding="csv">0</data>
+ </layer>
+ <imagelayer name="sky" parallaxy="0.25">
+  <image source="sky.png" width="16" height="16"/>
+ </imagelayer>
+</map>
+`
+
+func TestParallax(t *testing.T) {
+	var (
+		m          *Map
+		x, y       float32
+		serialized string
+		err        error
+	)
+	if m, err = ParseMapString(TEST_PARALLAX_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if m.ParallaxOriginX != 100 || m.ParallaxOriginY != 50 {
+		t.Errorf("Wrong parallax origin: %v,%v", m.ParallaxOriginX, m.ParallaxOriginY)
+	}
+	if l := m.Layers[0]; l.ParallaxX != 0.5 || l.ParallaxY != 0 {
+		t.Errorf("Wrong layer parallax: %v,%v", l.ParallaxX, l.ParallaxY)
+	}
+	if l := m.ImageLayers[0]; l.ParallaxX != 1 || l.ParallaxY != 0.25 {
+		t.Errorf("Wrong image layer parallax: %v,%v", l.ParallaxX, l.ParallaxY)
+	}
+	if x, y = m.ParallaxOffset(m.Layers[0], 300, 150); x != 104 || y != 100 {
+		t.Errorf("Wrong layer offset: %v,%v", x, y)
+	}
+	if x, y = m.ParallaxOffset(m.ImageLayers[0], 100, 50); x != 0 || y != 0 {
+		t.Errorf("Wrong offset at parallax origin: %v,%v", x, y)
+	}
+	if serialized, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	for _, attr := range []string{`parallaxoriginx="100"`, `parallaxx="0.5" parallaxy="0"`, `visible="false" parallaxy="0.25">`} {
+		if !strings.Contains(serialized, attr) {
+			t.Errorf("Missing %v in %v", attr, serialized)
+		}
+	}
+	m.ImageLayers = []*ImageLayer{NewImageLayer("new", &Image{Source: "new.png"})}
+	if serialized, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(serialized, `name="new" width="0" height="0" opacity="1" visible="true">`) {
+		t.Errorf("Default parallax written for new image layer: %v", serialized)
+	}
+}
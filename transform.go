@@ -0,0 +1,1180 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type Axis int
+
+const (
+	HORIZONTAL Axis = iota
+	VERTICAL
+)
+
+// Joins b onto the right (HORIZONTAL) or bottom (VERTICAL) edge of a,
+// returning a new map. Both maps must share orientation and tile size,
+// and have the same height (HORIZONTAL) or width (VERTICAL).
+//
+// Tilesets of b which also appear in a (same name, source and image)
+// are shared, the others are appended after the tilesets of a and the
+// tiles of b are renumbered accordingly. Layers and object groups are
+// matched by name, missing ones are treated as empty. Objects of b are
+// offset by the pixel size of a, as are the image layers of b, and the
+// object ids of b are moved past those of a. Map properties are taken
+// from a. External tilesets must have been loaded with
+// EmbedExternalTilesets.
+func ConcatMaps(a, b *Map, axis Axis) (m *Map, err error) {
+	var (
+		remap   func(gid uint32) uint32
+		offsetX int32
+		offsetY int32
+		grid    DataTileGrid
+		layer   *Layer
+	)
+	if a.TileWidth != b.TileWidth || a.TileHeight != b.TileHeight {
+		err = fmt.Errorf("Tile sizes %vx%v and %vx%v differ",
+			a.TileWidth, a.TileHeight, b.TileWidth, b.TileHeight)
+		return
+	}
+	if a.Orientation != b.Orientation {
+		err = fmt.Errorf("Orientations %v and %v differ", a.Orientation, b.Orientation)
+		return
+	}
+	m = &Map{
+		Version:         a.Version,
+		Orientation:     a.Orientation,
+		Width:           a.Width,
+		Height:          a.Height,
+		TileWidth:       a.TileWidth,
+		TileHeight:      a.TileHeight,
+		HexSideLength:   a.HexSideLength,
+		StaggerAxis:     a.StaggerAxis,
+		StaggerIndex:    a.StaggerIndex,
+		BackgroundColor: a.BackgroundColor,
+		Properties:      a.Properties,
+		BaseDir:         a.BaseDir,
+		Loader:          a.Loader,
+	}
+	switch axis {
+	case HORIZONTAL:
+		if a.Height != b.Height {
+			err = fmt.Errorf("Map heights %v and %v differ", a.Height, b.Height)
+			return
+		}
+		m.Width = a.Width + b.Width
+		offsetX = a.Width * a.TileWidth
+	case VERTICAL:
+		if a.Width != b.Width {
+			err = fmt.Errorf("Map widths %v and %v differ", a.Width, b.Width)
+			return
+		}
+		m.Height = a.Height + b.Height
+		offsetY = a.Height * a.TileHeight
+	default:
+		err = fmt.Errorf("Invalid axis %v", axis)
+		return
+	}
+	if m.Tilesets, remap, err = mergeTilesets(a.Tilesets, b.Tilesets); err != nil {
+		return
+	}
+	for _, name := range layerNames(a, b) {
+		if grid, err = concatLayerGrids(a, b, name, axis, remap); err != nil {
+			return
+		}
+		if layer, err = NewLayer(name, grid); err != nil {
+			return
+		}
+		if src, e := a.LayerByName(name); e == nil {
+			layer.Opacity, layer.Visible, layer.Properties = src.Opacity, src.Visible, src.Properties
+		} else if src, e := b.LayerByName(name); e == nil {
+			layer.Opacity, layer.Visible, layer.Properties = src.Opacity, src.Visible, src.Properties
+		}
+		m.Layers = append(m.Layers, layer)
+	}
+	m.ObjectGroups, m.NextObjectId = concatObjectGroups(a.ObjectGroups, b.ObjectGroups,
+		offsetX, offsetY, remap, a.nextObjectId(), b.nextObjectId())
+	m.ImageLayers = concatImageLayers(a.ImageLayers, b.ImageLayers, float32(offsetX), float32(offsetY))
+	return
+}
+
+// A map placed within a larger one, at a position given in tiles.
+type MapPart struct {
+	Map  *Map
+	X, Y int32
+}
+
+// Combines the parts into one map covering all of them, such as the maps
+// of a Tiled world. Parts may be placed at negative positions, the result
+// starts at the top left corner of the topmost and leftmost parts. All
+// parts must share orientation and tile size. Tilesets, layers and
+// object groups are merged as by ConcatMaps, in the order of parts.
+// Where parts overlap, the tiles of later parts replace those of earlier
+// ones unless empty. Map properties are taken from the first part.
+func StitchMaps(parts []MapPart) (m *Map, err error) {
+	var (
+		first        *Map
+		minX, minY   int
+		maxX, maxY   int
+		names        []string
+		grids        = map[string]DataTileGrid{}
+		layers       = map[string]*Layer{}
+		remap        func(gid uint32) uint32
+		grid, placed DataTileGrid
+		layer        *Layer
+	)
+	if len(parts) == 0 {
+		err = fmt.Errorf("No maps to stitch")
+		return
+	}
+	first = parts[0].Map
+	minX, minY = int(parts[0].X), int(parts[0].Y)
+	maxX, maxY = minX+int(first.Width), minY+int(first.Height)
+	for i := 1; i < len(parts); i++ {
+		var p = parts[i]
+		if p.Map.TileWidth != first.TileWidth || p.Map.TileHeight != first.TileHeight {
+			err = fmt.Errorf("Tile sizes %vx%v and %vx%v differ",
+				first.TileWidth, first.TileHeight, p.Map.TileWidth, p.Map.TileHeight)
+			return
+		}
+		if p.Map.Orientation != first.Orientation {
+			err = fmt.Errorf("Orientations %v and %v differ", first.Orientation, p.Map.Orientation)
+			return
+		}
+		minX, minY = minInt(minX, int(p.X)), minInt(minY, int(p.Y))
+		maxX, maxY = maxInt(maxX, int(p.X+p.Map.Width)), maxInt(maxY, int(p.Y+p.Map.Height))
+	}
+	m = &Map{
+		Version:         first.Version,
+		Orientation:     first.Orientation,
+		Width:           int32(maxX - minX),
+		Height:          int32(maxY - minY),
+		TileWidth:       first.TileWidth,
+		TileHeight:      first.TileHeight,
+		HexSideLength:   first.HexSideLength,
+		StaggerAxis:     first.StaggerAxis,
+		StaggerIndex:    first.StaggerIndex,
+		BackgroundColor: first.BackgroundColor,
+		Properties:      first.Properties,
+		BaseDir:         first.BaseDir,
+		Loader:          first.Loader,
+	}
+	for i := 0; i < len(parts); i++ {
+		var (
+			p      = parts[i]
+			dx, dy = int(p.X) - minX, int(p.Y) - minY
+			px, py = int32(dx) * m.TileWidth, int32(dy) * m.TileHeight
+		)
+		if m.Tilesets, remap, err = mergeTilesets(m.Tilesets, p.Map.Tilesets); err != nil {
+			return
+		}
+		for j := 0; j < len(p.Map.Layers); j++ {
+			var src = p.Map.Layers[j]
+			if placed, err = layerGrid(p.Map, src); err != nil {
+				return
+			}
+			if _, ok := grids[src.Name]; !ok {
+				names = append(names, src.Name)
+				grids[src.Name] = NewDataTileGrid(int(m.Width), int(m.Height))
+				layers[src.Name] = src
+			}
+			grid = grids[src.Name]
+			for x := 0; x < placed.Width; x++ {
+				for y := 0; y < placed.Height; y++ {
+					if t := placed.Tiles[x][y]; t.Id != 0 {
+						t.Id = remap(t.Id)
+						grid.Tiles[x+dx][y+dy] = t
+					}
+				}
+			}
+		}
+		m.ObjectGroups, m.NextObjectId = concatObjectGroups(m.ObjectGroups, p.Map.ObjectGroups,
+			px, py, remap, m.NextObjectId, p.Map.nextObjectId())
+		m.ImageLayers = concatImageLayers(m.ImageLayers, p.Map.ImageLayers, float32(px), float32(py))
+	}
+	for i := 0; i < len(names); i++ {
+		var src = layers[names[i]]
+		if layer, err = NewLayer(names[i], grids[names[i]]); err != nil {
+			return
+		}
+		layer.Opacity, layer.Visible, layer.Properties = src.Opacity, src.Visible, src.Properties
+		m.Layers = append(m.Layers, layer)
+	}
+	return
+}
+
+// Returns the tilesets of a followed by those of b which a lacks, and
+// a function translating gids of b into gids of the merged tilesets.
+// External tilesets must have been loaded, as by EmbedExternalTilesets,
+// since the number of gids they take is unknown otherwise.
+func mergeTilesets(a, b []*Tileset) (merged []*Tileset, remap func(gid uint32) uint32, err error) {
+	var (
+		next    = uint32(1)
+		targets = map[*Tileset]*Tileset{}
+	)
+	if err = checkTilesetsLoaded(a); err != nil {
+		return
+	}
+	if err = checkTilesetsLoaded(b); err != nil {
+		return
+	}
+	merged = append([]*Tileset{}, a...)
+	sort.Sort(byFirstGid(merged))
+	for i := 0; i < len(merged); i++ {
+		if end := merged[i].FirstGid + merged[i].numTiles(); end > next {
+			next = end
+		}
+	}
+	for i := 0; i < len(b); i++ {
+		for j := 0; j < len(a); j++ {
+			if sameTileset(a[j], b[i]) {
+				targets[b[i]] = a[j]
+				break
+			}
+		}
+		if targets[b[i]] == nil {
+			var ts = *b[i]
+			ts.FirstGid = next
+			next += ts.numTiles()
+			merged = append(merged, &ts)
+			targets[b[i]] = &ts
+		}
+	}
+	var sorted = append([]*Tileset{}, b...)
+	sort.Sort(byFirstGid(sorted))
+	remap = func(gid uint32) uint32 {
+		if gid&^CLEAR_FLIP == 0 || len(sorted) == 0 {
+			return gid
+		}
+		var (
+			flags = gid & CLEAR_FLIP
+			id    = gid &^ CLEAR_FLIP
+			src   = tilesetForGid(sorted, id)
+		)
+		return (id - src.FirstGid + targets[src].FirstGid) | flags
+	}
+	return
+}
+
+func sameTileset(a, b *Tileset) bool {
+	if a.Name != b.Name || a.Source != b.Source {
+		return false
+	}
+	if a.Image == nil || b.Image == nil {
+		return a.Image == b.Image
+	}
+	return a.Image.Source == b.Image.Source
+}
+
+// Returns an error for the first tileset of ts stored in an external
+// file whose tiles were not loaded, so its number of tiles is unknown.
+func checkTilesetsLoaded(ts []*Tileset) error {
+	for i := 0; i < len(ts); i++ {
+		if ts[i].Source != "" && ts[i].numTiles() == 0 {
+			return fmt.Errorf("External tileset %v was not loaded", ts[i].Source)
+		}
+	}
+	return nil
+}
+
+// Returns the names of the layers of a, followed by those only in b.
+func layerNames(a, b *Map) (names []string) {
+	var seen = map[string]bool{}
+	for _, m := range []*Map{a, b} {
+		for i := 0; i < len(m.Layers); i++ {
+			if !seen[m.Layers[i].Name] {
+				seen[m.Layers[i].Name] = true
+				names = append(names, m.Layers[i].Name)
+			}
+		}
+	}
+	return
+}
+
+// Returns the grid of the named layer of m, or an empty grid
+// of the map's size if m has no such layer.
+func mapLayerGrid(m *Map, name string) (grid DataTileGrid, err error) {
+	var layer *Layer
+	if layer, err = m.LayerByName(name); err != nil {
+		return NewDataTileGrid(int(m.Width), int(m.Height)), nil
+	}
+	return layerGrid(m, layer)
+}
+
+// Returns the grid of layer, a layer of m, which must be the size of m.
+// Layers are passed directly rather than by name, as Tiled allows layers
+// to share a name.
+func layerGrid(m *Map, layer *Layer) (grid DataTileGrid, err error) {
+	if layer.Width != m.Width || layer.Height != m.Height {
+		err = m.layerError(layer, fmt.Errorf("Size differs from map size"))
+		return
+	}
+	if grid, err = layer.GetGrid(); err != nil {
+		err = m.layerError(layer, err)
+	}
+	return
+}
+
+func concatLayerGrids(a, b *Map, name string, axis Axis, remap func(uint32) uint32) (grid DataTileGrid, err error) {
+	var (
+		ga, gb DataTileGrid
+		dx, dy int
+	)
+	if ga, err = mapLayerGrid(a, name); err != nil {
+		return
+	}
+	if gb, err = mapLayerGrid(b, name); err != nil {
+		return
+	}
+	if axis == HORIZONTAL {
+		grid = NewDataTileGrid(ga.Width+gb.Width, ga.Height)
+		dx = ga.Width
+	} else {
+		grid = NewDataTileGrid(ga.Width, ga.Height+gb.Height)
+		dy = ga.Height
+	}
+	for x := 0; x < ga.Width; x++ {
+		copy(grid.Tiles[x], ga.Tiles[x])
+	}
+	for x := 0; x < gb.Width; x++ {
+		for y := 0; y < gb.Height; y++ {
+			var t = gb.Tiles[x][y]
+			if t.Id != 0 {
+				t.Id = remap(t.Id)
+			}
+			grid.Tiles[x+dx][y+dy] = t
+		}
+	}
+	return
+}
+
+// Returns copies of the image layers of a followed by those of b, with
+// the layers of b offset by dx, dy pixels.
+func concatImageLayers(a, b []*ImageLayer, dx, dy float32) (layers []*ImageLayer) {
+	for i := 0; i < len(a); i++ {
+		var l = *a[i]
+		layers = append(layers, &l)
+	}
+	for i := 0; i < len(b); i++ {
+		var l = *b[i]
+		l.OffsetX += dx
+		l.OffsetY += dy
+		layers = append(layers, &l)
+	}
+	return
+}
+
+// Returns copies of the object groups of a, joined by name with those
+// of b, whose objects are offset by dx, dy pixels and have their gids
+// remapped. The object ids of b, and object properties referring to
+// them, are moved past nextA, the next object id of a. Returns the next
+// object id of the result given nextB, the next object id of b.
+func concatObjectGroups(a, b []*ObjectGroup, dx, dy int32, remap func(uint32) uint32, nextA, nextB int32) (groups []*ObjectGroup, next int32) {
+	var (
+		byName = map[string]*ObjectGroup{}
+		base   = maxInt32(nextA-1, 0)
+	)
+	next = maxInt32(nextA, base+nextB)
+	for i := 0; i < len(a); i++ {
+		var g = *a[i]
+		g.Objects = append([]Object{}, a[i].Objects...)
+		byName[g.Name] = &g
+		groups = append(groups, &g)
+	}
+	for i := 0; i < len(b); i++ {
+		var g = byName[b[i].Name]
+		if g == nil {
+			var copied = *b[i]
+			copied.Objects = nil
+			g = &copied
+			byName[g.Name] = g
+			groups = append(groups, g)
+		}
+		for j := 0; j < len(b[i].Objects); j++ {
+			var o = b[i].Objects[j]
+			o.X += dx
+			o.Y += dy
+			if o.Gid != nil {
+				var gid = remap(*o.Gid)
+				o.Gid = &gid
+			}
+			if o.Id != 0 {
+				o.Id += base
+			}
+			o.Properties = shiftObjectRefs(o.Properties, base)
+			g.Objects = append(g.Objects, o)
+		}
+	}
+	return
+}
+
+// Returns a copy of props with the ids held by properties of type
+// "object" increased by base.
+func shiftObjectRefs(props Properties, base int32) (shifted Properties) {
+	if base == 0 || len(props) == 0 {
+		return props
+	}
+	shifted = append(Properties{}, props...)
+	for i := 0; i < len(shifted); i++ {
+		if shifted[i].Type != "object" {
+			continue
+		}
+		if id, err := strconv.ParseInt(shifted[i].Value, 10, 32); err == nil && id != 0 {
+			shifted[i].Value = strconv.FormatInt(id+int64(base), 10)
+		}
+	}
+	return
+}
+
+// Returns the next free object id of the map, past NextObjectId and
+// the ids of all its objects, or 0 if the map uses no object ids.
+func (m *Map) nextObjectId() (next int32) {
+	next = m.NextObjectId
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = m.ObjectGroups[i]
+		for j := 0; j < len(g.Objects); j++ {
+			if g.Objects[j].Id >= next {
+				next = g.Objects[j].Id + 1
+			}
+		}
+	}
+	return
+}
+
+// Multiplies the tile size of the map and its tilesets by factor and
+// scales object positions, sizes and shapes to match, so the map keeps
+// its layout when targeting art at a different resolution.
+// Tileset spacing, margin and image sizes are scaled along with the tiles.
+func (m *Map) ScaleTiles(factor float32) (err error) {
+	var scale = func(v int32) int32 {
+		return int32(math.Floor(float64(v)*float64(factor) + 0.5))
+	}
+	if factor <= 0 {
+		err = fmt.Errorf("Invalid scale factor %v", factor)
+		return
+	}
+	m.TileWidth = scale(m.TileWidth)
+	m.TileHeight = scale(m.TileHeight)
+	for i := 0; i < len(m.Tilesets); i++ {
+		var ts = m.Tilesets[i]
+		ts.TileWidth = scale(ts.TileWidth)
+		ts.TileHeight = scale(ts.TileHeight)
+		ts.Spacing = scale(ts.Spacing)
+		ts.Margin = scale(ts.Margin)
+		if ts.Image != nil {
+			ts.Image.Width = scale(ts.Image.Width)
+			ts.Image.Height = scale(ts.Image.Height)
+		}
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		for j := 0; j < len(m.ObjectGroups[i].Objects); j++ {
+			var o = &m.ObjectGroups[i].Objects[j]
+			o.X = scale(o.X)
+			o.Y = scale(o.Y)
+			o.Width = scale(o.Width)
+			o.Height = scale(o.Height)
+			if o.Polygon != nil {
+				if err = scalePoints(o.Polygon, factor); err != nil {
+					return
+				}
+			}
+			if o.Polyline != nil {
+				if err = scalePoints(o.Polyline, factor); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// Shrinks an orthogonal map to the smallest rectangle of tiles containing
+// every set tile of its layers and the bounds of every object, moving
+// tiles, objects and image layers so they keep their place relative to
+// each other.
+// Returns the kept rectangle in tiles of the original map. Maps without
+// any content are left unchanged.
+func (m *Map) Trim() (crop image.Rectangle, err error) {
+	var (
+		bounds image.Rectangle
+		grid   DataTileGrid
+		tw, th = float64(m.TileWidth), float64(m.TileHeight)
+		found  bool
+		extend = func(r image.Rectangle) {
+			if !found {
+				crop = r
+			} else {
+				crop = crop.Union(r)
+			}
+			found = true
+		}
+	)
+	if m.Orientation != "orthogonal" && m.Orientation != "" {
+		err = fmt.Errorf("Trimming %v maps is not supported", m.Orientation)
+		return
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		if bounds, err = m.Layers[i].OccupiedBounds(); err != nil {
+			err = m.layerError(m.Layers[i], err)
+			return
+		}
+		if !bounds.Empty() {
+			extend(bounds)
+		}
+	}
+	if err = m.EachObject(func(g *ObjectGroup, o *Object) (err error) {
+		var b Bounds
+		if b, err = o.MapBounds(); err != nil {
+			return
+		}
+		extend(image.Rect(
+			int(math.Floor(float64(b.X)/tw)),
+			int(math.Floor(float64(b.Y)/th)),
+			int(math.Ceil(float64(b.X+b.W)/tw)),
+			int(math.Ceil(float64(b.Y+b.H)/th))))
+		return
+	}); err != nil {
+		return
+	}
+	crop = crop.Intersect(image.Rect(0, 0, int(m.Width), int(m.Height)))
+	if !found || crop.Empty() {
+		crop = image.Rect(0, 0, int(m.Width), int(m.Height))
+		return
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			l       = m.Layers[i]
+			trimmed = NewDataTileGrid(crop.Dx(), crop.Dy())
+		)
+		if grid, err = l.GetGrid(); err != nil {
+			err = m.layerError(l, err)
+			return
+		}
+		if grid.Width < crop.Max.X || grid.Height < crop.Max.Y {
+			err = m.layerError(l, fmt.Errorf("Size differs from map size"))
+			return
+		}
+		for x := 0; x < trimmed.Width; x++ {
+			copy(trimmed.Tiles[x], grid.Tiles[crop.Min.X+x][crop.Min.Y:])
+		}
+		if err = l.SetGrid(trimmed); err != nil {
+			err = m.layerError(l, err)
+			return
+		}
+		l.Width = int32(crop.Dx())
+		l.Height = int32(crop.Dy())
+	}
+	var dx, dy = int32(crop.Min.X) * m.TileWidth, int32(crop.Min.Y) * m.TileHeight
+	m.EachObject(func(g *ObjectGroup, o *Object) error {
+		o.X -= dx
+		o.Y -= dy
+		return nil
+	})
+	for i := 0; i < len(m.ImageLayers); i++ {
+		m.ImageLayers[i].OffsetX -= float32(dx)
+		m.ImageLayers[i].OffsetY -= float32(dy)
+	}
+	m.Width = int32(crop.Dx())
+	m.Height = int32(crop.Dy())
+	return
+}
+
+type pointList interface {
+	Points() ([]Point, error)
+	SetPoints(points []Point)
+}
+
+func scalePoints(p pointList, factor float32) (err error) {
+	var points []Point
+	if points, err = p.Points(); err != nil {
+		return
+	}
+	for i := 0; i < len(points); i++ {
+		points[i].X *= factor
+		points[i].Y *= factor
+	}
+	p.SetPoints(points)
+	return
+}
+
+// Repeats every tile of the layer n x n times, multiplying the layer
+// width and height by n. The map size is left for the caller to adjust.
+func (l *Layer) Upsample(n int) (err error) {
+	var grid, scaled DataTileGrid
+	if n < 1 {
+		err = fmt.Errorf("Invalid upsample factor %v", n)
+		return
+	}
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	scaled = NewDataTileGrid(grid.Width*n, grid.Height*n)
+	for x := 0; x < scaled.Width; x++ {
+		for y := 0; y < scaled.Height; y++ {
+			scaled.Tiles[x][y] = grid.Tiles[x/n][y/n]
+		}
+	}
+	if err = l.SetGrid(scaled); err != nil {
+		return
+	}
+	l.Width = int32(scaled.Width)
+	l.Height = int32(scaled.Height)
+	return
+}
+
+// Selects the tile of a re-gridded cell from the source tiles covering it.
+type RegridRule int
+
+const (
+	// The tile covering the largest area of the cell, including empty tiles.
+	REGRID_MAJORITY RegridRule = iota
+
+	// The non-empty tile covering the largest area of the cell, so a cell
+	// touched by any tile is filled.
+	REGRID_ANY
+
+	// The non-empty tile covering the largest area of the cell if the
+	// cell is covered by non-empty tiles entirely, otherwise empty.
+	REGRID_ALL
+)
+
+// Returns a copy of the layer re-gridded from tiles of fromW x fromH
+// pixels to tiles of toW x toH pixels covering the same area, rounded up
+// to whole cells. Each new cell is picked from the source tiles overlapping
+// it according to rule. Ties are broken in favor of the topmost, leftmost tile.
+func (l *Layer) Regrid(fromW, fromH, toW, toH int32, rule RegridRule) (out *Layer, err error) {
+	var (
+		src, dst DataTileGrid
+		pxW, pxH int
+	)
+	if fromW <= 0 || fromH <= 0 || toW <= 0 || toH <= 0 {
+		err = fmt.Errorf("Invalid tile sizes %vx%v to %vx%v", fromW, fromH, toW, toH)
+		return
+	}
+	if src, err = l.GetGrid(); err != nil {
+		return
+	}
+	pxW, pxH = src.Width*int(fromW), src.Height*int(fromH)
+	dst = NewDataTileGrid((pxW+int(toW)-1)/int(toW), (pxH+int(toH)-1)/int(toH))
+	for x := 0; x < dst.Width; x++ {
+		for y := 0; y < dst.Height; y++ {
+			var (
+				x0, y0 = x * int(toW), y * int(toH)
+				x1, y1 = minInt(x0+int(toW), pxW), minInt(y0+int(toH), pxH)
+				areas  = map[DataTileGridTile]int{}
+				order  = []DataTileGridTile{}
+				empty  = 0
+			)
+			for sy := y0 / int(fromH); sy*int(fromH) < y1; sy++ {
+				for sx := x0 / int(fromW); sx*int(fromW) < x1; sx++ {
+					var (
+						t    = src.Tiles[sx][sy]
+						area = (minInt((sx+1)*int(fromW), x1) - maxInt(sx*int(fromW), x0)) *
+							(minInt((sy+1)*int(fromH), y1) - maxInt(sy*int(fromH), y0))
+					)
+					if t.Id == 0 {
+						empty += area
+						continue
+					}
+					if _, ok := areas[t]; !ok {
+						order = append(order, t)
+					}
+					areas[t] += area
+				}
+			}
+			var best DataTileGridTile
+			for i := 0; i < len(order); i++ {
+				if best.Id == 0 || areas[order[i]] > areas[best] {
+					best = order[i]
+				}
+			}
+			switch rule {
+			case REGRID_MAJORITY:
+				if empty > areas[best] {
+					best = DataTileGridTile{}
+				}
+			case REGRID_ALL:
+				if empty > 0 {
+					best = DataTileGridTile{}
+				}
+			}
+			dst.Tiles[x][y] = best
+		}
+	}
+	if out, err = NewLayer(l.Name, dst); err != nil {
+		return
+	}
+	out.Opacity, out.Visible, out.Properties = l.Opacity, l.Visible, l.Properties
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxInt32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Moves the content of an orthogonal map by dx tiles to the right and dy
+// tiles down. Tiles moved past the edges of the map are dropped and the
+// cells they leave are emptied. Objects and image layers move by the same
+// distance in pixels, objects outside the map are kept.
+func (m *Map) Translate(dx, dy int32) (err error) {
+	var px, py = dx * m.TileWidth, dy * m.TileHeight
+	if err = m.checkOrthogonal("Translating"); err != nil {
+		return
+	}
+	if err = m.transformGrids(int(m.Width), int(m.Height), func(x, y int) (int, int) {
+		return x - int(dx), y - int(dy)
+	}, nil); err != nil {
+		return
+	}
+	m.EachObject(func(g *ObjectGroup, o *Object) error {
+		o.X += px
+		o.Y += py
+		return nil
+	})
+	for i := 0; i < len(m.ImageLayers); i++ {
+		m.ImageLayers[i].OffsetX += float32(px)
+		m.ImageLayers[i].OffsetY += float32(py)
+	}
+	return
+}
+
+// Rotates an orthogonal map with square tiles by 90 degrees clockwise,
+// swapping its width and height. Tiles are moved and have their flip
+// flags adjusted so they appear rotated, as with Tiled's "Rotate Right".
+// Polygons and polylines have their points rotated, other objects have
+// 90 degrees added to their rotation. Layer offsets are rotated too.
+//
+// Image layers cannot be rotated in TMX, so their images are moved to
+// be centered on the rotated position of their previous center instead.
+func (m *Map) Rotate90() (err error) {
+	var (
+		oldH = int(m.Height)
+		ph   = float32(m.Height * m.TileHeight)
+	)
+	if err = m.checkOrthogonal("Rotating"); err != nil {
+		return
+	}
+	if m.TileWidth != m.TileHeight {
+		err = fmt.Errorf("Rotating maps with tiles of %vx%v pixels is not supported",
+			m.TileWidth, m.TileHeight)
+		return
+	}
+	if err = m.transformGrids(oldH, int(m.Width), func(x, y int) (int, int) {
+		return y, oldH - 1 - x
+	}, rotateTileRight); err != nil {
+		return
+	}
+	if err = m.EachObject(func(g *ObjectGroup, o *Object) (err error) {
+		o.X, o.Y = int32(ph)-o.Y, o.X
+		var rotated = func(p Point) Point { return Point{-p.Y, p.X} }
+		switch {
+		case o.Polygon != nil:
+			err = transformPoints(o.Polygon, rotated)
+		case o.Polyline != nil:
+			err = transformPoints(o.Polyline, rotated)
+		default:
+			o.Rotation = (o.Rotation + 90) % 360
+		}
+		return
+	}); err != nil {
+		return
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var l = m.Layers[i]
+		l.OffsetX, l.OffsetY = -l.OffsetY, l.OffsetX
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		var (
+			l    = m.ImageLayers[i]
+			w, h = l.imageSize()
+			cx   = l.OffsetX + w/2
+			cy   = l.OffsetY + h/2
+		)
+		l.OffsetX, l.OffsetY = ph-cy-w/2, cx-h/2
+	}
+	m.Width, m.Height = m.Height, m.Width
+	return
+}
+
+// Mirrors an orthogonal map left to right (HORIZONTAL) or top to bottom
+// (VERTICAL). Tiles, including those of tile objects, have their flip
+// flags toggled. Objects are moved so they cover the mirrored area, with
+// their rotation negated and polygon and polyline points mirrored. Layer
+// offsets are mirrored too.
+//
+// Image layers cannot be flipped in TMX, so their images are moved to
+// cover the mirrored area instead.
+func (m *Map) Mirror(axis Axis) (err error) {
+	var (
+		w, h   = int(m.Width), int(m.Height)
+		pw, ph = float32(m.Width * m.TileWidth), float32(m.Height * m.TileHeight)
+		cell   func(x, y int) (int, int)
+		tile   func(t DataTileGridTile) DataTileGridTile
+		point  func(p Point) Point
+		flag   uint32
+	)
+	if err = m.checkOrthogonal("Mirroring"); err != nil {
+		return
+	}
+	switch axis {
+	case HORIZONTAL:
+		cell = func(x, y int) (int, int) { return w - 1 - x, y }
+		tile = func(t DataTileGridTile) DataTileGridTile {
+			t.FlipX = !t.FlipX
+			return t
+		}
+		point = func(p Point) Point { return Point{-p.X, p.Y} }
+		flag = FLIPPED_H_FLAG
+	case VERTICAL:
+		cell = func(x, y int) (int, int) { return x, h - 1 - y }
+		tile = func(t DataTileGridTile) DataTileGridTile {
+			t.FlipY = !t.FlipY
+			return t
+		}
+		point = func(p Point) Point { return Point{p.X, -p.Y} }
+		flag = FLIPPED_V_FLAG
+	default:
+		err = fmt.Errorf("Invalid axis %v", axis)
+		return
+	}
+	if err = m.transformGrids(w, h, cell, func(t DataTileGridTile) DataTileGridTile {
+		if t.Id == 0 {
+			return t
+		}
+		return tile(t)
+	}); err != nil {
+		return
+	}
+	if err = m.EachObject(func(g *ObjectGroup, o *Object) (err error) {
+		// The mirrored area of the object is its local area moved by
+		// shift, which is then rotated along with the object.
+		var shift Point
+		switch {
+		case o.Polygon != nil:
+			err = transformPoints(o.Polygon, point)
+		case o.Polyline != nil:
+			err = transformPoints(o.Polyline, point)
+		case axis == HORIZONTAL:
+			shift.X = -float32(o.Width)
+		case o.Gid != nil:
+			// Tile objects extend up from their position.
+			shift.Y = float32(o.Height)
+		default:
+			shift.Y = -float32(o.Height)
+		}
+		if o.Gid != nil {
+			var gid = *o.Gid ^ flag
+			o.Gid = &gid
+		}
+		if err != nil {
+			return
+		}
+		var (
+			anchor = point(Point{float32(o.X), float32(o.Y)})
+			theta  = -float64(o.Rotation) * math.Pi / 180
+			sin    = float32(math.Sin(theta))
+			cos    = float32(math.Cos(theta))
+		)
+		anchor.X += shift.X*cos - shift.Y*sin
+		anchor.Y += shift.X*sin + shift.Y*cos
+		if axis == HORIZONTAL {
+			anchor.X += pw
+		} else {
+			anchor.Y += ph
+		}
+		o.X = int32(math.Floor(float64(anchor.X) + 0.5))
+		o.Y = int32(math.Floor(float64(anchor.Y) + 0.5))
+		o.Rotation = -o.Rotation
+		return
+	}); err != nil {
+		return
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var offset = point(Point{m.Layers[i].OffsetX, m.Layers[i].OffsetY})
+		m.Layers[i].OffsetX, m.Layers[i].OffsetY = offset.X, offset.Y
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		var (
+			l        = m.ImageLayers[i]
+			iw, ih   = l.imageSize()
+			mirrored = point(Point{l.OffsetX + iw, l.OffsetY + ih})
+		)
+		if axis == HORIZONTAL {
+			l.OffsetX = pw + mirrored.X
+		} else {
+			l.OffsetY = ph + mirrored.Y
+		}
+	}
+	return
+}
+
+func (m *Map) checkOrthogonal(action string) error {
+	if m.Orientation != "orthogonal" && m.Orientation != "" {
+		return fmt.Errorf("%v %v maps is not supported", action, m.Orientation)
+	}
+	return nil
+}
+
+// Replaces the grid of every layer with one of w x h tiles, where the
+// tile at x, y is taken from the position source returns, or left empty
+// if that is outside the old grid. If tile is not nil, it is applied to
+// every tile taken.
+func (m *Map) transformGrids(w, h int, source func(x, y int) (int, int), tile func(t DataTileGridTile) DataTileGridTile) (err error) {
+	var grid DataTileGrid
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			l           = m.Layers[i]
+			transformed = NewDataTileGrid(w, h)
+		)
+		if grid, err = l.GetGrid(); err != nil {
+			return m.layerError(l, err)
+		}
+		if grid.Width != int(m.Width) || grid.Height != int(m.Height) {
+			return m.layerError(l, fmt.Errorf("Size differs from map size"))
+		}
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				var sx, sy = source(x, y)
+				if sx < 0 || sy < 0 || sx >= grid.Width || sy >= grid.Height {
+					continue
+				}
+				transformed.Tiles[x][y] = grid.Tiles[sx][sy]
+				if tile != nil {
+					transformed.Tiles[x][y] = tile(grid.Tiles[sx][sy])
+				}
+			}
+		}
+		if err = l.SetGrid(transformed); err != nil {
+			return m.layerError(l, err)
+		}
+		l.Width = int32(w)
+		l.Height = int32(h)
+	}
+	return
+}
+
+// The flip flags of a tile rotated 90 degrees clockwise, indexed by the
+// flags of the unrotated tile, each as fliph<<2 | flipv<<1 | flipd.
+var rotateRightFlags = [8]uint8{5, 4, 1, 0, 7, 6, 3, 2}
+
+func rotateTileRight(t DataTileGridTile) DataTileGridTile {
+	var flags uint8
+	if t.Id == 0 {
+		return t
+	}
+	if t.FlipX {
+		flags |= 4
+	}
+	if t.FlipY {
+		flags |= 2
+	}
+	if t.FlipD {
+		flags |= 1
+	}
+	flags = rotateRightFlags[flags]
+	t.FlipX, t.FlipY, t.FlipD = flags&4 != 0, flags&2 != 0, flags&1 != 0
+	return t
+}
+
+func transformPoints(p pointList, fn func(p Point) Point) (err error) {
+	var points []Point
+	if points, err = p.Points(); err != nil {
+		return
+	}
+	for i := 0; i < len(points); i++ {
+		points[i] = fn(points[i])
+		// Turns negative zeros, which would be written as "-0", positive.
+		points[i].X += 0
+		points[i].Y += 0
+	}
+	p.SetPoints(points)
+	return
+}
+
+func (l *ImageLayer) imageSize() (w, h float32) {
+	if l.Image == nil {
+		return
+	}
+	return float32(l.Image.Width), float32(l.Image.Height)
+}
+
+// Returns a new map holding the part of an orthogonal map covered by
+// rect, given in tiles with Y growing down as in TMX files. Layers are
+// cropped to rect, and only objects whose bounds are centered within it
+// are kept, so every object ends up in exactly one region when a map is
+// split up.
+// Objects and image layers are moved along with the tiles. Tilesets no
+// tile of the region refers to are dropped and gids are renumbered as by
+// CompactGids. Tilesets, images and properties are shared with m.
+func (m *Map) ExtractRegion(rect image.Rectangle) (region *Map, err error) {
+	var (
+		grid   DataTileGrid
+		layer  *Layer
+		dx, dy = int32(rect.Min.X) * m.TileWidth, int32(rect.Min.Y) * m.TileHeight
+		pixels = image.Rect(int(dx), int(dy), rect.Max.X*int(m.TileWidth), rect.Max.Y*int(m.TileHeight))
+	)
+	if err = m.checkOrthogonal("Extracting regions of"); err != nil {
+		return
+	}
+	if rect.Empty() || !rect.In(image.Rect(0, 0, int(m.Width), int(m.Height))) {
+		err = fmt.Errorf("Region %v outside of map of %vx%v tiles", rect, m.Width, m.Height)
+		return
+	}
+	region = &Map{
+		Version:         m.Version,
+		Orientation:     m.Orientation,
+		Width:           int32(rect.Dx()),
+		Height:          int32(rect.Dy()),
+		TileWidth:       m.TileWidth,
+		TileHeight:      m.TileHeight,
+		BackgroundColor: m.BackgroundColor,
+		Properties:      m.Properties,
+		Tilesets:        append([]*Tileset{}, m.Tilesets...),
+		BaseDir:         m.BaseDir,
+		Loader:          m.Loader,
+		Project:         m.Project,
+		Origin:          m.Origin,
+		RenderOrder:     m.RenderOrder,
+		NextLayerId:     m.NextLayerId,
+		ParallaxOriginX: m.ParallaxOriginX,
+		ParallaxOriginY: m.ParallaxOriginY,
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var (
+			src     = m.Layers[i]
+			cropped = NewDataTileGrid(rect.Dx(), rect.Dy())
+		)
+		if grid, err = layerGrid(m, src); err != nil {
+			return
+		}
+		for x := 0; x < cropped.Width; x++ {
+			copy(cropped.Tiles[x], grid.Tiles[rect.Min.X+x][rect.Min.Y:])
+		}
+		if layer, err = NewLayer(src.Name, cropped); err != nil {
+			return
+		}
+		layer.Opacity, layer.Visible, layer.Properties = src.Opacity, src.Visible, src.Properties
+		layer.OffsetX, layer.OffsetY = src.OffsetX, src.OffsetY
+		layer.ParallaxX, layer.ParallaxY = src.ParallaxX, src.ParallaxY
+		layer.Id = src.Id
+		region.Layers = append(region.Layers, layer)
+	}
+	for i := 0; i < len(m.ObjectGroups); i++ {
+		var g = *m.ObjectGroups[i]
+		g.Objects = nil
+		for j := 0; j < len(m.ObjectGroups[i].Objects); j++ {
+			var (
+				o = m.ObjectGroups[i].Objects[j]
+				b Bounds
+			)
+			if b, err = o.MapBounds(); err != nil {
+				return
+			}
+			if !image.Pt(int(math.Floor(float64(b.X+b.W/2))), int(math.Floor(float64(b.Y+b.H/2)))).In(pixels) {
+				continue
+			}
+			o.X -= dx
+			o.Y -= dy
+			g.Objects = append(g.Objects, o)
+		}
+		region.ObjectGroups = append(region.ObjectGroups, &g)
+	}
+	for i := 0; i < len(m.ImageLayers); i++ {
+		var l = *m.ImageLayers[i]
+		l.OffsetX -= float32(dx)
+		l.OffsetY -= float32(dy)
+		region.ImageLayers = append(region.ImageLayers, &l)
+	}
+	_, err = region.CompactGids(false)
+	return
+}
+
+// Where existing content is kept when resizing.
+type Anchor int
+
+const (
+	ANCHOR_TOP_LEFT Anchor = iota
+	ANCHOR_TOP
+	ANCHOR_TOP_RIGHT
+	ANCHOR_LEFT
+	ANCHOR_CENTER
+	ANCHOR_RIGHT
+	ANCHOR_BOTTOM_LEFT
+	ANCHOR_BOTTOM
+	ANCHOR_BOTTOM_RIGHT
+)
+
+// Returns the position of content of size w by h within an area of size
+// newW by newH, in tiles. Negative positions crop the content.
+func (a Anchor) offset(w, h, newW, newH int32) (dx, dy int32) {
+	var col, row = int32(a % 3), int32(a / 3)
+	return (newW - w) * col / 2, (newH - h) * row / 2
+}
+
+// Resizes the layer to newW by newH tiles. The existing tiles are kept
+// at the side or corner given by anchor, tiles beyond the new size are
+// cropped and new cells are set to fill. The map and the layer's offset
+// are left unchanged.
+func (l *Layer) Resize(newW, newH int32, anchor Anchor, fill DataTileGridTile) (err error) {
+	var (
+		grid    DataTileGrid
+		resized DataTileGrid
+		dx, dy  = anchor.offset(l.Width, l.Height, newW, newH)
+	)
+	if newW < 0 || newH < 0 {
+		return fmt.Errorf("Invalid layer size %vx%v", newW, newH)
+	}
+	if grid, err = l.GetGrid(); err != nil {
+		return
+	}
+	resized = NewDataTileGrid(int(newW), int(newH))
+	for x := 0; x < resized.Width; x++ {
+		for y := 0; y < resized.Height; y++ {
+			var sx, sy = x - int(dx), y - int(dy)
+			if sx >= 0 && sx < grid.Width && sy >= 0 && sy < grid.Height {
+				resized.Tiles[x][y] = grid.Tiles[sx][sy]
+			} else {
+				resized.Tiles[x][y] = fill
+			}
+		}
+	}
+	if err = l.SetGrid(resized); err != nil {
+		return
+	}
+	l.Width, l.Height = newW, newH
+	return
+}
@@ -0,0 +1,670 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_SEGMENT_A = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="2" height="2" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="sprites1" tilewidth="16" tileheight="16">
+  <image source="sprites1.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ground" width="2" height="2">
+  <data>
+   <tile gid="1" />
+   <tile gid="2" />
+   <tile gid="3" />
+   <tile gid="4" />
+  </data>
+ </layer>
+ <objectgroup name="spawns">
+  <object name="a" x="8" y="8"/>
+ </objectgroup>
+</map>
+`
+
+const TEST_SEGMENT_B = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="2" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="sprites2" tilewidth="16" tileheight="16">
+  <image source="sprites2.png" width="32" height="16"/>
+ </tileset>
+ <tileset firstgid="3" name="sprites1" tilewidth="16" tileheight="16">
+  <image source="sprites1.png" width="64" height="16"/>
+ </tileset>
+ <layer name="ground" width="1" height="2">
+  <data>
+   <tile gid="2" />
+   <tile gid="2147483652" />
+  </data>
+ </layer>
+ <objectgroup name="spawns">
+  <object name="b" x="4" y="4" gid="1"/>
+ </objectgroup>
+</map>
+`
+
+func TestConcatMaps(t *testing.T) {
+	var (
+		a, b, m *Map
+		grid    DataTileGrid
+		out     string
+		err     error
+	)
+	if a, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = ParseMapString(TEST_SEGMENT_B); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = ConcatMaps(a, b, VERTICAL); err == nil {
+		t.Errorf("Expected error joining maps of different widths")
+	}
+	if m, err = ConcatMaps(a, b, HORIZONTAL); err != nil {
+		t.Fatalf("Could not concat: %v", err)
+	}
+	if m.Width != 3 || m.Height != 2 {
+		t.Errorf("Invalid size: %vx%v", m.Width, m.Height)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].Name != "sprites2" || m.Tilesets[1].FirstGid != 5 {
+		t.Fatalf("Tilesets not reconciled: %v", m.Tilesets)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[1][1].Id != 4 {
+		t.Errorf("Tiles of a changed: %v", grid.Tiles[1][1].Id)
+	}
+	if grid.Tiles[2][0].Id != 6 {
+		t.Errorf("Tile of b not remapped: %v", grid.Tiles[2][0].Id)
+	}
+	if grid.Tiles[2][1].Id != 2 || !grid.Tiles[2][1].FlipX {
+		t.Errorf("Shared tile of b not remapped: %v", grid.Tiles[2][1])
+	}
+	var objects = m.ObjectGroups[0].Objects
+	if len(objects) != 2 || objects[1].X != 36 || objects[1].Y != 4 || *objects[1].Gid != 5 {
+		t.Errorf("Objects of b not offset: %v", objects)
+	}
+	if *b.ObjectGroups[0].Objects[0].Gid != 1 || b.ObjectGroups[0].Objects[0].X != 4 {
+		t.Errorf("Source map modified")
+	}
+	if out, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if !strings.Contains(out, "<map ") {
+		t.Errorf("Invalid root element: %v", out)
+	}
+}
+
+func TestConcatIdsAndImageLayers(t *testing.T) {
+	var (
+		a, b, m *Map
+		err     error
+	)
+	if a, err = ParseMapString(strings.Replace(TEST_SEGMENT_A,
+		`<object name="a"`, `<object id="3" name="a"`, 1)); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = ParseMapString(strings.Replace(TEST_SEGMENT_B,
+		`<object name="b" x="4" y="4" gid="1"/>`,
+		`<object id="1" name="b" x="4" y="4" gid="1"/>`+
+			`<object id="2" name="c" x="0" y="0"><properties>`+
+			`<property name="target" type="object" value="1"/></properties></object>`, 1)); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	a.NextObjectId = 5
+	a.ImageLayers = []*ImageLayer{&ImageLayer{Name: "sky", OffsetX: 1}}
+	b.ImageLayers = []*ImageLayer{&ImageLayer{Name: "hills", OffsetX: 2, OffsetY: 3}}
+	if m, err = ConcatMaps(a, b, HORIZONTAL); err != nil {
+		t.Fatalf("Could not concat: %v", err)
+	}
+	var objects = m.ObjectGroups[0].Objects
+	if len(objects) != 3 || objects[0].Id != 3 || objects[1].Id != 5 || objects[2].Id != 6 {
+		t.Fatalf("Object ids of b not renumbered: %v", objects)
+	}
+	if objects[2].Properties[0].Value != "5" {
+		t.Errorf("Object reference not renumbered: %v", objects[2].Properties)
+	}
+	if b.ObjectGroups[0].Objects[1].Properties[0].Value != "1" {
+		t.Errorf("Source properties modified")
+	}
+	if m.NextObjectId != 7 {
+		t.Errorf("Invalid next object id: %v", m.NextObjectId)
+	}
+	if len(m.ImageLayers) != 2 || m.ImageLayers[0].OffsetX != 1 ||
+		m.ImageLayers[1].OffsetX != 34 || m.ImageLayers[1].OffsetY != 3 {
+		t.Fatalf("Image layers of b not offset: %v", m.ImageLayers)
+	}
+	if m.ImageLayers[0] == a.ImageLayers[0] || b.ImageLayers[0].OffsetX != 2 {
+		t.Errorf("Image layers shared with source maps")
+	}
+}
+
+const TEST_EXTERNAL_SEGMENT = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" source="SOURCE"/>
+ <layer name="ground" width="1" height="1">
+  <data><tile gid="2"/></data>
+ </layer>
+</map>
+`
+
+func TestConcatExternalTilesets(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"a.tmx": &fstest.MapFile{Data: []byte(strings.Replace(TEST_EXTERNAL_SEGMENT, "SOURCE", "a.tsx", 1))},
+			"b.tmx": &fstest.MapFile{Data: []byte(strings.Replace(TEST_EXTERNAL_SEGMENT, "SOURCE", "b.tsx", 1))},
+			"a.tsx": &fstest.MapFile{Data: []byte(TEST_EXTERNAL_TILESET)},
+			"b.tsx": &fstest.MapFile{Data: []byte(strings.Replace(TEST_EXTERNAL_TILESET, "terrain", "props", -1))},
+		})
+		a, b, m *Map
+		tile    DataTileGridTile
+		ts      *Tileset
+		err     error
+	)
+	if a, err = loader.ParseMapFile("a.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = loader.ParseMapFile("b.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = ConcatMaps(a, b, HORIZONTAL); err == nil {
+		t.Errorf("Expected error for tilesets not loaded")
+	}
+	if _, err = StitchMaps([]MapPart{{a, 0, 0}, {b, 1, 0}}); err == nil {
+		t.Errorf("Expected error for tilesets not loaded")
+	}
+	if err = a.EmbedExternalTilesets(loader); err != nil {
+		t.Fatalf("Could not embed tilesets: %v", err)
+	}
+	if err = b.EmbedExternalTilesets(loader); err != nil {
+		t.Fatalf("Could not embed tilesets: %v", err)
+	}
+	if m, err = ConcatMaps(a, b, HORIZONTAL); err != nil {
+		t.Fatalf("Could not concat: %v", err)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].FirstGid != 5 {
+		t.Fatalf("Tilesets overlap: %v", m.Tilesets)
+	}
+	if tile, err = m.Layers[0].TileAt(1, 0); err != nil || tile.Id != 6 {
+		t.Fatalf("Tile of b not remapped: %v %v", tile, err)
+	}
+	if ts, err = m.TilesetForGid(tile.Id); err != nil || ts.Name != "props" {
+		t.Errorf("Tile of b in wrong tileset: %v %v", ts, err)
+	}
+}
+
+func TestStitchMaps(t *testing.T) {
+	var (
+		a, b, m *Map
+		grid    DataTileGrid
+		err     error
+	)
+	if a, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if b, err = ParseMapString(TEST_SEGMENT_B); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if _, err = StitchMaps(nil); err == nil {
+		t.Errorf("Expected error stitching no maps")
+	}
+	if m, err = StitchMaps([]MapPart{{a, 1, 2}, {b, 2, 1}}); err != nil {
+		t.Fatalf("Could not stitch: %v", err)
+	}
+	if m.Width != 2 || m.Height != 3 {
+		t.Errorf("Invalid size: %vx%v", m.Width, m.Height)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].Name != "sprites2" || m.Tilesets[1].FirstGid != 5 {
+		t.Fatalf("Tilesets not reconciled: %v", m.Tilesets)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[0][0].Id != 0 || grid.Tiles[0][1].Id != 1 || grid.Tiles[0][2].Id != 3 || grid.Tiles[1][2].Id != 4 {
+		t.Errorf("Tiles of a not placed: %v", grid.Tiles)
+	}
+	if grid.Tiles[1][0].Id != 6 || grid.Tiles[1][1].Id != 2 || !grid.Tiles[1][1].FlipX {
+		t.Errorf("Tiles of b not placed over a: %v", grid.Tiles)
+	}
+	var objects = m.ObjectGroups[0].Objects
+	if len(objects) != 2 || objects[0].X != 8 || objects[0].Y != 24 || objects[1].X != 20 || objects[1].Y != 4 || *objects[1].Gid != 5 {
+		t.Errorf("Objects not offset: %v", objects)
+	}
+}
+
+func TestScaleTiles(t *testing.T) {
+	var (
+		m      *Map
+		points []Point
+		err    error
+	)
+	if m, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.ObjectGroups[0].Objects[0].Polygon = &Polygon{RawPoints: "0,0 4,2.5"}
+	if err = m.ScaleTiles(2); err != nil {
+		t.Fatalf("Could not scale: %v", err)
+	}
+	if m.TileWidth != 32 || m.Tilesets[0].TileHeight != 32 || m.Tilesets[0].Image.Width != 128 {
+		t.Errorf("Tile sizes not scaled")
+	}
+	var o = m.ObjectGroups[0].Objects[0]
+	if o.X != 16 || o.Y != 16 {
+		t.Errorf("Object not scaled: %v,%v", o.X, o.Y)
+	}
+	if points, err = o.Polygon.Points(); err != nil {
+		t.Fatalf("Could not parse points: %v", err)
+	}
+	if points[1].X != 8 || points[1].Y != 5 {
+		t.Errorf("Points not scaled: %v", points)
+	}
+}
+
+func TestLayerUpsample(t *testing.T) {
+	var (
+		m    *Map
+		grid DataTileGrid
+		err  error
+	)
+	if m, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.Layers[0].Upsample(2); err != nil {
+		t.Fatalf("Could not upsample: %v", err)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Width != 4 || grid.Height != 4 {
+		t.Fatalf("Invalid size: %vx%v", grid.Width, grid.Height)
+	}
+	if grid.Tiles[1][1].Id != 1 || grid.Tiles[2][1].Id != 2 || grid.Tiles[3][3].Id != 4 {
+		t.Errorf("Tiles not repeated")
+	}
+}
+
+func TestLayerRegrid(t *testing.T) {
+	var (
+		grid  = NewDataTileGrid(3, 1)
+		layer *Layer
+		out   *Layer
+		err   error
+	)
+	grid.Tiles[0][0].Id = 1
+	grid.Tiles[2][0].Id = 2
+	if layer, err = NewLayer("art", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	for _, c := range []struct {
+		rule RegridRule
+		want []uint32
+	}{
+		{REGRID_MAJORITY, []uint32{1, 1, 0, 0, 2, 2}},
+		{REGRID_ANY, []uint32{1, 1, 0, 0, 2, 2}},
+		{REGRID_ALL, []uint32{1, 1, 0, 0, 2, 2}},
+	} {
+		if out, err = layer.Regrid(32, 32, 16, 16, c.rule); err != nil {
+			t.Fatalf("Could not regrid: %v", err)
+		}
+		if grid, err = out.GetGrid(); err != nil {
+			t.Fatalf("Could not get grid: %v", err)
+		}
+		if grid.Width != 6 || grid.Height != 2 {
+			t.Fatalf("Invalid size: %vx%v", grid.Width, grid.Height)
+		}
+		for x := 0; x < 6; x++ {
+			if grid.Tiles[x][1].Id != c.want[x] {
+				t.Errorf("Rule %v: wrong tile at %v: %v", c.rule, x, grid.Tiles[x][1].Id)
+			}
+		}
+	}
+	for _, c := range []struct {
+		rule RegridRule
+		want []uint32
+	}{
+		{REGRID_MAJORITY, []uint32{1, 2}},
+		{REGRID_ANY, []uint32{1, 2}},
+		{REGRID_ALL, []uint32{0, 2}},
+	} {
+		if out, err = layer.Regrid(16, 16, 32, 16, c.rule); err != nil {
+			t.Fatalf("Could not regrid: %v", err)
+		}
+		if grid, err = out.GetGrid(); err != nil {
+			t.Fatalf("Could not get grid: %v", err)
+		}
+		if grid.Width != 2 || grid.Tiles[0][0].Id != c.want[0] || grid.Tiles[1][0].Id != c.want[1] {
+			t.Errorf("Rule %v: wrong tiles %v", c.rule, grid.Tiles)
+		}
+	}
+}
+
+func TestMapTrim(t *testing.T) {
+	var (
+		m    = &Map{Orientation: "orthogonal", Width: 5, Height: 4, TileWidth: 16, TileHeight: 16}
+		grid = NewDataTileGrid(5, 4)
+		crop image.Rectangle
+		err  error
+	)
+	grid.Tiles[2][1].Id = 7
+	m.Layers = make([]*Layer, 1)
+	if m.Layers[0], err = NewLayer("ground", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	m.ObjectGroups = []*ObjectGroup{{Name: "spawns", Objects: []Object{{X: 48, Y: 48, Width: 8, Height: 8}}}}
+	m.ImageLayers = []*ImageLayer{{Name: "sky", OffsetX: 40, OffsetY: 4}}
+	if crop, err = m.Trim(); err != nil {
+		t.Fatalf("Could not trim: %v", err)
+	}
+	if crop != image.Rect(2, 1, 4, 4) || m.Width != 2 || m.Height != 3 {
+		t.Errorf("Invalid crop: %v %vx%v", crop, m.Width, m.Height)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Width != 2 || grid.Height != 3 || grid.Tiles[0][0].Id != 7 {
+		t.Errorf("Layer not cropped: %v", grid)
+	}
+	if o := m.ObjectGroups[0].Objects[0]; o.X != 16 || o.Y != 32 {
+		t.Errorf("Object not moved: %v,%v", o.X, o.Y)
+	}
+	if l := m.ImageLayers[0]; l.OffsetX != 8 || l.OffsetY != -12 {
+		t.Errorf("Image layer not moved: %v,%v", l.OffsetX, l.OffsetY)
+	}
+}
+
+func newSceneMap(t *testing.T) (m *Map) {
+	var (
+		grid = NewDataTileGrid(3, 2)
+		gid  = uint32(2)
+		err  error
+	)
+	m = &Map{Orientation: "orthogonal", Width: 3, Height: 2, TileWidth: 16, TileHeight: 16}
+	grid.Tiles[2][0].Id = 1
+	grid.Tiles[0][1] = DataTileGridTile{Id: 2, FlipX: true}
+	m.Layers = make([]*Layer, 1)
+	if m.Layers[0], err = NewLayer("ground", grid); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	m.ObjectGroups = []*ObjectGroup{{Name: "things", Objects: []Object{
+		{Name: "box", X: 4, Y: 2, Width: 16, Height: 8, Rotation: 30},
+		{Name: "shape", X: 20, Y: 10, Polygon: &Polygon{RawPoints: "0,0 8,0 0,12"}},
+		{Name: "tile", X: 16, Y: 32, Width: 16, Height: 16, Gid: &gid},
+	}}}
+	m.ImageLayers = []*ImageLayer{{Name: "sky", Image: &Image{Width: 10, Height: 4}}}
+	return
+}
+
+// Returns the outline of every object of m in map pixels.
+func sceneOutlines(t *testing.T, m *Map) (outlines []Path) {
+	m.EachObject(func(g *ObjectGroup, o *Object) error {
+		var points, err = o.MapPoints()
+		if err != nil {
+			t.Fatalf("Could not get points: %v", err)
+		}
+		outlines = append(outlines, points)
+		return nil
+	})
+	return
+}
+
+// Returns whether a and b have the same points, in any order.
+func sameOutline(a, b Path) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		var found bool
+		for j := 0; j < len(b) && !found; j++ {
+			found = math.Abs(float64(a[i].X-b[j].X)) <= 0.5 && math.Abs(float64(a[i].Y-b[j].Y)) <= 0.5
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMapTranslate(t *testing.T) {
+	var (
+		m    = newSceneMap(t)
+		grid DataTileGrid
+		err  error
+	)
+	if err = m.Translate(-1, 1); err != nil {
+		t.Fatalf("Could not translate: %v", err)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Tiles[1][1].Id != 1 || grid.Tiles[0][1].Id != 0 {
+		t.Errorf("Tiles not moved: %v", grid)
+	}
+	if o := m.ObjectGroups[0].Objects[0]; o.X != -12 || o.Y != 18 {
+		t.Errorf("Object not moved: %v,%v", o.X, o.Y)
+	}
+	if l := m.ImageLayers[0]; l.OffsetX != -16 || l.OffsetY != 16 {
+		t.Errorf("Image layer not moved: %v,%v", l.OffsetX, l.OffsetY)
+	}
+}
+
+func TestMapRotate90(t *testing.T) {
+	var (
+		m        = newSceneMap(t)
+		before   = sceneOutlines(t, m)
+		original string
+		rotated  string
+		grid     DataTileGrid
+		err      error
+	)
+	if original, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if err = m.Rotate90(); err != nil {
+		t.Fatalf("Could not rotate: %v", err)
+	}
+	if m.Width != 2 || m.Height != 3 {
+		t.Errorf("Size not swapped: %vx%v", m.Width, m.Height)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if tile := grid.Tiles[1][2]; tile != (DataTileGridTile{Id: 1, FlipX: true, FlipD: true}) {
+		t.Errorf("Invalid rotated tile: %v", tile)
+	}
+	if tile := grid.Tiles[0][0]; tile != (DataTileGridTile{Id: 2, FlipX: true, FlipY: true, FlipD: true}) {
+		t.Errorf("Invalid rotated flipped tile: %v", tile)
+	}
+	var after = sceneOutlines(t, m)
+	for i := 0; i < len(before); i++ {
+		for j := 0; j < len(before[i]); j++ {
+			before[i][j] = Point{32 - before[i][j].Y, before[i][j].X}
+		}
+		if !sameOutline(before[i], after[i]) {
+			t.Errorf("Object %v not rotated: %v, expected %v", i, after[i], before[i])
+		}
+	}
+	if l := m.ImageLayers[0]; l.OffsetX != 25 || l.OffsetY != 3 {
+		t.Errorf("Image layer not moved: %v,%v", l.OffsetX, l.OffsetY)
+	}
+	for i := 0; i < 3; i++ {
+		if err = m.Rotate90(); err != nil {
+			t.Fatalf("Could not rotate: %v", err)
+		}
+	}
+	if rotated, err = m.Serialize(); err != nil {
+		t.Fatalf("Could not serialize: %v", err)
+	}
+	if rotated != original {
+		t.Errorf("Four rotations changed the map: %v, expected %v", rotated, original)
+	}
+	m.TileHeight = 8
+	if err = m.Rotate90(); err == nil {
+		t.Errorf("Expected error for non square tiles")
+	}
+}
+
+func TestMapMirror(t *testing.T) {
+	for _, axis := range []Axis{HORIZONTAL, VERTICAL} {
+		var (
+			m        = newSceneMap(t)
+			before   = sceneOutlines(t, m)
+			original string
+			mirrored string
+			grid     DataTileGrid
+			err      error
+		)
+		if original, err = m.Serialize(); err != nil {
+			t.Fatalf("Could not serialize: %v", err)
+		}
+		if err = m.Mirror(axis); err != nil {
+			t.Fatalf("Could not mirror: %v", err)
+		}
+		if grid, err = m.Layers[0].GetGrid(); err != nil {
+			t.Fatalf("Could not get grid: %v", err)
+		}
+		var expected = DataTileGridTile{Id: 1, FlipX: axis == HORIZONTAL, FlipY: axis == VERTICAL}
+		if axis == HORIZONTAL && grid.Tiles[0][0] != expected ||
+			axis == VERTICAL && grid.Tiles[2][1] != expected {
+			t.Errorf("Invalid mirrored tiles along %v: %v", axis, grid)
+		}
+		var after = sceneOutlines(t, m)
+		for i := 0; i < len(before); i++ {
+			for j := 0; j < len(before[i]); j++ {
+				if axis == HORIZONTAL {
+					before[i][j].X = 48 - before[i][j].X
+				} else {
+					before[i][j].Y = 32 - before[i][j].Y
+				}
+			}
+			if !sameOutline(before[i], after[i]) {
+				t.Errorf("Object %v not mirrored along %v: %v, expected %v", i, axis, after[i], before[i])
+			}
+		}
+		if err = m.Mirror(axis); err != nil {
+			t.Fatalf("Could not mirror: %v", err)
+		}
+		if mirrored, err = m.Serialize(); err != nil {
+			t.Fatalf("Could not serialize: %v", err)
+		}
+		if mirrored != original {
+			t.Errorf("Mirroring twice along %v changed the map: %v, expected %v", axis, mirrored, original)
+		}
+	}
+}
+
+func TestExtractRegion(t *testing.T) {
+	var (
+		m      = newSceneMap(t)
+		region *Map
+		layer  *Layer
+		grid   DataTileGrid
+		err    error
+	)
+	m.Tilesets = []*Tileset{
+		{FirstGid: 1, Name: "a", TileCount: 1},
+		{FirstGid: 2, Name: "b", TileCount: 1},
+	}
+	if region, err = m.ExtractRegion(image.Rect(0, 1, 2, 2)); err != nil {
+		t.Fatalf("Could not extract: %v", err)
+	}
+	if region.Width != 2 || region.Height != 1 {
+		t.Errorf("Invalid size: %vx%v", region.Width, region.Height)
+	}
+	if len(region.Tilesets) != 1 || region.Tilesets[0].Name != "b" || region.Tilesets[0].FirstGid != 1 {
+		t.Errorf("Tilesets not pruned: %v", region.Tilesets)
+	}
+	if grid, err = region.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if tile := grid.Tiles[0][0]; tile != (DataTileGridTile{Id: 1, FlipX: true}) {
+		t.Errorf("Invalid tile: %v", tile)
+	}
+	var objects = region.ObjectGroups[0].Objects
+	if len(objects) != 2 || objects[0].Name != "shape" || objects[1].Name != "tile" {
+		t.Fatalf("Invalid objects: %v", objects)
+	}
+	if o := objects[1]; o.X != 16 || o.Y != 16 || *o.Gid != 1 {
+		t.Errorf("Invalid tile object: %v", o)
+	}
+	if len(m.ObjectGroups[0].Objects) != 3 || m.Tilesets[1].FirstGid != 2 {
+		t.Errorf("Source map changed")
+	}
+	if _, err = m.ExtractRegion(image.Rect(2, 0, 4, 1)); err == nil {
+		t.Errorf("Expected error for region outside the map")
+	}
+	var other = NewDataTileGrid(3, 2)
+	other.Tiles[0][1].Id = 1
+	if layer, err = NewLayer("ground", other); err != nil {
+		t.Fatalf("Could not create layer: %v", err)
+	}
+	m.Layers = append(m.Layers, layer)
+	if region, err = m.ExtractRegion(image.Rect(0, 1, 2, 2)); err != nil {
+		t.Fatalf("Could not extract: %v", err)
+	}
+	if grid, err = region.Layers[1].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if tile := grid.Tiles[0][0]; tile.Id != 1 || tile.FlipX {
+		t.Errorf("Tiles of layer sharing a name not kept: %v", tile)
+	}
+}
+
+func TestLayerResize(t *testing.T) {
+	var (
+		m    *Map
+		grid DataTileGrid
+		fill = DataTileGridTile{Id: 9}
+		err  error
+	)
+	if m, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.Layers[0].Resize(4, 3, ANCHOR_BOTTOM_RIGHT, fill); err != nil {
+		t.Fatalf("Could not resize: %v", err)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if m.Layers[0].Width != 4 || m.Layers[0].Height != 3 || grid.Width != 4 || grid.Height != 3 {
+		t.Fatalf("Invalid size: %vx%v", grid.Width, grid.Height)
+	}
+	if grid.Tiles[2][1].Id != 1 || grid.Tiles[3][2].Id != 4 || grid.Tiles[0][0].Id != 9 || grid.Tiles[3][0].Id != 9 {
+		t.Errorf("Content not anchored at bottom right: %v", grid.Tiles)
+	}
+	if m, err = ParseMapString(TEST_SEGMENT_A); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if err = m.Layers[0].Resize(1, 1, ANCHOR_CENTER, fill); err != nil {
+		t.Fatalf("Could not resize: %v", err)
+	}
+	if grid, err = m.Layers[0].GetGrid(); err != nil {
+		t.Fatalf("Could not get grid: %v", err)
+	}
+	if grid.Width != 1 || grid.Height != 1 || grid.Tiles[0][0].Id != 1 {
+		t.Errorf("Content not cropped around center: %v", grid.Tiles)
+	}
+	if err = m.Layers[0].Resize(-1, 1, ANCHOR_CENTER, fill); err == nil {
+		t.Errorf("Expected error for negative size")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The parts of a map referring to the tiles of a tileset.
+type TilesetUsage struct {
+	Tileset *Tileset
+
+	// The layers with at least one tile of the tileset, in map order.
+	Layers []*Layer
+
+	// The tile objects showing a tile of the tileset, in document order.
+	Objects []GroupObject
+
+	// The local ids of the tiles referenced, in ascending order.
+	Tiles []uint32
+}
+
+// Returns whether nothing in the map refers to the tileset.
+func (u *TilesetUsage) Unused() bool {
+	return len(u.Tiles) == 0
+}
+
+// Describes the usage in a line such as
+// "terrain: 12 tiles used by 2 layers (ground, walls) and 3 objects".
+func (u *TilesetUsage) String() string {
+	if u.Unused() {
+		return fmt.Sprintf("%v: unused", u.Tileset.Name)
+	}
+	var names = make([]string, len(u.Layers))
+	for i := 0; i < len(u.Layers); i++ {
+		names[i] = u.Layers[i].Name
+	}
+	return fmt.Sprintf("%v: %v tiles used by %v layers (%v) and %v objects",
+		u.Tileset.Name, len(u.Tiles), len(u.Layers), strings.Join(names, ", "), len(u.Objects))
+}
+
+// Returns one entry per tileset of the map, in the order of m.Tilesets,
+// listing the layers and tile objects referring to it and the tiles
+// they use. Tilesets nothing refers to have an entry with no tiles.
+func (m *Map) TilesetUsage() (usage []*TilesetUsage, err error) {
+	var (
+		tilesets = append([]*Tileset{}, m.Tilesets...)
+		byTs     = map[*Tileset]*TilesetUsage{}
+		seen     = map[*TilesetUsage]map[uint32]bool{}
+		grid     DataTileGrid
+	)
+	usage = make([]*TilesetUsage, len(m.Tilesets))
+	for i := 0; i < len(m.Tilesets); i++ {
+		usage[i] = &TilesetUsage{Tileset: m.Tilesets[i]}
+		byTs[m.Tilesets[i]] = usage[i]
+		seen[usage[i]] = map[uint32]bool{}
+	}
+	if len(tilesets) == 0 {
+		return
+	}
+	sort.Sort(byFirstGid(tilesets))
+	var use = func(gid uint32) (u *TilesetUsage) {
+		if gid &^= CLEAR_FLIP; gid == 0 {
+			return
+		}
+		var ts = tilesetForGid(tilesets, gid)
+		u = byTs[ts]
+		seen[u][gid-ts.FirstGid] = true
+		return
+	}
+	for i := 0; i < len(m.Layers); i++ {
+		var layers = map[*TilesetUsage]bool{}
+		if grid, err = m.Layers[i].GetGrid(); err != nil {
+			return nil, m.layerError(m.Layers[i], err)
+		}
+		for x := 0; x < grid.Width; x++ {
+			for y := 0; y < grid.Height; y++ {
+				if u := use(uint32(grid.Tiles[x][y].GID())); u != nil && !layers[u] {
+					layers[u] = true
+					u.Layers = append(u.Layers, m.Layers[i])
+				}
+			}
+		}
+	}
+	m.EachObject(func(g *ObjectGroup, o *Object) error {
+		if o.Gid != nil {
+			if u := use(*o.Gid); u != nil {
+				u.Objects = append(u.Objects, GroupObject{g, o})
+			}
+		}
+		return nil
+	})
+	for i := 0; i < len(usage); i++ {
+		for id := range seen[usage[i]] {
+			usage[i].Tiles = append(usage[i].Tiles, id)
+		}
+		sort.Slice(usage[i].Tiles, func(a, b int) bool { return usage[i].Tiles[a] < usage[i].Tiles[b] })
+	}
+	return
+}
@@ -0,0 +1,48 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTilesetUsage(t *testing.T) {
+	var (
+		m     *Map
+		gid   = uint32(4)
+		usage []*TilesetUsage
+		err   error
+	)
+	if m, err = ParseMapString(TEST_COMPACT_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	m.ObjectGroups = []*ObjectGroup{{Name: "things", Objects: []Object{{Gid: &gid}}}}
+	if usage, err = m.TilesetUsage(); err != nil {
+		t.Fatalf("Could not get usage: %v", err)
+	}
+	if len(usage) != 3 {
+		t.Fatalf("Expected an entry per tileset, got %v", usage)
+	}
+	if !reflect.DeepEqual(usage[0].Tiles, []uint32{1, 3}) || len(usage[0].Layers) != 1 || len(usage[0].Objects) != 1 {
+		t.Errorf("Invalid usage: %v", usage[0])
+	}
+	if !usage[1].Unused() || usage[1].String() != "b: unused" {
+		t.Errorf("Expected unused tileset: %v", usage[1])
+	}
+	if s := usage[2].String(); s != "c: 1 tiles used by 1 layers (ground) and 0 objects" {
+		t.Errorf("Invalid description: %v", s)
+	}
+}
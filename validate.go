@@ -0,0 +1,102 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"fmt"
+)
+
+// A problem found while validating a map, along with the element
+// it was found on, e.g. "tileset sprites32".
+type ValidationError struct {
+	Element string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Element, e.Message)
+}
+
+// Checks the map for authoring problems and returns all of them.
+// An empty result means no problems were found.
+func (m *Map) Validate() (errs []error) {
+	errs = append(errs, m.ValidateTilesets()...)
+	errs = append(errs, m.ValidateProperties()...)
+	errs = append(errs, m.ValidateObjects()...)
+	return
+}
+
+// Reports every object extending beyond the edges of the map, which
+// infinite maps don't have. See ObjectsOutOfBounds.
+func (m *Map) ValidateObjects() (errs []error) {
+	var (
+		out []GroupObject
+		err error
+	)
+	if out, err = m.ObjectsOutOfBounds(); err != nil {
+		return []error{err}
+	}
+	for i := 0; i < len(out); i++ {
+		var o = out[i].Object
+		errs = append(errs, &ValidationError{
+			Element: fmt.Sprintf("objectgroup %v object %v", out[i].Group.Name, o.Name),
+			Message: fmt.Sprintf("Extends beyond the map at %v,%v", o.X, o.Y),
+		})
+	}
+	return
+}
+
+// Checks that the tile count and columns declared by each tileset match
+// its image dimensions, given its tile size, spacing and margin. If the
+// map was read from a file, the image is loaded and its actual size is
+// also checked against the declared one, which catches tile sheets that
+// were resized after the map was last saved.
+func (m *Map) ValidateTilesets() (errs []error) {
+	for i := 0; i < len(m.Tilesets); i++ {
+		var (
+			ts      = m.Tilesets[i]
+			element = fmt.Sprintf("tileset %v", ts.Name)
+			report  = func(format string, args ...interface{}) {
+				errs = append(errs, &ValidationError{element, fmt.Sprintf(format, args...)})
+			}
+		)
+		if ts.Image == nil {
+			continue
+		}
+		var width, height = ts.Image.Width, ts.Image.Height
+		if m.BaseDir != "" || m.Loader != nil {
+			if img, err := m.LoadImage(ts.Image); err != nil {
+				report("Could not load image %v: %v", ts.Image.Source, err)
+			} else if size := img.Bounds().Size(); width != 0 && (int32(size.X) != width || int32(size.Y) != height) {
+				report("Image %v is %vx%v but declared as %vx%v",
+					ts.Image.Source, size.X, size.Y, width, height)
+				width, height = int32(size.X), int32(size.Y)
+			} else if width == 0 {
+				width, height = int32(size.X), int32(size.Y)
+			}
+		}
+		if width == 0 || height == 0 {
+			continue
+		}
+		var cols, rows = ts.gridSize(width, height)
+		if ts.Columns != 0 && ts.Columns != cols {
+			report("Declares %v columns but image fits %v", ts.Columns, cols)
+		}
+		if ts.TileCount != 0 && ts.TileCount != cols*rows {
+			report("Declares %v tiles but image fits %v", ts.TileCount, cols*rows)
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+// Copyright 2014 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmxgo
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+const TEST_RESIZED_SHEET_MAP = `
+<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.0" orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <tileset firstgid="1" name="ok" tilewidth="16" tileheight="16" tilecount="4" columns="4">
+  <image source="strip4.png" width="64" height="16"/>
+ </tileset>
+ <tileset firstgid="5" name="resized" tilewidth="16" tileheight="16" tilecount="4" columns="4">
+  <image source="strip2.png" width="64" height="16"/>
+ </tileset>
+ <tileset firstgid="9" name="miscounted" tilewidth="16" tileheight="16" tilecount="6" columns="4">
+  <image source="strip4.png" width="64" height="16"/>
+ </tileset>
+</map>
+`
+
+func TestValidateTilesets(t *testing.T) {
+	var (
+		loader = NewLoader(fstest.MapFS{
+			"level.tmx":  &fstest.MapFile{Data: []byte(TEST_RESIZED_SHEET_MAP)},
+			"strip4.png": &fstest.MapFile{Data: testStripPNG(t, 4)},
+			"strip2.png": &fstest.MapFile{Data: testStripPNG(t, 2)},
+		})
+		m    *Map
+		errs []error
+		err  error
+	)
+	if m, err = ParseMapString(TEST_RESIZED_SHEET_MAP); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	if errs = m.Validate(); len(errs) != 1 {
+		t.Errorf("Expected only the declared tile count to mismatch: %v", errs)
+	}
+	if m, err = loader.ParseMapFile("level.tmx"); err != nil {
+		t.Fatalf("Could not parse: %v", err)
+	}
+	errs = m.Validate()
+	if len(errs) != 4 {
+		t.Fatalf("Wrong number of problems: %v", errs)
+	}
+	if e, ok := errs[0].(*ValidationError); !ok || e.Element != "tileset resized" {
+		t.Errorf("Wrong problem reported: %v", errs[0])
+	}
+}